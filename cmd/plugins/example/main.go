@@ -0,0 +1,90 @@
+// Command example is a reference Whitelister plugin. Its ip provider whitelists a static list of
+// cidrs, and its provider writes the ip permissions it is asked to whitelist to a json file.
+//
+// Build it into the plugin directory to use it as the "example" ip provider and provider:
+//
+//	go build -o plugins/example ./cmd/plugins/example
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+
+	"github.com/stakater/Whitelister/pkg/plugin"
+)
+
+// IpProvider whitelists the configured cidrs
+type IpProvider struct {
+	IpCidrs    []string
+	FromPort   *int64
+	ToPort     *int64
+	IpProtocol string
+}
+
+// Init initializes the IpProvider Configuration like the cidrs to whitelist
+func (i *IpProvider) Init(params map[string]interface{}) error {
+	err := mapstructure.WeakDecode(params, i) //Converts the params to IpProvider struct fields
+	if err != nil {
+		return err
+	}
+
+	if len(i.IpCidrs) == 0 {
+		return errors.New("Missing Example IpCidrs")
+	}
+	if i.FromPort == nil || i.ToPort == nil || i.IpProtocol == "" {
+		return errors.New("Missing Example From Port, To Port or Ip Protocol")
+	}
+	return nil
+}
+
+// GetIPPermissions - Get List of IP addresses to whitelist
+func (i *IpProvider) GetIPPermissions() ([]plugin.IpPermission, error) {
+	ipPermission := plugin.IpPermission{FromPort: *i.FromPort, ToPort: *i.ToPort, IpProtocol: i.IpProtocol}
+	for _, ipCidr := range i.IpCidrs {
+		ipPermission.IpRanges = append(ipPermission.IpRanges, plugin.IpRange{IpCidr: ipCidr, Description: "example"})
+	}
+	return []plugin.IpPermission{ipPermission}, nil
+}
+
+// Provider writes the ip permissions to whitelist to a file
+type Provider struct {
+	Path string
+}
+
+// Init initializes the Provider Configuration like the path of the file
+func (p *Provider) Init(params map[string]interface{}) error {
+	err := mapstructure.WeakDecode(params, p) //Converts the params to Provider struct fields
+	if err != nil {
+		return err
+	}
+
+	if p.Path == "" {
+		return errors.New("Missing Example Path")
+	}
+	return nil
+}
+
+// WhiteListIps writes the ip permissions to the file
+func (p *Provider) WhiteListIps(filter plugin.Filter, ipPermissions []plugin.IpPermission) ([]string, error) {
+	source, err := json.MarshalIndent(plugin.WhiteListIpsParams{Filter: filter, IpPermissions: ipPermissions}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(p.Path, source, 0644); err != nil {
+		return nil, err
+	}
+	logrus.Infof("Wrote %d ip permissions to %s", len(ipPermissions), p.Path)
+	return []string{p.Path}, nil
+}
+
+func main() {
+	if err := plugin.Serve("Example", &IpProvider{}, &Provider{}); err != nil {
+		logrus.Errorf("%v", err)
+		os.Exit(1)
+	}
+}
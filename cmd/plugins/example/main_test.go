@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	testUtils "github.com/stakater/Whitelister/internal/pkg/test/utils"
+	"github.com/stakater/Whitelister/pkg/plugin"
+	"github.com/stakater/Whitelister/pkg/plugin/conformance"
+)
+
+// TestMain runs the test binary as the plugin when it is started by the conformance tests
+func TestMain(m *testing.M) {
+	if os.Getenv("WHITELISTER_EXAMPLE_PLUGIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestConformance(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "whitelister-example-plugin-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testUtils.DeleteDir(tmpDir)
+
+	os.Setenv("WHITELISTER_EXAMPLE_PLUGIN", "1")
+	defer os.Unsetenv("WHITELISTER_EXAMPLE_PLUGIN")
+
+	conformance.Run(t, conformance.Config{
+		Path: os.Args[0],
+		IpProviderParams: map[string]interface{}{
+			"IpCidrs": []string{"10.0.0.0/16"}, "FromPort": 22, "ToPort": 22, "IpProtocol": "tcp",
+		},
+		ProviderParams: map[string]interface{}{"Path": filepath.Join(tmpDir, "whitelist.json")},
+		Filter:         plugin.Filter{FilterType: "SecurityGroup", LabelName: "whitelister", LabelValue: "true"},
+	})
+}
@@ -28,11 +28,17 @@ type Provider struct {
 	Params map[interface{}]interface{} `yaml:"params"`
 }
 
-// Filter that will be used to filter resources on the provider
+// Filter that will be used to filter resources on the provider. Security groups can also be filtered by
+// ids, names, tags, tag keys and vpc, a security group has to match all of them
 type Filter struct {
-	FilterType FilterType `yaml:"filterType"`
-	LabelName  string     `yaml:"labelName"`
-	LabelValue string     `yaml:"labelValue"`
+	FilterType FilterType        `yaml:"filterType"`
+	LabelName  string            `yaml:"labelName"`
+	LabelValue string            `yaml:"labelValue"`
+	GroupIds   []string          `yaml:"groupIds"`
+	GroupNames []string          `yaml:"groupNames"`
+	Tags       map[string]string `yaml:"tags"`
+	TagKeys    []string          `yaml:"tagKeys"`
+	VpcId      string            `yaml:"vpcId"`
 }
 
 // ReadConfig function that reads the yaml file
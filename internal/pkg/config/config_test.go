@@ -85,6 +85,71 @@ func TestReadConfig(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "TestingWithCorrectValuesForNetworkAclFilter",
+			args: args{filePath: configFilePath + "correctAwsGitConfigWithNetworkAcl.yaml"},
+			want: Config{
+				SyncInterval: "10s",
+				IpProviders: []IpProvider{
+					{
+						Name: "git",
+						Params: map[interface{}]interface{}{
+							"AccessToken": "access-token",
+							"URL":         "http://github.com/stakater/whitelister-config.git",
+							"Config":      "config.yaml",
+						},
+					},
+				},
+				Provider: Provider{
+					Name: "aws",
+					Params: map[interface{}]interface{}{
+						"Region":              "us-west-2",
+						"RemoveRule":          true,
+						"NetworkAclRuleStart": 1,
+						"NetworkAclRuleEnd":   99,
+					},
+				},
+				Filter: Filter{
+					FilterType: NetworkAcl,
+					LabelName:  "whitelister",
+					LabelValue: "true",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "TestingWithSecurityGroupFilters",
+			args: args{filePath: configFilePath + "correctAwsGitConfigWithSGFilters.yaml"},
+			want: Config{
+				SyncInterval: "10s",
+				IpProviders: []IpProvider{
+					{
+						Name: "git",
+						Params: map[interface{}]interface{}{
+							"AccessToken": "access-token",
+							"URL":         "http://github.com/stakater/whitelister-config.git",
+							"Config":      "config.yaml",
+						},
+					},
+				},
+				Provider: Provider{
+					Name: "aws",
+					Params: map[interface{}]interface{}{
+						"Region":     "us-west-2",
+						"RemoveRule": true,
+					},
+				},
+				Filter: Filter{
+					FilterType: SecurityGroup,
+					GroupIds:   []string{"sg-0123456789abcdef0"},
+					GroupNames: []string{"web"},
+					Tags:       map[string]string{"team": "payments", "env": "production"},
+					TagKeys:    []string{"whitelister"},
+					VpcId:      "vpc-0123456789abcdef0",
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name:     "TestingWithIncorrectFilterType",
 			args:     args{filePath: configFilePath + "configWithIncorrectFilterType.yaml"},
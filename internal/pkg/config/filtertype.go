@@ -7,18 +7,21 @@ type FilterType int
 const (
 	LoadBalancer FilterType = iota
 	SecurityGroup
+	NetworkAcl
 )
 
 var loadBalancerStr = "LoadBalancer"
 var securityGroupStr = "SecurityGroup"
+var networkAclStr = "NetworkAcl"
 
 func (filterType FilterType) String() string {
 	filterTypes := [...]string{
 		loadBalancerStr,
 		securityGroupStr,
+		networkAclStr,
 	}
 
-	if filterType < LoadBalancer || filterType > SecurityGroup {
+	if filterType < LoadBalancer || filterType > NetworkAcl {
 		return "Unknown"
 	}
 
@@ -33,6 +36,9 @@ func toFilterType(filterTypeStr string) (filterType FilterType, err error) {
 	case securityGroupStr:
 		filterType = SecurityGroup
 
+	case networkAclStr:
+		filterType = NetworkAcl
+
 	default:
 		err = fmt.Errorf("incorrect FilterType :%s provided", filterTypeStr)
 	}
@@ -41,6 +41,7 @@ func NewController(clientset clientset.Interface, config config.Config) (*Contro
 
 //Run function for controller which handles the logic
 func (c *Controller) Run() {
+	changed := c.watchIpProviders()
 	for {
 		c.handleTasks()
 		timeInterval := c.config.SyncInterval
@@ -49,8 +50,28 @@ func (c *Controller) Run() {
 			logrus.Infof("Error Parsing Time Interval: %v", err)
 			return
 		}
-		time.Sleep(duration)
+		select {
+		case <-time.After(duration):
+		case <-changed:
+			logrus.Infof("Ip provider source changed, reconciling")
+		}
+	}
+}
+
+// watchIpProviders starts watching the sources of all ip providers that support it, the returned
+// channel receives when any of them changes
+func (c *Controller) watchIpProviders() <-chan struct{} {
+	// Buffered so that changes during a reconcile trigger a single reconcile afterwards
+	changed := make(chan struct{}, 1)
+	for _, ipProvider := range c.ipProviders {
+		if watcher, ok := ipProvider.(ipProviders.Watcher); ok {
+			err := watcher.Watch(changed)
+			if err != nil {
+				logrus.Errorf("Unable to watch ip provider %s, relying on sync interval : %v", ipProvider.GetName(), err)
+			}
+		}
 	}
+	return changed
 }
 
 func (c *Controller) handleTasks() {
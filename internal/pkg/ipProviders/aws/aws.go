@@ -0,0 +1,248 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+	awsClient "github.com/stakater/Whitelister/pkg/aws"
+)
+
+// Aws Ip provider class implementing the IpProvider interface, it whitelists the public ips of
+// EC2 instances, Elastic IPs and NAT gateways
+type Aws struct {
+	awsClient.Options `mapstructure:",squash"`
+	Region            string
+	InstanceTags      map[string]string
+	ElasticIpTags     map[string]string
+	NatGatewayVpcIds  []string
+	FromPort          *int64
+	ToPort            *int64
+	IpProtocol        *string
+	client            ec2iface.EC2API
+}
+
+// publicIp is a discovered public ip with the resource it belongs to
+type publicIp struct {
+	ip          string
+	description string
+}
+
+// GetName returns the name of IP Provider
+func (a *Aws) GetName() string {
+	return "Amazon Web Services"
+}
+
+// Init initializes the Aws Configuration like the role to assume and the resources to discover
+func (a *Aws) Init(params map[interface{}]interface{}) error {
+	err := mapstructure.Decode(params, a) //Converts the params to aws struct fields
+	if err != nil {
+		return err
+	}
+
+	if a.Region == "" {
+		return errors.New("Missing Aws Region")
+	}
+	if err := a.Options.Validate(); err != nil {
+		return err
+	}
+	if a.InstanceTags == nil && a.ElasticIpTags == nil && len(a.NatGatewayVpcIds) == 0 {
+		return errors.New("Missing Aws InstanceTags, ElasticIpTags or NatGatewayVpcIds")
+	}
+	if a.FromPort == nil {
+		return errors.New("Missing Aws From Port")
+	}
+	if a.ToPort == nil {
+		return errors.New("Missing Aws To Port")
+	}
+	if a.IpProtocol == nil || *a.IpProtocol == "" {
+		return errors.New("Missing Aws Ip Protocol")
+	}
+	return nil
+}
+
+// GetIPPermissions - Get List of IP addresses to whitelist
+func (a *Aws) GetIPPermissions() ([]utils.IpPermission, error) {
+	// The client is reused by later syncs and refreshes the credentials of the assumed role
+	if a.client == nil {
+		awsSession, roleCredentials, err := a.Options.GetSession(a.Region)
+		if err != nil {
+			return nil, err
+		}
+		a.client = ec2.New(awsSession, a.Options.GetEc2Config(roleCredentials, a.Region))
+	}
+	return a.getPublicIPPermissions(a.client)
+}
+
+func (a *Aws) getPublicIPPermissions(client ec2iface.EC2API) ([]utils.IpPermission, error) {
+	var publicIps []publicIp
+	if a.InstanceTags != nil {
+		instanceIps, err := a.getInstanceIps(client)
+		if err != nil {
+			return nil, err
+		}
+		publicIps = append(publicIps, instanceIps...)
+	}
+	if a.ElasticIpTags != nil {
+		elasticIps, err := a.getElasticIps(client)
+		if err != nil {
+			return nil, err
+		}
+		publicIps = append(publicIps, elasticIps...)
+	}
+	if len(a.NatGatewayVpcIds) > 0 {
+		natGatewayIps, err := a.getNatGatewayIps(client)
+		if err != nil {
+			return nil, err
+		}
+		publicIps = append(publicIps, natGatewayIps...)
+	}
+
+	var ipRanges []*utils.IpRange
+	seen := map[string]bool{}
+	for _, publicIp := range publicIps {
+		// An Elastic IP associated with an instance is discovered twice
+		if seen[publicIp.ip] {
+			continue
+		}
+		seen[publicIp.ip] = true
+		ipCidr := publicIp.ip + "/32"
+		description := publicIp.description
+		ipRanges = append(ipRanges, &utils.IpRange{
+			IpCidr:      &ipCidr,
+			Description: &description,
+		})
+	}
+	logrus.Infof("Discovered %d public ips in %s", len(ipRanges), a.Region)
+
+	if len(ipRanges) == 0 {
+		return nil, nil
+	}
+	return []utils.IpPermission{
+		{
+			IpRanges:   ipRanges,
+			FromPort:   a.FromPort,
+			ToPort:     a.ToPort,
+			IpProtocol: a.IpProtocol,
+		},
+	}, nil
+}
+
+func (a *Aws) getInstanceIps(client ec2iface.EC2API) ([]publicIp, error) {
+	filters := append(getTagFilters(a.InstanceTags), &ec2.Filter{
+		Name:   aws.String("instance-state-name"),
+		Values: aws.StringSlice([]string{ec2.InstanceStateNameRunning}),
+	})
+
+	var publicIps []publicIp
+	err := client.DescribeInstancesPages(&ec2.DescribeInstancesInput{Filters: filters},
+		func(output *ec2.DescribeInstancesOutput, lastPage bool) bool {
+			for _, reservation := range output.Reservations {
+				for _, instance := range reservation.Instances {
+					if instance.PublicIpAddress == nil {
+						continue
+					}
+					publicIps = append(publicIps, publicIp{
+						ip:          *instance.PublicIpAddress,
+						description: describe(*instance.InstanceId, instance.Tags),
+					})
+				}
+			}
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to describe instances : %v", err)
+	}
+	return publicIps, nil
+}
+
+func (a *Aws) getElasticIps(client ec2iface.EC2API) ([]publicIp, error) {
+	output, err := client.DescribeAddresses(&ec2.DescribeAddressesInput{Filters: getTagFilters(a.ElasticIpTags)})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to describe addresses : %v", err)
+	}
+
+	var publicIps []publicIp
+	for _, address := range output.Addresses {
+		if address.PublicIp == nil {
+			continue
+		}
+		id := *address.PublicIp
+		if address.AllocationId != nil {
+			id = *address.AllocationId
+		}
+		publicIps = append(publicIps, publicIp{ip: *address.PublicIp, description: describe(id, address.Tags)})
+	}
+	return publicIps, nil
+}
+
+func (a *Aws) getNatGatewayIps(client ec2iface.EC2API) ([]publicIp, error) {
+	input := &ec2.DescribeNatGatewaysInput{
+		Filter: []*ec2.Filter{
+			{
+				Name:   aws.String("vpc-id"),
+				Values: aws.StringSlice(a.NatGatewayVpcIds),
+			},
+			{
+				Name:   aws.String("state"),
+				Values: aws.StringSlice([]string{ec2.NatGatewayStateAvailable}),
+			},
+		},
+	}
+
+	var publicIps []publicIp
+	err := client.DescribeNatGatewaysPages(input, func(output *ec2.DescribeNatGatewaysOutput, lastPage bool) bool {
+		for _, natGateway := range output.NatGateways {
+			for _, address := range natGateway.NatGatewayAddresses {
+				if address.PublicIp == nil {
+					continue
+				}
+				publicIps = append(publicIps, publicIp{
+					ip:          *address.PublicIp,
+					description: describe(*natGateway.NatGatewayId, natGateway.Tags),
+				})
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to describe nat gateways : %v", err)
+	}
+	return publicIps, nil
+}
+
+// getTagFilters returns a filter for every tag, an empty value matches any value of the tag key
+func getTagFilters(tags map[string]string) []*ec2.Filter {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var filters []*ec2.Filter
+	for _, key := range keys {
+		if tags[key] == "" {
+			filters = append(filters, &ec2.Filter{Name: aws.String("tag-key"), Values: aws.StringSlice([]string{key})})
+			continue
+		}
+		filters = append(filters, &ec2.Filter{Name: aws.String("tag:" + key), Values: aws.StringSlice([]string{tags[key]})})
+	}
+	return filters
+}
+
+// describe returns the id of a resource followed by its Name tag, if it has one
+func describe(id string, tags []*ec2.Tag) string {
+	for _, tag := range tags {
+		if tag.Key != nil && *tag.Key == "Name" && tag.Value != nil && *tag.Value != "" {
+			return fmt.Sprintf("%s (%s)", id, *tag.Value)
+		}
+	}
+	return id
+}
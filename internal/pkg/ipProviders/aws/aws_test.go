@@ -0,0 +1,181 @@
+package aws
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+var (
+	roleArn    = "arn:aws:iam::111111111111:role/whitelister"
+	region     = "us-west-2"
+	fromPort   = 443
+	toPort     = 443
+	ipProtocol = "tcp"
+)
+
+// fakeEc2 returns fixed instances, addresses and nat gateways and records the filters it was called with
+type fakeEc2 struct {
+	ec2iface.EC2API
+	filters map[string][]*ec2.Filter
+}
+
+func (f *fakeEc2) DescribeInstancesPages(input *ec2.DescribeInstancesInput,
+	fn func(*ec2.DescribeInstancesOutput, bool) bool) error {
+	f.filters["instances"] = input.Filters
+	fn(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: []*ec2.Instance{
+		{InstanceId: aws.String("i-1"), PublicIpAddress: aws.String("203.0.113.1"),
+			Tags: []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("ci-runner")}}},
+		{InstanceId: aws.String("i-2")},
+	}}}}, false)
+	fn(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: []*ec2.Instance{
+		{InstanceId: aws.String("i-3"), PublicIpAddress: aws.String("203.0.113.3")},
+	}}}}, true)
+	return nil
+}
+
+func (f *fakeEc2) DescribeAddresses(input *ec2.DescribeAddressesInput) (*ec2.DescribeAddressesOutput, error) {
+	f.filters["addresses"] = input.Filters
+	return &ec2.DescribeAddressesOutput{Addresses: []*ec2.Address{
+		{AllocationId: aws.String("eipalloc-1"), PublicIp: aws.String("203.0.113.1")},
+		{AllocationId: aws.String("eipalloc-2"), PublicIp: aws.String("198.51.100.2")},
+	}}, nil
+}
+
+func (f *fakeEc2) DescribeNatGatewaysPages(input *ec2.DescribeNatGatewaysInput,
+	fn func(*ec2.DescribeNatGatewaysOutput, bool) bool) error {
+	f.filters["natGateways"] = input.Filter
+	fn(&ec2.DescribeNatGatewaysOutput{NatGateways: []*ec2.NatGateway{
+		{NatGatewayId: aws.String("nat-1"), NatGatewayAddresses: []*ec2.NatGatewayAddress{
+			{PublicIp: aws.String("192.0.2.1")},
+		}},
+	}}, true)
+	return nil
+}
+
+func TestAwsInit(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   map[interface{}]interface{}
+		wantErr  bool
+		errValue error
+	}{
+		{
+			name: "Init with instance tags",
+			params: map[interface{}]interface{}{
+				"RoleArn": roleArn, "Region": region, "InstanceTags": map[string]string{"team": "ci"},
+				"FromPort": fromPort, "ToPort": toPort, "IpProtocol": ipProtocol,
+			},
+		},
+		{
+			name: "Init without role",
+			params: map[interface{}]interface{}{
+				"Region": region, "InstanceTags": map[string]string{"team": "ci"},
+				"FromPort": fromPort, "ToPort": toPort, "IpProtocol": ipProtocol,
+			},
+		},
+		{
+			name: "Init without region",
+			params: map[interface{}]interface{}{
+				"RoleArn": roleArn, "InstanceTags": map[string]string{"team": "ci"},
+				"FromPort": fromPort, "ToPort": toPort, "IpProtocol": ipProtocol,
+			},
+			wantErr:  true,
+			errValue: errors.New("Missing Aws Region"),
+		},
+		{
+			name: "Init with external id without role",
+			params: map[interface{}]interface{}{
+				"Region": region, "ExternalID": "whitelister", "InstanceTags": map[string]string{"team": "ci"},
+				"FromPort": fromPort, "ToPort": toPort, "IpProtocol": ipProtocol,
+			},
+			wantErr:  true,
+			errValue: errors.New("Missing Aws RoleArn to assume with ExternalID, SessionName, SessionDuration or WebIdentityTokenFile"),
+		},
+		{
+			name: "Init without sources",
+			params: map[interface{}]interface{}{
+				"RoleArn": roleArn, "Region": region, "FromPort": fromPort, "ToPort": toPort, "IpProtocol": ipProtocol,
+			},
+			wantErr:  true,
+			errValue: errors.New("Missing Aws InstanceTags, ElasticIpTags or NatGatewayVpcIds"),
+		},
+		{
+			name: "Init without protocol",
+			params: map[interface{}]interface{}{
+				"RoleArn": roleArn, "Region": region, "NatGatewayVpcIds": []string{"vpc-1"},
+				"FromPort": fromPort, "ToPort": toPort,
+			},
+			wantErr:  true,
+			errValue: errors.New("Missing Aws Ip Protocol"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Aws{}
+			err := a.Init(tt.params)
+			if tt.wantErr {
+				if err == nil || err.Error() != tt.errValue.Error() {
+					t.Errorf("Aws.Init() Got Err: %v, Wanted Err: %v", err, tt.errValue)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Aws.Init() Got Err: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetPublicIPPermissions(t *testing.T) {
+	a := &Aws{}
+	err := a.Init(map[interface{}]interface{}{
+		"RoleArn": roleArn, "Region": region,
+		"InstanceTags":     map[string]string{"team": "ci", "autoscaling": ""},
+		"ElasticIpTags":    map[string]string{},
+		"NatGatewayVpcIds": []string{"vpc-1"},
+		"FromPort":         fromPort, "ToPort": toPort, "IpProtocol": ipProtocol,
+	})
+	if err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+
+	client := &fakeEc2{filters: map[string][]*ec2.Filter{}}
+	got, err := a.getPublicIPPermissions(client)
+	if err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+
+	gotRanges := map[string]string{}
+	for _, ipRange := range got[0].IpRanges {
+		gotRanges[*ipRange.IpCidr] = *ipRange.Description
+	}
+	wantRanges := map[string]string{
+		"203.0.113.1/32":  "i-1 (ci-runner)",
+		"203.0.113.3/32":  "i-3",
+		"198.51.100.2/32": "eipalloc-2",
+		"192.0.2.1/32":    "nat-1",
+	}
+	if !reflect.DeepEqual(gotRanges, wantRanges) {
+		t.Errorf("Got = %v, wanted %v", gotRanges, wantRanges)
+	}
+
+	wantInstanceFilters := []*ec2.Filter{
+		{Name: aws.String("tag-key"), Values: aws.StringSlice([]string{"autoscaling"})},
+		{Name: aws.String("tag:team"), Values: aws.StringSlice([]string{"ci"})},
+		{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"running"})},
+	}
+	if !reflect.DeepEqual(client.filters["instances"], wantInstanceFilters) {
+		t.Errorf("Got instance filters = %v, wanted %v", client.filters["instances"], wantInstanceFilters)
+	}
+	if len(client.filters["addresses"]) != 0 {
+		t.Errorf("Got address filters = %v, wanted none", client.filters["addresses"])
+	}
+	if *client.filters["natGateways"][0].Values[0] != "vpc-1" {
+		t.Errorf("Got nat gateway filters = %v, wanted vpc-1", client.filters["natGateways"])
+	}
+}
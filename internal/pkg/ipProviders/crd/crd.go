@@ -0,0 +1,208 @@
+package crd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+	"github.com/stakater/Whitelister/pkg/apis/whitelister/v1alpha1"
+	"github.com/stakater/Whitelister/pkg/kube"
+)
+
+// Crd Ip provider class implementing the IpProvider interface. It aggregates
+// all WhitelistEntry resources in the cluster
+type Crd struct {
+	Namespace     string
+	LabelSelector string
+	client        dynamic.Interface
+	entries       []*entry
+}
+
+// entry keeps a WhitelistEntry read during the last sync along with the reason it was rejected, if any
+type entry struct {
+	object         *unstructured.Unstructured
+	rejectedReason string
+}
+
+// GetName returns the name of IP Provider
+func (c *Crd) GetName() string {
+	return "WhitelistEntry"
+}
+
+// Init initializes the Crd Configuration like namespace and label selector
+func (c *Crd) Init(params map[interface{}]interface{}) error {
+	//Converts the params to Crd struct fields, all of them are optional
+	return mapstructure.Decode(params, c)
+}
+
+// GetIPPermissions - Get List of IP addresses to whitelist
+func (c *Crd) GetIPPermissions() ([]utils.IpPermission, error) {
+	if c.client == nil {
+		client, err := kube.GetDynamicClient()
+		if err != nil {
+			return nil, err
+		}
+		c.client = client
+	}
+	return c.getEntriesIPPermissions()
+}
+
+func (c *Crd) getEntriesIPPermissions() ([]utils.IpPermission, error) {
+	// Entries of an earlier sync must not get the status of this one if listing fails
+	c.entries = nil
+	list, err := c.client.Resource(v1alpha1.WhitelistEntryResource).Namespace(c.Namespace).
+		List(context.TODO(), metaV1.ListOptions{LabelSelector: c.LabelSelector})
+	if err != nil {
+		return nil, err
+	}
+
+	var ipPermissions []utils.IpPermission
+
+	for i := range list.Items {
+		object := &list.Items[i]
+		var whitelistEntry v1alpha1.WhitelistEntry
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.UnstructuredContent(), &whitelistEntry)
+		if err != nil {
+			c.entries = append(c.entries, &entry{object: object, rejectedReason: err.Error()})
+			continue
+		}
+
+		ipPermission, err := toIpPermission(whitelistEntry, time.Now())
+		if err != nil {
+			logrus.Errorf("Rejecting WhitelistEntry %s/%s: %v", object.GetNamespace(), object.GetName(), err)
+			c.entries = append(c.entries, &entry{object: object, rejectedReason: err.Error()})
+			continue
+		}
+		c.entries = append(c.entries, &entry{object: object})
+		ipPermissions = utils.CombineIpPermission(ipPermissions, []utils.IpPermission{ipPermission})
+	}
+	return ipPermissions, nil
+}
+
+// toIpPermission validates a WhitelistEntry and converts its spec to an IpPermission
+func toIpPermission(whitelistEntry v1alpha1.WhitelistEntry, now time.Time) (utils.IpPermission, error) {
+	spec := whitelistEntry.Spec
+	if spec.Expiry != nil && !spec.Expiry.Time.After(now) {
+		return utils.IpPermission{}, fmt.Errorf("Expired at %s", spec.Expiry.Time.Format(time.RFC3339))
+	}
+	if spec.FromPort == nil {
+		return utils.IpPermission{}, errors.New("Missing From Port")
+	}
+	if spec.ToPort == nil {
+		return utils.IpPermission{}, errors.New("Missing To Port")
+	}
+	if spec.IpProtocol == nil || *spec.IpProtocol == "" {
+		return utils.IpPermission{}, errors.New("Missing Ip Protocol")
+	}
+	if len(spec.IpRanges) == 0 {
+		return utils.IpPermission{}, errors.New("Missing Ip Ranges")
+	}
+
+	var ipRanges []*utils.IpRange
+	for _, ipRange := range spec.IpRanges {
+		if ipRange.IpCidr == nil {
+			return utils.IpPermission{}, errors.New("Missing Ip Cidr")
+		}
+		if _, _, err := net.ParseCIDR(*ipRange.IpCidr); err != nil {
+			return utils.IpPermission{}, fmt.Errorf("Invalid Ip Cidr %s", *ipRange.IpCidr)
+		}
+		description := getDescription(whitelistEntry, ipRange)
+		ipRanges = append(ipRanges, &utils.IpRange{
+			IpCidr:      ipRange.IpCidr,
+			Description: &description,
+		})
+	}
+
+	return utils.IpPermission{
+		IpRanges:   ipRanges,
+		FromPort:   spec.FromPort,
+		ToPort:     spec.ToPort,
+		IpProtocol: spec.IpProtocol,
+	}, nil
+}
+
+// getDescription falls back to the owner, or the resource name, when an ip range has no description
+func getDescription(whitelistEntry v1alpha1.WhitelistEntry, ipRange v1alpha1.IpRange) string {
+	if ipRange.Description != nil && *ipRange.Description != "" {
+		return *ipRange.Description
+	}
+	if whitelistEntry.Spec.Owner != "" {
+		return whitelistEntry.Spec.Owner
+	}
+	return whitelistEntry.Namespace + "/" + whitelistEntry.Name
+}
+
+// WriteStatus writes the outcome of the last reconcile on every WhitelistEntry read during the last sync.
+// Entries whose status did not change are left alone, so that syncs do not update every entry
+func (c *Crd) WriteStatus(targetGroups []string, err error) {
+	now := metaV1.Now()
+	// Providers update their targets concurrently, so the order of the target groups changes between syncs
+	sortedTargetGroups := append([]string{}, targetGroups...)
+	sort.Strings(sortedTargetGroups)
+	for _, entry := range c.entries {
+		status := v1alpha1.WhitelistEntryStatus{
+			ObservedGeneration: entry.object.GetGeneration(),
+			LastReconcileTime:  &now,
+		}
+		if entry.rejectedReason != "" {
+			status.Phase = v1alpha1.PhaseRejected
+			status.Reason = entry.rejectedReason
+		} else if err != nil {
+			status.Phase = v1alpha1.PhaseFailed
+			status.Reason = err.Error()
+		} else {
+			status.Phase = v1alpha1.PhaseApplied
+			status.TargetGroups = sortedTargetGroups
+		}
+		if isStatusCurrent(entry.object, status) {
+			continue
+		}
+
+		statusErr := c.updateStatus(entry.object, status)
+		if statusErr != nil {
+			logrus.Errorf("Error updating status of WhitelistEntry %s/%s: %v",
+				entry.object.GetNamespace(), entry.object.GetName(), statusErr)
+		}
+	}
+}
+
+// isStatusCurrent returns true if the WhitelistEntry already has the status, apart from the reconcile time
+func isStatusCurrent(object *unstructured.Unstructured, status v1alpha1.WhitelistEntryStatus) bool {
+	content, found, err := unstructured.NestedMap(object.Object, "status")
+	if err != nil || !found {
+		return false
+	}
+	var current v1alpha1.WhitelistEntryStatus
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, &current); err != nil {
+		return false
+	}
+	return current.Phase == status.Phase && current.Reason == status.Reason &&
+		current.ObservedGeneration == status.ObservedGeneration &&
+		strings.Join(current.TargetGroups, ",") == strings.Join(status.TargetGroups, ",")
+}
+
+func (c *Crd) updateStatus(object *unstructured.Unstructured, status v1alpha1.WhitelistEntryStatus) error {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+	err = unstructured.SetNestedField(object.Object, content, "status")
+	if err != nil {
+		return err
+	}
+	_, err = c.client.Resource(v1alpha1.WhitelistEntryResource).Namespace(object.GetNamespace()).
+		UpdateStatus(context.TODO(), object, metaV1.UpdateOptions{})
+	return err
+}
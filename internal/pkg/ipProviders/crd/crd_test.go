@@ -0,0 +1,291 @@
+package crd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+	"github.com/stakater/Whitelister/pkg/apis/whitelister/v1alpha1"
+)
+
+var (
+	ipCidr      = "127.0.0.1/32"
+	description = "Sample address"
+	owner       = "john.doe"
+	fromPort    = int64(80)
+	toPort      = int64(80)
+	ipProtocol  = "tcp"
+)
+
+func whitelistEntry(t *testing.T, name string, spec v1alpha1.WhitelistEntrySpec) *unstructured.Unstructured {
+	entry := v1alpha1.WhitelistEntry{
+		TypeMeta: metaV1.TypeMeta{
+			APIVersion: v1alpha1.GroupName + "/" + v1alpha1.Version,
+			Kind:       v1alpha1.WhitelistEntryKind,
+		},
+		ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       spec,
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &unstructured.Unstructured{Object: content}
+}
+
+func TestCrdInit(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[interface{}]interface{}
+		want Crd
+	}{
+		{
+			name: "Empty Config",
+			args: nil,
+			want: Crd{},
+		},
+		{
+			name: "Namespace and Label Selector",
+			args: map[interface{}]interface{}{
+				"Namespace":     "default",
+				"LabelSelector": "team=dev",
+			},
+			want: Crd{Namespace: "default", LabelSelector: "team=dev"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &Crd{}
+			err := got.Init(tt.args)
+			if err != nil {
+				t.Errorf("Got Err: %v", err)
+				return
+			}
+			if got.Namespace != tt.want.Namespace || got.LabelSelector != tt.want.LabelSelector {
+				t.Errorf("Got = %v, wanted %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToIpPermission(t *testing.T) {
+	now := time.Now()
+	past := metaV1.NewTime(now.Add(-time.Hour))
+	future := metaV1.NewTime(now.Add(time.Hour))
+	invalidCidr := "127.0.0.1"
+	entryName := "default/entry"
+
+	tests := []struct {
+		name     string
+		args     v1alpha1.WhitelistEntrySpec
+		want     utils.IpPermission
+		wantErr  bool
+		errValue error
+	}{
+		{
+			name: "Valid entry",
+			args: v1alpha1.WhitelistEntrySpec{
+				IpRanges:   []v1alpha1.IpRange{{IpCidr: &ipCidr, Description: &description}},
+				FromPort:   &fromPort,
+				ToPort:     &toPort,
+				IpProtocol: &ipProtocol,
+				Expiry:     &future,
+			},
+			want: utils.IpPermission{
+				IpRanges:   []*utils.IpRange{{IpCidr: &ipCidr, Description: &description}},
+				FromPort:   &fromPort,
+				ToPort:     &toPort,
+				IpProtocol: &ipProtocol,
+			},
+		},
+		{
+			name: "Description defaults to owner",
+			args: v1alpha1.WhitelistEntrySpec{
+				IpRanges:   []v1alpha1.IpRange{{IpCidr: &ipCidr}},
+				FromPort:   &fromPort,
+				ToPort:     &toPort,
+				IpProtocol: &ipProtocol,
+				Owner:      owner,
+			},
+			want: utils.IpPermission{
+				IpRanges:   []*utils.IpRange{{IpCidr: &ipCidr, Description: &owner}},
+				FromPort:   &fromPort,
+				ToPort:     &toPort,
+				IpProtocol: &ipProtocol,
+			},
+		},
+		{
+			name: "Description defaults to resource name",
+			args: v1alpha1.WhitelistEntrySpec{
+				IpRanges:   []v1alpha1.IpRange{{IpCidr: &ipCidr}},
+				FromPort:   &fromPort,
+				ToPort:     &toPort,
+				IpProtocol: &ipProtocol,
+			},
+			want: utils.IpPermission{
+				IpRanges:   []*utils.IpRange{{IpCidr: &ipCidr, Description: &entryName}},
+				FromPort:   &fromPort,
+				ToPort:     &toPort,
+				IpProtocol: &ipProtocol,
+			},
+		},
+		{
+			name: "Expired entry",
+			args: v1alpha1.WhitelistEntrySpec{
+				IpRanges:   []v1alpha1.IpRange{{IpCidr: &ipCidr}},
+				FromPort:   &fromPort,
+				ToPort:     &toPort,
+				IpProtocol: &ipProtocol,
+				Expiry:     &past,
+			},
+			wantErr:  true,
+			errValue: errors.New("Expired at " + past.Time.Format(time.RFC3339)),
+		},
+		{
+			name: "Missing From Port",
+			args: v1alpha1.WhitelistEntrySpec{
+				IpRanges:   []v1alpha1.IpRange{{IpCidr: &ipCidr}},
+				ToPort:     &toPort,
+				IpProtocol: &ipProtocol,
+			},
+			wantErr:  true,
+			errValue: errors.New("Missing From Port"),
+		},
+		{
+			name: "Invalid Cidr",
+			args: v1alpha1.WhitelistEntrySpec{
+				IpRanges:   []v1alpha1.IpRange{{IpCidr: &invalidCidr}},
+				FromPort:   &fromPort,
+				ToPort:     &toPort,
+				IpProtocol: &ipProtocol,
+			},
+			wantErr:  true,
+			errValue: errors.New("Invalid Ip Cidr 127.0.0.1"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := v1alpha1.WhitelistEntry{
+				ObjectMeta: metaV1.ObjectMeta{Name: "entry", Namespace: "default"},
+				Spec:       tt.args,
+			}
+			got, err := toIpPermission(entry, now)
+
+			if tt.wantErr {
+				if err == nil || err.Error() != tt.errValue.Error() {
+					t.Errorf("Got Err: %v, Wanted Err: %v", err, tt.errValue)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Got Err: %v", err)
+				return
+			}
+			if !got.Equal(&tt.want) {
+				t.Errorf("Got = %v, wanted %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetEntriesIPPermissionsAndWriteStatus(t *testing.T) {
+	validEntry := whitelistEntry(t, "valid", v1alpha1.WhitelistEntrySpec{
+		IpRanges:   []v1alpha1.IpRange{{IpCidr: &ipCidr, Description: &description}},
+		FromPort:   &fromPort,
+		ToPort:     &toPort,
+		IpProtocol: &ipProtocol,
+		Owner:      owner,
+	})
+	invalidEntry := whitelistEntry(t, "invalid", v1alpha1.WhitelistEntrySpec{
+		IpRanges: []v1alpha1.IpRange{{IpCidr: &ipCidr}},
+	})
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), validEntry, invalidEntry)
+	crd := &Crd{client: client}
+
+	got, err := crd.getEntriesIPPermissions()
+	if err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+	want := utils.IpPermission{
+		IpRanges:   []*utils.IpRange{{IpCidr: &ipCidr, Description: &description}},
+		FromPort:   &fromPort,
+		ToPort:     &toPort,
+		IpProtocol: &ipProtocol,
+	}
+	if len(got) != 1 || !got[0].Equal(&want) {
+		t.Fatalf("Got = %v, wanted %v", got, want)
+	}
+
+	crd.WriteStatus([]string{"sg-2", "sg-1"}, nil)
+
+	tests := []struct {
+		name       string
+		wantPhase  string
+		wantReason string
+		wantGroups int
+	}{
+		{name: "valid", wantPhase: v1alpha1.PhaseApplied, wantGroups: 2},
+		{name: "invalid", wantPhase: v1alpha1.PhaseRejected, wantReason: "Missing From Port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object, err := client.Resource(v1alpha1.WhitelistEntryResource).Namespace("default").
+				Get(context.TODO(), tt.name, metaV1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			phase, _, _ := unstructured.NestedString(object.Object, "status", "phase")
+			reason, _, _ := unstructured.NestedString(object.Object, "status", "reason")
+			groups, _, _ := unstructured.NestedStringSlice(object.Object, "status", "targetGroups")
+			if phase != tt.wantPhase || reason != tt.wantReason || len(groups) != tt.wantGroups {
+				t.Errorf("Got phase: %s, reason: %s, target groups: %v", phase, reason, groups)
+			}
+		})
+	}
+
+	// A sync that changes nothing does not update the entries, whatever the order of the target groups
+	if _, err := crd.getEntriesIPPermissions(); err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+	updates := countStatusUpdates(client)
+	crd.WriteStatus([]string{"sg-1", "sg-2"}, nil)
+	if got := countStatusUpdates(client) - updates; got != 0 {
+		t.Errorf("Got %d status updates of unchanged entries, wanted none", got)
+	}
+	crd.WriteStatus(nil, errors.New("UnauthorizedOperation"))
+	if got := countStatusUpdates(client) - updates; got != 1 {
+		t.Errorf("Got %d status updates, wanted the valid entry to fail", got)
+	}
+
+	// A sync whose listing fails must not write the status of the earlier sync on its entries
+	client.PrependReactor("list", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+	if _, err := crd.getEntriesIPPermissions(); err == nil {
+		t.Fatalf("Got no Err, wanted the listing error")
+	}
+	if len(crd.entries) != 0 {
+		t.Errorf("Got %d entries of the earlier sync after listing failed", len(crd.entries))
+	}
+}
+
+func countStatusUpdates(client *fake.FakeDynamicClient) int {
+	updates := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" && action.GetSubresource() == "status" {
+			updates++
+		}
+	}
+	return updates
+}
@@ -0,0 +1,165 @@
+package dns
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+)
+
+var timeNow = time.Now
+
+// Dns Ip provider class implementing the IpProvider interface, it whitelists the addresses hostnames resolve to
+type Dns struct {
+	Hostnames   []string
+	Resolver    string
+	IPv6        bool
+	FollowCNAME *bool
+	MinTTL      string
+	FromPort    *int64
+	ToPort      *int64
+	IpProtocol  *string
+
+	resolver *resolver
+	minTTL   time.Duration
+	// expiries of the addresses resolved for each hostname, an address is kept until its ttl has
+	// expired since it was last resolved so that rotating round-robin answers do not flap rules
+	expiries map[string]map[string]time.Time
+}
+
+// GetName returns the name of IP Provider
+func (d *Dns) GetName() string {
+	return "DNS"
+}
+
+// Init initializes the Dns Configuration like hostnames and resolver
+func (d *Dns) Init(params map[interface{}]interface{}) error {
+	err := mapstructure.Decode(params, d) //Converts the params to dns struct fields
+	if err != nil {
+		return err
+	}
+
+	if len(d.Hostnames) == 0 {
+		return errors.New("Missing Dns Hostnames")
+	}
+	if d.FromPort == nil {
+		return errors.New("Missing Dns From Port")
+	}
+	if d.ToPort == nil {
+		return errors.New("Missing Dns To Port")
+	}
+	if d.IpProtocol == nil || *d.IpProtocol == "" {
+		return errors.New("Missing Dns Ip Protocol")
+	}
+	if d.MinTTL != "" {
+		d.minTTL, err = time.ParseDuration(d.MinTTL)
+		if err != nil {
+			return fmt.Errorf("Invalid Dns MinTTL %s : %v", d.MinTTL, err)
+		}
+	}
+
+	followCNAME := d.FollowCNAME == nil || *d.FollowCNAME
+	d.resolver, err = newResolver(d.Resolver, followCNAME)
+	if err != nil {
+		return err
+	}
+	d.expiries = map[string]map[string]time.Time{}
+	return nil
+}
+
+// GetIPPermissions - Get List of IP addresses to whitelist
+func (d *Dns) GetIPPermissions() ([]utils.IpPermission, error) {
+	now := timeNow()
+	for _, hostname := range d.Hostnames {
+		answers, err := d.lookup(hostname)
+		if err != nil {
+			// Addresses resolved before are kept until they expire
+			logrus.Errorf("Unable to resolve %s : %v", hostname, err)
+			continue
+		}
+		d.refresh(hostname, answers, now)
+	}
+
+	ipRanges := d.getIpRanges(now)
+	if len(ipRanges) == 0 {
+		return nil, fmt.Errorf("No addresses resolved for hostnames %v", d.Hostnames)
+	}
+	return []utils.IpPermission{
+		{
+			IpRanges:   ipRanges,
+			FromPort:   d.FromPort,
+			ToPort:     d.ToPort,
+			IpProtocol: d.IpProtocol,
+		},
+	}, nil
+}
+
+// lookup resolves a hostname, names starting with an underscore e.g. _sip._tcp.example.com are SRV records
+func (d *Dns) lookup(hostname string) ([]answer, error) {
+	if strings.HasPrefix(hostname, "_") {
+		return d.resolver.lookupSRV(hostname, d.IPv6)
+	}
+	return d.resolver.lookupHost(hostname, d.IPv6)
+}
+
+func (d *Dns) refresh(hostname string, answers []answer, now time.Time) {
+	expiries, ok := d.expiries[hostname]
+	if !ok {
+		expiries = map[string]time.Time{}
+		d.expiries[hostname] = expiries
+	}
+	for _, answer := range answers {
+		ttl := time.Duration(answer.ttl) * time.Second
+		if ttl < d.minTTL {
+			ttl = d.minTTL
+		}
+		expiry := now.Add(ttl)
+		if expiry.After(expiries[answer.ip.String()]) {
+			expiries[answer.ip.String()] = expiry
+		}
+	}
+}
+
+// getIpRanges returns the unexpired addresses, described by the hostnames they were resolved from
+func (d *Dns) getIpRanges(now time.Time) []*utils.IpRange {
+	hostnamesByIp := map[string][]string{}
+	var ips []net.IP
+	for _, hostname := range d.Hostnames {
+		for ip, expiry := range d.expiries[hostname] {
+			// An address that was just resolved with a ttl of 0 is still used for this sync
+			if expiry.Before(now) {
+				delete(d.expiries[hostname], ip)
+				continue
+			}
+			if _, ok := hostnamesByIp[ip]; !ok {
+				ips = append(ips, net.ParseIP(ip))
+			}
+			hostnamesByIp[ip] = append(hostnamesByIp[ip], hostname)
+		}
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		return bytes.Compare(ips[i].To16(), ips[j].To16()) < 0
+	})
+
+	var ipRanges []*utils.IpRange
+	for _, ip := range ips {
+		ipCidr := ip.String() + "/32"
+		if ip.To4() == nil {
+			ipCidr = ip.String() + "/128"
+		}
+		description := strings.Join(hostnamesByIp[ip.String()], ", ")
+		ipRanges = append(ipRanges, &utils.IpRange{
+			IpCidr:      &ipCidr,
+			Description: &description,
+		})
+	}
+	return ipRanges
+}
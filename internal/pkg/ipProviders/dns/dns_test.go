@@ -0,0 +1,302 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var (
+	fromPort   = 443
+	toPort     = 443
+	ipProtocol = "tcp"
+)
+
+// server is a fake recursive dns server answering from a list of records
+type server struct {
+	mutex   sync.Mutex
+	records []dnsmessage.Resource
+	// Answer only the first record of the CNAME chain, like a server that does not resolve recursively
+	partialChain bool
+}
+
+func newResource(name string, ttl uint32, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   body,
+	}
+}
+
+func aRecord(name string, ttl uint32, ip string) dnsmessage.Resource {
+	var a [4]byte
+	copy(a[:], net.ParseIP(ip).To4())
+	return newResource(name, ttl, &dnsmessage.AResource{A: a})
+}
+
+func aaaaRecord(name string, ttl uint32, ip string) dnsmessage.Resource {
+	var aaaa [16]byte
+	copy(aaaa[:], net.ParseIP(ip))
+	return newResource(name, ttl, &dnsmessage.AAAAResource{AAAA: aaaa})
+}
+
+func cnameRecord(name string, ttl uint32, target string) dnsmessage.Resource {
+	return newResource(name, ttl, &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(target)})
+}
+
+func srvRecord(name string, ttl uint32, target string) dnsmessage.Resource {
+	return newResource(name, ttl, &dnsmessage.SRVResource{Target: dnsmessage.MustNewName(target), Port: 5060})
+}
+
+func (s *server) answer(name string, qtype dnsmessage.Type) []dnsmessage.Resource {
+	var answers []dnsmessage.Resource
+	for _, record := range s.records {
+		if !strings.EqualFold(record.Header.Name.String(), name) {
+			continue
+		}
+		if cname, ok := record.Body.(*dnsmessage.CNAMEResource); ok {
+			answers = append(answers, record)
+			if !s.partialChain {
+				answers = append(answers, s.answer(cname.CNAME.String(), qtype)...)
+			}
+		} else if record.Header.Type == qtype {
+			answers = append(answers, record)
+		}
+	}
+	return answers
+}
+
+func (s *server) start(t *testing.T) string {
+	for i := range s.records {
+		s.records[i].Header.Type = map[string]dnsmessage.Type{
+			"*dnsmessage.AResource":     dnsmessage.TypeA,
+			"*dnsmessage.AAAAResource":  dnsmessage.TypeAAAA,
+			"*dnsmessage.CNAMEResource": dnsmessage.TypeCNAME,
+			"*dnsmessage.SRVResource":   dnsmessage.TypeSRV,
+		}[reflect.TypeOf(s.records[i].Body).String()]
+	}
+
+	connection, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buffer := make([]byte, 512)
+		for {
+			length, address, err := connection.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			var request dnsmessage.Message
+			if err := request.Unpack(buffer[:length]); err != nil {
+				continue
+			}
+			question := request.Questions[0]
+			s.mutex.Lock()
+			response := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: request.ID, Response: true, RecursionAvailable: true},
+				Questions: request.Questions,
+				Answers:   s.answer(question.Name.String(), question.Type),
+			}
+			s.mutex.Unlock()
+			if len(response.Answers) == 0 && question.Type == dnsmessage.TypeA {
+				response.RCode = dnsmessage.RCodeNameError
+			}
+			packed, _ := response.Pack()
+			connection.WriteTo(packed, address)
+		}
+	}()
+	t.Cleanup(func() { connection.Close() })
+	return connection.LocalAddr().String()
+}
+
+func TestDnsInit(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   map[interface{}]interface{}
+		wantErr  bool
+		errValue error
+	}{
+		{
+			name: "Init with hostnames and resolver",
+			params: map[interface{}]interface{}{
+				"Hostnames": []string{"partner.example.com"}, "Resolver": "10.0.0.2", "MinTTL": "5m",
+				"FromPort": fromPort, "ToPort": toPort, "IpProtocol": ipProtocol,
+			},
+		},
+		{
+			name:     "Init without hostnames",
+			params:   map[interface{}]interface{}{"Resolver": "10.0.0.2", "FromPort": fromPort, "ToPort": toPort, "IpProtocol": ipProtocol},
+			wantErr:  true,
+			errValue: errors.New("Missing Dns Hostnames"),
+		},
+		{
+			name: "Init with invalid MinTTL",
+			params: map[interface{}]interface{}{
+				"Hostnames": []string{"partner.example.com"}, "Resolver": "10.0.0.2", "MinTTL": "long",
+				"FromPort": fromPort, "ToPort": toPort, "IpProtocol": ipProtocol,
+			},
+			wantErr:  true,
+			errValue: errors.New(`Invalid Dns MinTTL long : time: invalid duration "long"`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Dns{}
+			err := d.Init(tt.params)
+			if tt.wantErr {
+				if err == nil || err.Error() != tt.errValue.Error() {
+					t.Errorf("Dns.Init() Got Err: %v, Wanted Err: %v", err, tt.errValue)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Dns.Init() Got Err: %v", err)
+			}
+			if d.resolver.address != "10.0.0.2:53" {
+				t.Errorf("Got resolver address = %s, wanted 10.0.0.2:53", d.resolver.address)
+			}
+		})
+	}
+}
+
+func TestGetIPPermissions(t *testing.T) {
+	records := []dnsmessage.Resource{
+		aRecord("partner.example.com.", 300, "192.0.2.10"),
+		aRecord("partner.example.com.", 300, "192.0.2.11"),
+		aaaaRecord("partner.example.com.", 300, "2001:db8::10"),
+		cnameRecord("alias.example.com.", 60, "partner.example.com."),
+		srvRecord("_sip._tcp.example.com.", 30, "sip.example.com."),
+		aRecord("sip.example.com.", 300, "198.51.100.5"),
+	}
+
+	tests := []struct {
+		name         string
+		params       map[interface{}]interface{}
+		partialChain bool
+		want         map[string]string
+		wantErr      bool
+	}{
+		{
+			name:   "a records",
+			params: map[interface{}]interface{}{"Hostnames": []string{"partner.example.com"}},
+			want:   map[string]string{"192.0.2.10/32": "partner.example.com", "192.0.2.11/32": "partner.example.com"},
+		},
+		{
+			name:   "ipv6",
+			params: map[interface{}]interface{}{"Hostnames": []string{"partner.example.com"}, "IPv6": true},
+			want: map[string]string{"192.0.2.10/32": "partner.example.com", "192.0.2.11/32": "partner.example.com",
+				"2001:db8::10/128": "partner.example.com"},
+		},
+		{
+			name:   "cname and duplicate addresses",
+			params: map[interface{}]interface{}{"Hostnames": []string{"partner.example.com", "alias.example.com"}},
+			want: map[string]string{"192.0.2.10/32": "partner.example.com, alias.example.com",
+				"192.0.2.11/32": "partner.example.com, alias.example.com"},
+		},
+		{
+			name:         "cname chain ending without addresses",
+			params:       map[interface{}]interface{}{"Hostnames": []string{"alias.example.com"}},
+			partialChain: true,
+			want:         map[string]string{"192.0.2.10/32": "alias.example.com", "192.0.2.11/32": "alias.example.com"},
+		},
+		{
+			name:    "cname not followed",
+			params:  map[interface{}]interface{}{"Hostnames": []string{"alias.example.com"}, "FollowCNAME": false},
+			wantErr: true,
+		},
+		{
+			name:   "srv",
+			params: map[interface{}]interface{}{"Hostnames": []string{"_sip._tcp.example.com"}},
+			want:   map[string]string{"198.51.100.5/32": "_sip._tcp.example.com"},
+		},
+		{
+			name:    "unknown host",
+			params:  map[interface{}]interface{}{"Hostnames": []string{"unknown.example.com"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dnsServer := &server{records: records, partialChain: tt.partialChain}
+			tt.params["Resolver"] = dnsServer.start(t)
+			tt.params["FromPort"] = fromPort
+			tt.params["ToPort"] = toPort
+			tt.params["IpProtocol"] = ipProtocol
+
+			d := &Dns{}
+			if err := d.Init(tt.params); err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			got, err := d.GetIPPermissions()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Got = %v, wanted an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+
+			gotRanges := map[string]string{}
+			for _, ipRange := range got[0].IpRanges {
+				gotRanges[*ipRange.IpCidr] = *ipRange.Description
+			}
+			if !reflect.DeepEqual(gotRanges, tt.want) {
+				t.Errorf("Got = %v, wanted %v", gotRanges, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetIPPermissionsTTL(t *testing.T) {
+	dnsServer := &server{records: []dnsmessage.Resource{aRecord("partner.example.com.", 60, "192.0.2.10")}}
+	d := &Dns{}
+	err := d.Init(map[interface{}]interface{}{
+		"Hostnames": []string{"partner.example.com"}, "Resolver": dnsServer.start(t),
+		"FromPort": fromPort, "ToPort": toPort, "IpProtocol": ipProtocol,
+	})
+	if err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+
+	defaultTimeNow := timeNow
+	defer func() { timeNow = defaultTimeNow }()
+	start := time.Now()
+
+	syncs := []struct {
+		after time.Duration
+		ip    string
+		want  []string
+	}{
+		{0, "192.0.2.10", []string{"192.0.2.10/32"}},
+		// The round-robin answer rotated, the previous address is kept until its ttl expires
+		{30 * time.Second, "192.0.2.11", []string{"192.0.2.10/32", "192.0.2.11/32"}},
+		{61 * time.Second, "192.0.2.11", []string{"192.0.2.11/32"}},
+	}
+	for i, sync := range syncs {
+		dnsServer.mutex.Lock()
+		dnsServer.records[0] = aRecord("partner.example.com.", 60, sync.ip)
+		dnsServer.records[0].Header.Type = dnsmessage.TypeA
+		dnsServer.mutex.Unlock()
+		timeNow = func() time.Time { return start.Add(sync.after) }
+
+		got, err := d.GetIPPermissions()
+		if err != nil {
+			t.Fatalf("Sync %d: Got Err: %v", i, err)
+		}
+		var gotCidrs []string
+		for _, ipRange := range got[0].IpRanges {
+			gotCidrs = append(gotCidrs, *ipRange.IpCidr)
+		}
+		if !reflect.DeepEqual(gotCidrs, sync.want) {
+			t.Errorf("Sync %d: Got = %v, wanted %v", i, gotCidrs, sync.want)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package dns
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var (
+	resolvConf     = "/etc/resolv.conf"
+	defaultPort    = "53"
+	queryTimeout   = 5 * time.Second
+	maxCNAMEHops   = 8
+	maxMessageSize = 65535
+)
+
+// answer is a resolved ip address with the lowest ttl of the records it was resolved through
+type answer struct {
+	ip  net.IP
+	ttl uint32
+}
+
+// resolver queries a dns server directly, unlike net.Resolver it exposes the ttl of every record
+type resolver struct {
+	address     string
+	followCNAME bool
+}
+
+func newResolver(address string, followCNAME bool) (*resolver, error) {
+	if address == "" {
+		var err error
+		address, err = readNameserver(resolvConf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, defaultPort)
+	}
+	return &resolver{address: address, followCNAME: followCNAME}, nil
+}
+
+// readNameserver returns the first nameserver of a resolv.conf file
+func readNameserver(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read nameserver : %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1], nil
+		}
+	}
+	return "", fmt.Errorf("No nameserver found in %s", path)
+}
+
+// lookupSRV resolves the targets of the SRV records of name
+func (r *resolver) lookupSRV(name string, ipv6 bool) ([]answer, error) {
+	resources, err := r.query(name, dnsmessage.TypeSRV)
+	if err != nil {
+		return nil, err
+	}
+
+	var answers []answer
+	for _, resource := range resources {
+		srv, ok := resource.Body.(*dnsmessage.SRVResource)
+		if !ok {
+			continue
+		}
+		targetAnswers, err := r.lookupHost(srv.Target.String(), ipv6)
+		if err != nil {
+			return nil, fmt.Errorf("%s : %v", srv.Target, err)
+		}
+		for _, targetAnswer := range targetAnswers {
+			answers = append(answers, answer{targetAnswer.ip, minTTL(targetAnswer.ttl, resource.Header.TTL)})
+		}
+	}
+	return answers, nil
+}
+
+// lookupHost resolves the A records, and optionally AAAA records, of name
+func (r *resolver) lookupHost(name string, ipv6 bool) ([]answer, error) {
+	answers, err := r.lookupType(name, dnsmessage.TypeA)
+	if err != nil || !ipv6 {
+		return answers, err
+	}
+	ipv6Answers, err := r.lookupType(name, dnsmessage.TypeAAAA)
+	return append(answers, ipv6Answers...), err
+}
+
+// lookupType resolves the address records of the given type, following the CNAME chain of name
+func (r *resolver) lookupType(name string, qtype dnsmessage.Type) ([]answer, error) {
+	current := toFQDN(name)
+	ttl := ^uint32(0)
+	for hop := 0; hop < maxCNAMEHops; hop++ {
+		resources, err := r.query(current, qtype)
+		if err != nil {
+			return nil, err
+		}
+
+		// Recursive resolvers usually return the whole chain in a single answer
+		target := current
+		for followed := true; followed; {
+			followed = false
+			for _, resource := range resources {
+				cname, ok := resource.Body.(*dnsmessage.CNAMEResource)
+				if !ok || !strings.EqualFold(resource.Header.Name.String(), target) {
+					continue
+				}
+				if !r.followCNAME {
+					return nil, fmt.Errorf("%s is an alias of %s", name, cname.CNAME)
+				}
+				target = cname.CNAME.String()
+				ttl = minTTL(ttl, resource.Header.TTL)
+				followed = true
+				break
+			}
+		}
+
+		var answers []answer
+		for _, resource := range resources {
+			if !strings.EqualFold(resource.Header.Name.String(), target) {
+				continue
+			}
+			switch body := resource.Body.(type) {
+			case *dnsmessage.AResource:
+				answers = append(answers, answer{net.IP(body.A[:]), minTTL(ttl, resource.Header.TTL)})
+			case *dnsmessage.AAAAResource:
+				answers = append(answers, answer{net.IP(body.AAAA[:]), minTTL(ttl, resource.Header.TTL)})
+			}
+		}
+		if len(answers) > 0 || target == current {
+			return answers, nil
+		}
+		// The answer ended at a CNAME, query its target
+		current = target
+	}
+	return nil, fmt.Errorf("Too many CNAMEs resolving %s", name)
+}
+
+// query sends a single question to the dns server over udp, retrying over tcp if the response is truncated
+func (r *resolver) query(name string, qtype dnsmessage.Type) ([]dnsmessage.Resource, error) {
+	questionName, err := dnsmessage.NewName(toFQDN(name))
+	if err != nil {
+		return nil, err
+	}
+	request := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: uint16(rand.Uint32()), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: questionName, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := request.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := r.exchange("udp", packed)
+	if err == nil && response.Truncated {
+		response, err = r.exchange("tcp", packed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if response.ID != request.ID {
+		return nil, errors.New("Mismatched dns response id")
+	}
+
+	switch response.RCode {
+	case dnsmessage.RCodeSuccess:
+		return response.Answers, nil
+	case dnsmessage.RCodeNameError:
+		return nil, fmt.Errorf("No such host %s", name)
+	}
+	return nil, fmt.Errorf("Dns server %s responded %v for %s", r.address, response.RCode, name)
+}
+
+func (r *resolver) exchange(network string, packed []byte) (*dnsmessage.Message, error) {
+	connection, err := net.DialTimeout(network, r.address, queryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer connection.Close()
+	connection.SetDeadline(time.Now().Add(queryTimeout))
+
+	buffer := make([]byte, maxMessageSize)
+	var length int
+	if network == "tcp" {
+		// Messages over tcp are prefixed with their length
+		prefixed := make([]byte, 2, len(packed)+2)
+		binary.BigEndian.PutUint16(prefixed, uint16(len(packed)))
+		if _, err := connection.Write(append(prefixed, packed...)); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(connection, buffer[:2]); err != nil {
+			return nil, err
+		}
+		length = int(binary.BigEndian.Uint16(buffer[:2]))
+		if _, err := io.ReadFull(connection, buffer[:length]); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := connection.Write(packed); err != nil {
+			return nil, err
+		}
+		length, err = connection.Read(buffer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var response dnsmessage.Message
+	err = response.Unpack(buffer[:length])
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func toFQDN(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+func minTTL(ttl1 uint32, ttl2 uint32) uint32 {
+	if ttl1 < ttl2 {
+		return ttl1
+	}
+	return ttl2
+}
@@ -0,0 +1,132 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	osExec "os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/format"
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+)
+
+var (
+	defaultTimeout = 30 * time.Second
+	// maxStderr is the length of stderr included in errors
+	maxStderr = 1024
+)
+
+// Exec Ip provider class implementing the IpProvider interface, it runs a command and reads the ip list from its output
+type Exec struct {
+	Command        string
+	Args           []string
+	Env            map[string]string
+	Dir            string
+	Timeout        string
+	format.Options `mapstructure:",squash"`
+
+	timeout time.Duration
+}
+
+// GetName returns the name of IP Provider
+func (e *Exec) GetName() string {
+	return "Exec"
+}
+
+// Init initializes the Exec Configuration like the command and its arguments
+func (e *Exec) Init(params map[interface{}]interface{}) error {
+	err := mapstructure.Decode(params, e) //Converts the params to exec struct fields
+	if err != nil {
+		return err
+	}
+
+	if e.Command == "" {
+		return errors.New("Missing Exec Command")
+	}
+	if err := e.Options.Validate(); err != nil {
+		return err
+	}
+	e.timeout = defaultTimeout
+	if e.Timeout != "" {
+		e.timeout, err = time.ParseDuration(e.Timeout)
+		if err != nil {
+			return fmt.Errorf("Invalid Exec Timeout %s : %v", e.Timeout, err)
+		}
+	}
+	return nil
+}
+
+// GetIPPermissions - Get List of IP addresses to whitelist
+func (e *Exec) GetIPPermissions() ([]utils.IpPermission, error) {
+	output, err := e.run()
+	if err != nil {
+		return nil, err
+	}
+
+	outputFormat := e.Format
+	if outputFormat == "" {
+		// yaml also parses json
+		outputFormat = format.YAML
+	}
+	ipPermissions, issues, err := e.Options.Parse(output, outputFormat)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse output of %s : %v", e.Command, err)
+	}
+	for _, issue := range issues {
+		logrus.Warnf("Rejected entry in output of %s : %s", e.Command, issue)
+	}
+	logrus.Infof("Read %d ip permissions from output of %s", len(ipPermissions), e.Command)
+	return ipPermissions, nil
+}
+
+// run runs the command and returns its stdout, stderr is included in the error if the command fails
+func (e *Exec) run() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	command := osExec.CommandContext(ctx, e.Command, e.Args...)
+	command.Dir = e.Dir
+	command.Env = e.getEnv()
+	var stdout, stderr bytes.Buffer
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	err := command.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("Command %s timed out after %s", e.Command, e.timeout)
+	}
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if len(message) > maxStderr {
+			message = message[:maxStderr] + "..."
+		}
+		if message == "" {
+			return nil, fmt.Errorf("Command %s failed : %v", e.Command, err)
+		}
+		return nil, fmt.Errorf("Command %s failed : %v : %s", e.Command, err, message)
+	}
+	return stdout.Bytes(), nil
+}
+
+// getEnv returns the environment of Whitelister with the configured variables added or overridden
+func (e *Exec) getEnv() []string {
+	names := make([]string, 0, len(e.Env))
+	for name := range e.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := os.Environ()
+	for _, name := range names {
+		env = append(env, name+"="+e.Env[name])
+	}
+	return env
+}
@@ -0,0 +1,131 @@
+package exec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExecInit(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   map[interface{}]interface{}
+		wantErr  bool
+		errValue error
+	}{
+		{
+			name: "Init with command",
+			params: map[interface{}]interface{}{
+				"Command": "/usr/local/bin/inventory", "Args": []string{"--team", "platform"},
+				"Env": map[string]string{"VAULT_ADDR": "https://vault:8200"}, "Timeout": "1m",
+			},
+		},
+		{
+			name:     "Init without command",
+			params:   map[interface{}]interface{}{"Args": []string{"--team", "platform"}},
+			wantErr:  true,
+			errValue: errors.New("Missing Exec Command"),
+		},
+		{
+			name:     "Init with invalid timeout",
+			params:   map[interface{}]interface{}{"Command": "/usr/local/bin/inventory", "Timeout": "soon"},
+			wantErr:  true,
+			errValue: errors.New(`Invalid Exec Timeout soon : time: invalid duration "soon"`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Exec{}
+			err := e.Init(tt.params)
+			if tt.wantErr {
+				if err == nil || err.Error() != tt.errValue.Error() {
+					t.Errorf("Exec.Init() Got Err: %v, Wanted Err: %v", err, tt.errValue)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Exec.Init() Got Err: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetIPPermissions(t *testing.T) {
+	tests := []struct {
+		name      string
+		params    map[interface{}]interface{}
+		wantCidrs []string
+		wantErr   string
+	}{
+		{
+			name: "yaml output",
+			params: map[interface{}]interface{}{
+				"Command": "sh",
+				"Args": []string{"-c", "printf 'ipPermissions:\\n- fromPort: 22\\n  toPort: 22\\n  ipProtocol: tcp\\n" +
+					"  ipRanges:\\n  - ipCidr: 10.0.0.1/32\\n'"},
+			},
+			wantCidrs: []string{"10.0.0.1/32"},
+		},
+		{
+			name: "json output with env",
+			params: map[interface{}]interface{}{
+				"Command": "sh",
+				"Args": []string{"-c", `echo "{\"ipPermissions\": [{\"fromPort\": 22, \"toPort\": 22, ` +
+					`\"ipProtocol\": \"tcp\", \"ipRanges\": [{\"ipCidr\": \"$OFFICE_CIDR\"}]}]}"`},
+				"Env": map[string]string{"OFFICE_CIDR": "192.168.0.0/24"},
+			},
+			wantCidrs: []string{"192.168.0.0/24"},
+		},
+		{
+			name: "text output",
+			params: map[interface{}]interface{}{
+				"Command": "echo", "Args": []string{"10.0.0.2"}, "Format": "text",
+				"DefaultFromPort": 22, "DefaultToPort": 22, "DefaultIpProtocol": "tcp",
+			},
+			wantCidrs: []string{"10.0.0.2/32"},
+		},
+		{
+			name:    "failure",
+			params:  map[interface{}]interface{}{"Command": "sh", "Args": []string{"-c", "echo 'vault sealed' >&2; exit 3"}},
+			wantErr: "Command sh failed : exit status 3 : vault sealed",
+		},
+		{
+			name:    "timeout",
+			params:  map[interface{}]interface{}{"Command": "sleep", "Args": []string{"5"}, "Timeout": "100ms"},
+			wantErr: "Command sleep timed out after 100ms",
+		},
+		{
+			name:    "missing command",
+			params:  map[interface{}]interface{}{"Command": "whitelister-missing-command"},
+			wantErr: "Command whitelister-missing-command failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Exec{}
+			if err := e.Init(tt.params); err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			got, err := e.GetIPPermissions()
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("Got Err: %v, Wanted Err: %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+
+			var gotCidrs []string
+			for _, ipPermission := range got {
+				for _, ipRange := range ipPermission.IpRanges {
+					gotCidrs = append(gotCidrs, *ipRange.IpCidr)
+				}
+			}
+			if strings.Join(gotCidrs, ",") != strings.Join(tt.wantCidrs, ",") {
+				t.Errorf("Got = %v, wanted %v", gotCidrs, tt.wantCidrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/format"
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+)
+
+// debounce is how long to wait for further changes before triggering a reconcile, as editors
+// and config map updates change files in several steps
+var debounce = 500 * time.Millisecond
+
+// File Ip provider class implementing the IpProvider interface, it reads ip lists from local files
+type File struct {
+	Paths          []string
+	DescribeOrigin bool
+	format.Options `mapstructure:",squash"`
+}
+
+// GetName returns the name of IP Provider
+func (f *File) GetName() string {
+	return "File"
+}
+
+// Init initializes the File Configuration like the paths to read
+func (f *File) Init(params map[interface{}]interface{}) error {
+	err := mapstructure.Decode(params, f) //Converts the params to file struct fields
+	if err != nil {
+		return err
+	}
+
+	if len(f.Paths) == 0 {
+		return errors.New("Missing File Paths")
+	}
+	return f.Options.Validate()
+}
+
+// GetIPPermissions - Get List of IP addresses to whitelist
+func (f *File) GetIPPermissions() ([]utils.IpPermission, error) {
+	files, err := format.GetFiles("", f.Paths, f.Format != "")
+	if err != nil {
+		return nil, err
+	}
+
+	var ipPermissionLists [][]utils.IpPermission
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		ipPermissions, issues, err := f.Options.Parse(source, f.Options.GetFormat(file))
+		for _, issue := range issues {
+			issue.File = file
+			logrus.Warnf("Rejected entry : %s", issue)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		format.SetOrigin(ipPermissions, file, f.DescribeOrigin)
+		logrus.Infof("Read %d ip permissions from %s", len(ipPermissions), file)
+		ipPermissionLists = append(ipPermissionLists, ipPermissions)
+	}
+	ipPermissions, issues := format.Merge(ipPermissionLists...)
+	for _, issue := range issues {
+		logrus.Warnf("Rejected entry : %s", issue)
+	}
+	return ipPermissions, nil
+}
+
+// getWatchDirs returns the directories containing the paths. Directories are watched rather than
+// files, so that files replaced by a rename or a config map update are still noticed
+func (f *File) getWatchDirs() []string {
+	var dirs []string
+	seen := map[string]bool{}
+	for _, path := range f.Paths {
+		dir := filepath.Dir(path)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			dir = path
+		}
+		if format.IsGlob(dir) {
+			logrus.Warnf("Not watching %s, only patterns of file names are watched", path)
+			continue
+		}
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// isRelevant returns true if a change to the named file in dir may change the ip permissions
+func (f *File) isRelevant(dir string, name string) bool {
+	// Config maps are updated by swapping the ..data symlink
+	if strings.HasPrefix(name, "..") {
+		return true
+	}
+	for _, path := range f.Paths {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			if filepath.Clean(path) == filepath.Clean(dir) && (f.Format != "" || format.IsSupported(name)) {
+				return true
+			}
+			continue
+		}
+		if filepath.Dir(path) != filepath.Clean(dir) {
+			continue
+		}
+		if matched, _ := filepath.Match(filepath.Base(path), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// notifier coalesces changes within the debounce period into a single notification
+type notifier struct {
+	changed chan<- struct{}
+	timer   *time.Timer
+}
+
+func (n *notifier) notify() {
+	if n.timer != nil {
+		n.timer.Reset(debounce)
+		return
+	}
+	n.timer = time.AfterFunc(debounce, func() {
+		select {
+		case n.changed <- struct{}{}:
+		default:
+			// A reconcile is already pending
+		}
+	})
+}
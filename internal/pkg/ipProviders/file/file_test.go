@@ -0,0 +1,203 @@
+package file
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	testUtils "github.com/stakater/Whitelister/internal/pkg/test/utils"
+)
+
+var (
+	aliceConfig = "ipPermissions:\n- fromPort: 22\n  toPort: 22\n  ipProtocol: tcp\n  ipRanges:\n" +
+		"  - ipCidr: 10.0.0.1/32\n    description: alice\n"
+	bobConfig = "ipPermissions:\n- fromPort: 22\n  toPort: 22\n  ipProtocol: tcp\n  ipRanges:\n" +
+		"  - ipCidr: 10.0.0.1/32\n    description: bob\n  - ipCidr: 10.0.0.2/32\n    description: bob\n"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for file, content := range files {
+		err := os.MkdirAll(filepath.Join(dir, filepath.Dir(file)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFileInit(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   map[interface{}]interface{}
+		wantErr  bool
+		errValue error
+	}{
+		{
+			name:   "Init with paths",
+			params: map[interface{}]interface{}{"Paths": []string{"/etc/whitelister/ips.txt"}, "DefaultFromPort": 22},
+		},
+		{
+			name:     "Init without paths",
+			params:   map[interface{}]interface{}{},
+			wantErr:  true,
+			errValue: errors.New("Missing File Paths"),
+		},
+		{
+			name:     "Init with unsupported format",
+			params:   map[interface{}]interface{}{"Paths": []string{"/etc/whitelister/ips.xml"}, "Format": "xml"},
+			wantErr:  true,
+			errValue: errors.New("Unsupported format xml"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &File{}
+			err := f.Init(tt.params)
+			if tt.wantErr {
+				if err == nil || err.Error() != tt.errValue.Error() {
+					t.Errorf("File.Init() Got Err: %v, Wanted Err: %v", err, tt.errValue)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("File.Init() Got Err: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetIPPermissions(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "whitelister-file-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testUtils.DeleteDir(tmpDir)
+
+	writeFiles(t, tmpDir, map[string]string{
+		"users/alice.yaml": aliceConfig,
+		"users/bob.yml":    bobConfig,
+		"users/README.md":  "Add your ip address in a file named after you",
+		"office.txt":       "192.168.0.0/24 # office\n",
+	})
+	alice := filepath.Join(tmpDir, "users/alice.yaml")
+	bob := filepath.Join(tmpDir, "users/bob.yml")
+	office := filepath.Join(tmpDir, "office.txt")
+
+	tests := []struct {
+		name        string
+		params      map[interface{}]interface{}
+		wantOrigins map[string]string
+		wantErr     bool
+	}{
+		{
+			name:        "directory",
+			params:      map[interface{}]interface{}{"Paths": []string{filepath.Join(tmpDir, "users")}},
+			wantOrigins: map[string]string{"10.0.0.1/32": alice, "10.0.0.2/32": bob},
+		},
+		{
+			name:        "glob",
+			params:      map[interface{}]interface{}{"Paths": []string{filepath.Join(tmpDir, "users/*.yaml")}},
+			wantOrigins: map[string]string{"10.0.0.1/32": alice},
+		},
+		{
+			name: "files in different formats",
+			params: map[interface{}]interface{}{
+				"Paths":           []string{bob, office},
+				"DefaultFromPort": 22, "DefaultToPort": 22, "DefaultIpProtocol": "tcp",
+			},
+			wantOrigins: map[string]string{"10.0.0.1/32": bob, "10.0.0.2/32": bob, "192.168.0.0/24": office},
+		},
+		{
+			name:    "missing file",
+			params:  map[interface{}]interface{}{"Paths": []string{filepath.Join(tmpDir, "missing.yaml")}},
+			wantErr: true,
+		},
+		{
+			name:    "no match",
+			params:  map[interface{}]interface{}{"Paths": []string{filepath.Join(tmpDir, "admins/*.yaml")}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &File{}
+			if err := f.Init(tt.params); err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			got, err := f.GetIPPermissions()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Got = %v, wanted an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+
+			gotOrigins := map[string]string{}
+			for _, ipPermission := range got {
+				for _, ipRange := range ipPermission.IpRanges {
+					gotOrigins[*ipRange.IpCidr] = ipRange.Origin
+				}
+			}
+			if !reflect.DeepEqual(gotOrigins, tt.wantOrigins) {
+				t.Errorf("Got = %v, wanted %v", gotOrigins, tt.wantOrigins)
+			}
+		})
+	}
+}
+
+func TestWatch(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "whitelister-file-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testUtils.DeleteDir(tmpDir)
+
+	defaultDebounce := debounce
+	debounce = 50 * time.Millisecond
+	defer func() { debounce = defaultDebounce }()
+
+	writeFiles(t, tmpDir, map[string]string{"config.yaml": aliceConfig})
+
+	f := &File{}
+	if err := f.Init(map[interface{}]interface{}{"Paths": []string{filepath.Join(tmpDir, "config.yaml")}}); err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+	changed := make(chan struct{}, 1)
+	if err := f.Watch(changed); err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+
+	writeFiles(t, tmpDir, map[string]string{"other.yaml": bobConfig})
+	select {
+	case <-changed:
+		t.Errorf("Got change for an unwatched file")
+	case <-time.After(10 * debounce):
+	}
+
+	// Replace the file like editors do
+	writeFiles(t, tmpDir, map[string]string{"config.yaml.tmp": bobConfig})
+	err = os.Rename(filepath.Join(tmpDir, "config.yaml.tmp"), filepath.Join(tmpDir, "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Got no change after replacing the file")
+	}
+
+	got, err := f.GetIPPermissions()
+	if err != nil || len(got) != 1 || len(got[0].IpRanges) != 2 {
+		t.Errorf("Got = %v, Err: %v, wanted the ip ranges of the new file", got, err)
+	}
+}
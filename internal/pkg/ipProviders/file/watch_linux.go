@@ -0,0 +1,62 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"unsafe"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+
+// Watch watches the directories of the paths with inotify and sends on changed when a file changes
+func (f *File) Watch(changed chan<- struct{}) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("Unable to initialize inotify : %v", err)
+	}
+
+	dirs := map[int]string{}
+	for _, dir := range f.getWatchDirs() {
+		wd, err := unix.InotifyAddWatch(fd, dir, watchMask)
+		if err != nil {
+			unix.Close(fd)
+			return fmt.Errorf("Unable to watch %s : %v", dir, err)
+		}
+		dirs[wd] = dir
+		logrus.Infof("Watching %s for changes", dir)
+	}
+
+	go f.readEvents(fd, dirs, &notifier{changed: changed})
+	return nil
+}
+
+func (f *File) readEvents(fd int, dirs map[int]string, notifier *notifier) {
+	defer unix.Close(fd)
+	buffer := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		length, err := unix.Read(fd, buffer)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			logrus.Errorf("Stopped watching files : %v", err)
+			return
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= length; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buffer[nameStart:nameStart+int(event.Len)], "\x00"))
+			offset = nameStart + int(event.Len)
+
+			dir, ok := dirs[int(event.Wd)]
+			if ok && f.isRelevant(dir, name) {
+				logrus.Infof("Changed %s in %s", name, dir)
+				notifier.notify()
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+//go:build !linux
+// +build !linux
+
+package file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pollInterval is how often files are checked for changes where inotify is not available
+var pollInterval = 2 * time.Second
+
+// Watch polls the directories of the paths and sends on changed when a file changes
+func (f *File) Watch(changed chan<- struct{}) error {
+	dirs := f.getWatchDirs()
+	notifier := &notifier{changed: changed}
+	go func() {
+		last := f.snapshot(dirs)
+		for range time.Tick(pollInterval) {
+			current := f.snapshot(dirs)
+			if current != last {
+				notifier.notify()
+			}
+			last = current
+		}
+	}()
+	return nil
+}
+
+// snapshot describes the names, sizes and modification times of the relevant files in dirs
+func (f *File) snapshot(dirs []string) string {
+	var snapshot string
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*"))
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || !f.isRelevant(dir, filepath.Base(match)) {
+				continue
+			}
+			snapshot += fmt.Sprintf("%s %d %d\n", match, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return snapshot
+}
@@ -0,0 +1,77 @@
+package format
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GetFiles returns the files that the paths point at, relative to root if it is set. A path can be a
+// file, a directory whose files in a supported format are all read or a glob pattern e.g. "users/*.yaml".
+// With anyFormat set, directories and patterns match files of any extension
+func GetFiles(root string, paths []string, anyFormat bool) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	for _, path := range paths {
+		pattern := path
+		if info, err := os.Stat(filepath.Join(root, path)); err == nil && info.IsDir() {
+			pattern = filepath.Join(path, "*")
+		} else if !IsGlob(path) {
+			// Missing files are reported when read
+			if !seen[path] {
+				seen[path] = true
+				files = append(files, path)
+			}
+			continue
+		}
+
+		matches, err := glob(root, pattern, anyFormat)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
+		}
+	}
+	return files, nil
+}
+
+// IsGlob returns true if the path is a glob pattern
+func IsGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+func glob(root string, pattern string, anyFormat bool) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(root, pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if !anyFormat && !IsSupported(match) {
+			continue
+		}
+		if root != "" {
+			match, err = filepath.Rel(root, match)
+			if err != nil {
+				return nil, err
+			}
+		}
+		files = append(files, match)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No files match %s", pattern)
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,343 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+)
+
+// Supported formats of ip lists
+const (
+	YAML = "yaml"
+	JSON = "json"
+	CSV  = "csv"
+	Text = "text"
+)
+
+// Columns of the csv format, mapped to header names by Options.CSVColumns
+const (
+	ipCidrColumn      = "ipCidr"
+	descriptionColumn = "description"
+	fromPortColumn    = "fromPort"
+	toPortColumn      = "toPort"
+	ipProtocolColumn  = "ipProtocol"
+)
+
+var defaultDescription = "whitelister"
+
+// Options for parsing ip lists. The defaults apply to csv and text formats, which
+// may not carry ports, protocol or description for every ip range
+type Options struct {
+	Format             string
+	CSVColumns         map[string]string
+	DefaultFromPort    *int64
+	DefaultToPort      *int64
+	DefaultIpProtocol  *string
+	DefaultDescription string
+}
+
+// Validate checks that the configured format is supported
+func (o *Options) Validate() error {
+	switch o.Format {
+	case "", YAML, JSON, CSV, Text:
+		return nil
+	}
+	return fmt.Errorf("Unsupported format %s", o.Format)
+}
+
+// GetFormat returns the configured format or, if none is configured, detects it from the file extension
+func (o *Options) GetFormat(fileName string) string {
+	if o.Format != "" {
+		return o.Format
+	}
+	return Detect(fileName)
+}
+
+// Detect returns the format of a file from its extension, defaulting to yaml
+func Detect(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".json":
+		return JSON
+	case ".csv":
+		return CSV
+	case ".txt", ".list":
+		return Text
+	}
+	return YAML
+}
+
+// IsSupported returns true if the file extension is one of a supported format
+func IsSupported(fileName string) bool {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".yaml", ".yml", ".json", ".csv", ".txt", ".list":
+		return true
+	}
+	return false
+}
+
+// Parse parses an ip list in the given format. Invalid entries are rejected and reported as issues
+// while the rest of the list is used, an error is only returned if the list cannot be parsed at all
+func (o *Options) Parse(source []byte, format string) ([]utils.IpPermission, []Issue, error) {
+	switch format {
+	case YAML, JSON:
+		return o.parseDocument(source)
+	case CSV:
+		return o.parseCSV(source)
+	case Text:
+		return o.parseText(source)
+	}
+	return nil, nil, fmt.Errorf("Unsupported format %s", format)
+}
+
+// parseDocument parses yaml and json ip lists, which share the schema
+//
+//	ipPermissions:
+//	- fromPort: 80
+//	  toPort: 80
+//	  ipProtocol: tcp
+//	  ipRanges:
+//	  - ipCidr: 127.0.0.1/32
+//	    description: Sample address
+//	  userIdGroupPairs:
+//	  - groupId: sg-0123456789abcdef0
+//	    description: CI runners
+//	  prefixListIds:
+//	  - prefixListId: pl-0123456789abcdef0
+//	    description: Office
+//
+// The document is read as a node tree so that issues can be reported with line numbers
+func (o *Options) parseDocument(source []byte) ([]utils.IpPermission, []Issue, error) {
+	var document yaml.Node
+	err := yaml.Unmarshal(source, &document)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(document.Content) == 0 {
+		return nil, nil, nil
+	}
+
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("line %d: expected a mapping with ipPermissions", root.Line)
+	}
+	ipPermissionsNode := getMappingValue(root, "ipPermissions")
+	if ipPermissionsNode == nil || ipPermissionsNode.Tag == "!!null" {
+		return nil, nil, nil
+	}
+	if ipPermissionsNode.Kind != yaml.SequenceNode {
+		return nil, nil, fmt.Errorf("line %d: ipPermissions must be a list", ipPermissionsNode.Line)
+	}
+
+	var ipPermissions []utils.IpPermission
+	var issues []Issue
+	for _, ipPermissionNode := range ipPermissionsNode.Content {
+		var ipPermission utils.IpPermission
+		err := ipPermissionNode.Decode(&ipPermission)
+		if err == nil {
+			err = validateIpPermission(ipPermission)
+		}
+		if err != nil {
+			issues = append(issues, Issue{Line: ipPermissionNode.Line, Reason: err.Error()})
+			continue
+		}
+
+		ipPermission, ok := o.filterEntries(ipPermission, func(key string, index int, err error) {
+			issues = append(issues, Issue{Line: getItemLine(ipPermissionNode, key, index), Reason: err.Error()})
+		})
+		if !ok {
+			continue
+		}
+		ipPermissions = utils.CombineIpPermission(ipPermissions, []utils.IpPermission{ipPermission})
+	}
+	return ipPermissions, issues, nil
+}
+
+// getItemLine returns the line of an item of a list in a mapping, or the line of the mapping if the
+// item is not found
+func getItemLine(node *yaml.Node, key string, index int) int {
+	if listNode := getMappingValue(node, key); listNode != nil && index < len(listNode.Content) {
+		return listNode.Content[index].Line
+	}
+	return node.Line
+}
+
+func getMappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// parseCSV parses a csv file with a header row, columns are mapped to fields with CSVColumns
+func (o *Options) parseCSV(source []byte) ([]utils.IpPermission, []Issue, error) {
+	reader := csv.NewReader(bytes.NewReader(source))
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	indexes := map[string]int{}
+	for _, column := range []string{ipCidrColumn, descriptionColumn, fromPortColumn, toPortColumn, ipProtocolColumn} {
+		name := column
+		if mapped, ok := o.CSVColumns[column]; ok {
+			name = mapped
+		}
+		for index, headerName := range header {
+			if strings.TrimSpace(headerName) == name {
+				indexes[column] = index
+			}
+		}
+	}
+	if _, ok := indexes[ipCidrColumn]; !ok {
+		return nil, nil, fmt.Errorf("Missing %s column in csv header", ipCidrColumn)
+	}
+
+	var ipPermissions []utils.IpPermission
+	var issues []Issue
+	// The header is on the first line
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		value := func(column string) string {
+			if index, ok := indexes[column]; ok && index < len(record) {
+				return strings.TrimSpace(record[index])
+			}
+			return ""
+		}
+
+		ipPermission, err := o.newIpPermission(value(ipCidrColumn), value(descriptionColumn),
+			value(fromPortColumn), value(toPortColumn), value(ipProtocolColumn))
+		if err != nil {
+			issues = append(issues, Issue{Line: line, Reason: err.Error()})
+			continue
+		}
+		ipPermissions = utils.CombineIpPermission(ipPermissions, []utils.IpPermission{ipPermission})
+	}
+	return ipPermissions, issues, nil
+}
+
+// parseText parses one ip or cidr per line, the comment following it is used as its description
+func (o *Options) parseText(source []byte) ([]utils.IpPermission, []Issue, error) {
+	var ipPermissions []utils.IpPermission
+	var issues []Issue
+	scanner := bufio.NewScanner(bytes.NewReader(source))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		description := ""
+		if index := strings.Index(text, "#"); index >= 0 {
+			description = strings.TrimSpace(text[index+1:])
+			text = text[:index]
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		ipPermission, err := o.newIpPermission(text, description, "", "", "")
+		if err != nil {
+			issues = append(issues, Issue{Line: line, Reason: err.Error()})
+			continue
+		}
+		ipPermissions = utils.CombineIpPermission(ipPermissions, []utils.IpPermission{ipPermission})
+	}
+	return ipPermissions, issues, scanner.Err()
+}
+
+// newIpPermission creates an ip permission with a single ip range, falling back to the defaults for empty values
+func (o *Options) newIpPermission(ipCidr string, description string, fromPort string, toPort string,
+	ipProtocol string) (utils.IpPermission, error) {
+
+	ipCidr, err := normalizeCidr(ipCidr)
+	if err != nil {
+		return utils.IpPermission{}, err
+	}
+
+	if description == "" {
+		description = o.getDefaultDescription()
+	}
+
+	from, err := parsePort(fromPort, o.DefaultFromPort, "fromPort")
+	if err != nil {
+		return utils.IpPermission{}, err
+	}
+	to, err := parsePort(toPort, o.DefaultToPort, "toPort")
+	if err != nil {
+		return utils.IpPermission{}, err
+	}
+
+	if ipProtocol == "" && o.DefaultIpProtocol != nil {
+		ipProtocol = *o.DefaultIpProtocol
+	}
+
+	ipPermission := utils.IpPermission{
+		IpRanges: []*utils.IpRange{
+			{
+				IpCidr:      &ipCidr,
+				Description: &description,
+			},
+		},
+		FromPort:   from,
+		ToPort:     to,
+		IpProtocol: &ipProtocol,
+	}
+	return ipPermission, validateIpPermission(ipPermission)
+}
+
+func parsePort(value string, defaultPort *int64, name string) (*int64, error) {
+	if value == "" {
+		if defaultPort == nil {
+			return nil, fmt.Errorf("Missing %s", name)
+		}
+		port := *defaultPort
+		return &port, nil
+	}
+	port, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s %s", name, value)
+	}
+	return &port, nil
+}
+
+// normalizeCidr validates a cidr and turns a single ip address into a cidr
+func normalizeCidr(value string) (string, error) {
+	if _, _, err := net.ParseCIDR(value); err == nil {
+		return value, nil
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return "", fmt.Errorf("Invalid ipCidr %s", value)
+	}
+	if ip.To4() != nil {
+		return value + "/32", nil
+	}
+	return value + "/128", nil
+}
@@ -0,0 +1,260 @@
+package format
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+)
+
+var (
+	ipCidr      = "127.0.0.1/32"
+	ipCidr2     = "10.0.0.0/8"
+	description = "Sample address"
+	fromPort    = int64(80)
+	toPort      = int64(80)
+	ipProtocol  = "tcp"
+	whitelister = "whitelister"
+	groupId     = "sg-0123456789abcdef0"
+	ciRunners   = "CI runners"
+	listId      = "pl-0123456789abcdef0"
+)
+
+func TestDetect(t *testing.T) {
+	tests := map[string]string{
+		"config.yaml":      YAML,
+		"config.yml":       YAML,
+		"config":           YAML,
+		"users/alice.JSON": JSON,
+		"export.csv":       CSV,
+		"ips.txt":          Text,
+	}
+	for fileName, want := range tests {
+		if got := Detect(fileName); got != want {
+			t.Errorf("Detect(%s) = %s, wanted %s", fileName, got, want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	defaults := Options{DefaultFromPort: &fromPort, DefaultToPort: &toPort, DefaultIpProtocol: &ipProtocol}
+
+	tests := []struct {
+		name       string
+		options    Options
+		format     string
+		source     string
+		want       []utils.IpPermission
+		wantIssues []Issue
+		wantErr    bool
+		errValue   error
+	}{
+		{
+			name:   "yaml",
+			format: YAML,
+			source: "ipPermissions:\n- fromPort: 80\n  toPort: 80\n  ipProtocol: tcp\n  ipRanges:\n" +
+				"  - ipCidr: 127.0.0.1/32\n    description: Sample address\n",
+			want: []utils.IpPermission{
+				{
+					IpRanges:   []*utils.IpRange{{IpCidr: &ipCidr, Description: &description}},
+					FromPort:   &fromPort,
+					ToPort:     &toPort,
+					IpProtocol: &ipProtocol,
+				},
+			},
+		},
+		{
+			name:   "json",
+			format: JSON,
+			source: `{"ipPermissions": [{"fromPort": 80, "toPort": 80, "ipProtocol": "tcp",
+				"ipRanges": [{"ipCidr": "127.0.0.1/32", "description": "Sample address"}]}]}`,
+			want: []utils.IpPermission{
+				{
+					IpRanges:   []*utils.IpRange{{IpCidr: &ipCidr, Description: &description}},
+					FromPort:   &fromPort,
+					ToPort:     &toPort,
+					IpProtocol: &ipProtocol,
+				},
+			},
+		},
+		{
+			name:    "csv with column mapping and defaults",
+			options: Options{CSVColumns: map[string]string{"ipCidr": "Address", "description": "Name"}, DefaultIpProtocol: &ipProtocol},
+			format:  CSV,
+			source:  "Name,Address,fromPort,toPort\nSample address,127.0.0.1,80,80\n,10.0.0.0/8,80,80\n",
+			want: []utils.IpPermission{
+				{
+					IpRanges: []*utils.IpRange{
+						{IpCidr: &ipCidr, Description: &description},
+						{IpCidr: &ipCidr2, Description: &whitelister},
+					},
+					FromPort:   &fromPort,
+					ToPort:     &toPort,
+					IpProtocol: &ipProtocol,
+				},
+			},
+		},
+		{
+			name:     "csv without ip column",
+			options:  defaults,
+			format:   CSV,
+			source:   "Name,Address\nSample address,127.0.0.1\n",
+			wantErr:  true,
+			errValue: errors.New("Missing ipCidr column in csv header"),
+		},
+		{
+			name:    "text",
+			options: defaults,
+			format:  Text,
+			source:  "# office ranges\n127.0.0.1 # Sample address\n\n10.0.0.0/8\n",
+			want: []utils.IpPermission{
+				{
+					IpRanges: []*utils.IpRange{
+						{IpCidr: &ipCidr, Description: &description},
+						{IpCidr: &ipCidr2, Description: &whitelister},
+					},
+					FromPort:   &fromPort,
+					ToPort:     &toPort,
+					IpProtocol: &ipProtocol,
+				},
+			},
+		},
+		{
+			name:       "text without default port",
+			options:    Options{DefaultIpProtocol: &ipProtocol},
+			format:     Text,
+			source:     "127.0.0.1\n",
+			wantIssues: []Issue{{Line: 1, Reason: "Missing fromPort"}},
+		},
+		{
+			name:    "text with invalid ip",
+			options: defaults,
+			format:  Text,
+			source:  "127.0.0.1 # Sample address\nlocalhost\n",
+			want: []utils.IpPermission{
+				{
+					IpRanges:   []*utils.IpRange{{IpCidr: &ipCidr, Description: &description}},
+					FromPort:   &fromPort,
+					ToPort:     &toPort,
+					IpProtocol: &ipProtocol,
+				},
+			},
+			wantIssues: []Issue{{Line: 2, Reason: "Invalid ipCidr localhost"}},
+		},
+		{
+			name:   "yaml with invalid entries",
+			format: YAML,
+			source: "ipPermissions:\n" +
+				"- toPort: 80\n  ipProtocol: tcp\n  ipRanges:\n  - ipCidr: 127.0.0.1/32\n" +
+				"- fromPort: 80\n  toPort: 80\n  ipProtocol: tcp\n  ipRanges:\n" +
+				"  - ipCidr: 127.0.0.1/32\n    description: Sample address\n  - ipCidr: 127.0.0.1\n",
+			want: []utils.IpPermission{
+				{
+					IpRanges:   []*utils.IpRange{{IpCidr: &ipCidr, Description: &description}},
+					FromPort:   &fromPort,
+					ToPort:     &toPort,
+					IpProtocol: &ipProtocol,
+				},
+			},
+			wantIssues: []Issue{
+				{Line: 2, Reason: "Missing fromPort"},
+				{Line: 12, Reason: "Invalid ipCidr 127.0.0.1"},
+			},
+		},
+		{
+			name:   "yaml with security groups and prefix lists",
+			format: YAML,
+			source: "ipPermissions:\n- fromPort: 80\n  toPort: 80\n  ipProtocol: tcp\n  userIdGroupPairs:\n" +
+				"  - groupId: sg-0123456789abcdef0\n    description: CI runners\n  - groupId: ci-runners\n" +
+				"  prefixListIds:\n  - prefixListId: pl-0123456789abcdef0\n" +
+				"- fromPort: 80\n  toPort: 80\n  ipProtocol: tcp\n",
+			want: []utils.IpPermission{
+				{
+					UserIdGroupPairs: []*utils.UserIdGroupPair{{GroupId: &groupId, Description: &ciRunners}},
+					PrefixListIds:    []*utils.PrefixListId{{PrefixListId: &listId, Description: &whitelister}},
+					FromPort:         &fromPort,
+					ToPort:           &toPort,
+					IpProtocol:       &ipProtocol,
+				},
+			},
+			wantIssues: []Issue{
+				{Line: 8, Reason: "Invalid groupId ci-runners"},
+				{Line: 11, Reason: "Missing ipRanges, userIdGroupPairs or prefixListIds"},
+			},
+		},
+		{
+			name:   "yaml with invalid ports",
+			format: YAML,
+			source: "ipPermissions:\n- fromPort: 443\n  toPort: 80\n  ipProtocol: tcp\n  ipRanges:\n  - ipCidr: 127.0.0.1/32\n",
+			wantIssues: []Issue{
+				{Line: 2, Reason: "fromPort 443 is greater than toPort 80"},
+			},
+		},
+		{
+			name:    "broken yaml",
+			format:  YAML,
+			source:  "ipPermissions:\n- fromPort: 80\n toPort: 80\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, issues, err := tt.options.Parse([]byte(tt.source), tt.format)
+
+			if tt.wantErr {
+				if err == nil || (tt.errValue != nil && err.Error() != tt.errValue.Error()) {
+					t.Errorf("Got Err: %v, Wanted Err: %v", err, tt.errValue)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			if !reflect.DeepEqual(issues, tt.wantIssues) {
+				t.Errorf("Got issues = %v, wanted %v", issues, tt.wantIssues)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Got = %v, wanted %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(&tt.want[i]) {
+					t.Errorf("Got = %v, wanted %v", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateIpPermissions(t *testing.T) {
+	invalidCidr := "10.0.0.300/32"
+	invalidPort := int64(70000)
+	empty := ""
+	ipPermissions := []utils.IpPermission{
+		{
+			FromPort: &fromPort, ToPort: &toPort, IpProtocol: &ipProtocol,
+			IpRanges: []*utils.IpRange{{IpCidr: &ipCidr, Description: &empty}, {IpCidr: &invalidCidr, Description: &description}},
+		},
+		{FromPort: &invalidPort, ToPort: &toPort, IpProtocol: &ipProtocol, IpRanges: []*utils.IpRange{{IpCidr: &ipCidr2}}},
+		{FromPort: &fromPort, ToPort: &toPort, IpProtocol: &ipProtocol},
+	}
+
+	got, issues := (&Options{}).ValidateIpPermissions(ipPermissions)
+
+	want := []utils.IpPermission{{
+		FromPort: &fromPort, ToPort: &toPort, IpProtocol: &ipProtocol,
+		IpRanges: []*utils.IpRange{{IpCidr: &ipCidr, Description: &whitelister}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got = %v, wanted %v", got, want)
+	}
+	wantIssues := []Issue{
+		{Reason: "ipPermissions[0].ipRanges[1]: Invalid ipCidr 10.0.0.300/32"},
+		{Reason: "ipPermissions[1]: Invalid fromPort 70000"},
+		{Reason: "ipPermissions[2]: Missing ipRanges, userIdGroupPairs or prefixListIds"},
+	}
+	if !reflect.DeepEqual(issues, wantIssues) {
+		t.Errorf("Got issues = %v, wanted %v", issues, wantIssues)
+	}
+}
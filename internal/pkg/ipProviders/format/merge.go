@@ -0,0 +1,96 @@
+package format
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+)
+
+// SetOrigin records the file or source that ip permissions were read from in their ip ranges, security
+// groups and prefix lists. With describe set, the origin is also added to their descriptions so that the
+// rules in the cloud show where they come from
+func SetOrigin(ipPermissions []utils.IpPermission, origin string, describe bool) {
+	for _, ipPermission := range ipPermissions {
+		for _, ipRange := range ipPermission.IpRanges {
+			if ipRange != nil {
+				ipRange.Origin = origin
+				ipRange.Description = describeOrigin(ipRange.Description, origin, describe)
+			}
+		}
+		for _, userIdGroupPair := range ipPermission.UserIdGroupPairs {
+			if userIdGroupPair != nil {
+				userIdGroupPair.Origin = origin
+				userIdGroupPair.Description = describeOrigin(userIdGroupPair.Description, origin, describe)
+			}
+		}
+		for _, prefixListId := range ipPermission.PrefixListIds {
+			if prefixListId != nil {
+				prefixListId.Origin = origin
+				prefixListId.Description = describeOrigin(prefixListId.Description, origin, describe)
+			}
+		}
+	}
+}
+
+func describeOrigin(description *string, origin string, describe bool) *string {
+	if !describe || description == nil {
+		return description
+	}
+	described := fmt.Sprintf("%s (%s)", *description, origin)
+	return &described
+}
+
+// Merge combines validated ip permissions read from several sources, logging the origin of every rule.
+// Ip ranges, security groups and prefix lists that are already whitelisted on the same ports and protocol
+// by an earlier source are dropped and returned as issues of the later source
+func Merge(ipPermissionLists ...[]utils.IpPermission) ([]utils.IpPermission, []Issue) {
+	var merged []utils.IpPermission
+	var issues []Issue
+	origins := map[string]string{}
+
+	for _, ipPermissions := range ipPermissionLists {
+		for _, ipPermission := range ipPermissions {
+			isDuplicate := func(source string, origin string) bool {
+				key := fmt.Sprintf("%s %d-%d %s", *ipPermission.IpProtocol, *ipPermission.FromPort,
+					*ipPermission.ToPort, source)
+				if firstOrigin, ok := origins[key]; ok {
+					issues = append(issues, Issue{
+						File:   origin,
+						Reason: fmt.Sprintf("Duplicate rule %s, already defined in %s", key, firstOrigin),
+					})
+					return true
+				}
+				origins[key] = origin
+				logrus.Infof("Whitelisting rule %s from %s", key, origin)
+				return false
+			}
+
+			var ipRanges []*utils.IpRange
+			for _, ipRange := range ipPermission.IpRanges {
+				if !isDuplicate(*ipRange.IpCidr, ipRange.Origin) {
+					ipRanges = append(ipRanges, ipRange)
+				}
+			}
+			var userIdGroupPairs []*utils.UserIdGroupPair
+			for _, userIdGroupPair := range ipPermission.UserIdGroupPairs {
+				if !isDuplicate(*userIdGroupPair.GroupId, userIdGroupPair.Origin) {
+					userIdGroupPairs = append(userIdGroupPairs, userIdGroupPair)
+				}
+			}
+			var prefixListIds []*utils.PrefixListId
+			for _, prefixListId := range ipPermission.PrefixListIds {
+				if !isDuplicate(*prefixListId.PrefixListId, prefixListId.Origin) {
+					prefixListIds = append(prefixListIds, prefixListId)
+				}
+			}
+
+			ipPermission.IpRanges = ipRanges
+			ipPermission.UserIdGroupPairs = userIdGroupPairs
+			ipPermission.PrefixListIds = prefixListIds
+			merged = utils.CombineIpPermission(merged, []utils.IpPermission{ipPermission})
+		}
+	}
+	return merged, issues
+}
@@ -0,0 +1,68 @@
+package format
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+)
+
+func TestSetOrigin(t *testing.T) {
+	tests := []struct {
+		name            string
+		describe        bool
+		wantDescription string
+	}{
+		{
+			name:            "origin recorded",
+			wantDescription: description,
+		},
+		{
+			name:            "origin described",
+			describe:        true,
+			wantDescription: description + " (users/alice.yaml)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipPermissions := []utils.IpPermission{{
+				FromPort: &fromPort, ToPort: &toPort, IpProtocol: &ipProtocol,
+				IpRanges: []*utils.IpRange{{IpCidr: &ipCidr, Description: &description}},
+			}}
+			SetOrigin(ipPermissions, "users/alice.yaml", tt.describe)
+
+			ipRange := ipPermissions[0].IpRanges[0]
+			if ipRange.Origin != "users/alice.yaml" || *ipRange.Description != tt.wantDescription {
+				t.Errorf("Got origin %s and description %s, wanted users/alice.yaml and %s", ipRange.Origin,
+					*ipRange.Description, tt.wantDescription)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	newIpPermissions := func(origin string, ipCidrs ...*string) []utils.IpPermission {
+		var ipRanges []*utils.IpRange
+		for _, ipCidr := range ipCidrs {
+			ipRanges = append(ipRanges, &utils.IpRange{IpCidr: ipCidr, Description: &description, Origin: origin})
+		}
+		return []utils.IpPermission{{FromPort: &fromPort, ToPort: &toPort, IpProtocol: &ipProtocol, IpRanges: ipRanges}}
+	}
+
+	merged, issues := Merge(newIpPermissions("alice.yaml", &ipCidr), newIpPermissions("bob.yaml", &ipCidr, &ipCidr2))
+
+	var gotCidrs []string
+	for _, ipPermission := range merged {
+		for _, ipRange := range ipPermission.IpRanges {
+			gotCidrs = append(gotCidrs, *ipRange.IpCidr+" "+ipRange.Origin)
+		}
+	}
+	wantCidrs := []string{ipCidr + " alice.yaml", ipCidr2 + " bob.yaml"}
+	if !reflect.DeepEqual(gotCidrs, wantCidrs) {
+		t.Errorf("Got ip ranges %v, wanted %v", gotCidrs, wantCidrs)
+	}
+	wantIssues := []Issue{{File: "bob.yaml", Reason: "Duplicate rule tcp 80-80 127.0.0.1/32, already defined in alice.yaml"}}
+	if !reflect.DeepEqual(issues, wantIssues) {
+		t.Errorf("Got issues %v, wanted %v", issues, wantIssues)
+	}
+}
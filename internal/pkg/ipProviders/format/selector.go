@@ -0,0 +1,171 @@
+package format
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+)
+
+// selectorStep is a single step of a selector, either a field name, an array index or a wildcard
+type selectorStep struct {
+	field    string
+	index    int
+	wildcard bool
+	isIndex  bool
+}
+
+// Selector is a JSONPath-style expression selecting values out of a json or yaml document e.g.
+//
+//	$.prefixes[*].ip_prefix
+//
+// It supports the root `$`, fields with `.name` or `['name']`, array indexes with `[0]`
+// and wildcards over array elements or object values with `[*]` or `.*`
+type Selector struct {
+	steps []selectorStep
+}
+
+// NewSelector parses a selector expression
+func NewSelector(expression string) (*Selector, error) {
+	rest := strings.TrimSpace(expression)
+	if rest == "" {
+		return nil, fmt.Errorf("Empty selector")
+	}
+	rest = strings.TrimPrefix(rest, "$")
+
+	selector := &Selector{}
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			if name == "" {
+				return nil, fmt.Errorf("Invalid selector %s : empty field name", expression)
+			}
+			if name == "*" {
+				selector.steps = append(selector.steps, selectorStep{wildcard: true})
+			} else {
+				selector.steps = append(selector.steps, selectorStep{field: name})
+			}
+			rest = rest[end:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid selector %s : missing ]", expression)
+			}
+			step, err := parseBracket(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid selector %s : %v", expression, err)
+			}
+			selector.steps = append(selector.steps, step)
+			rest = rest[end+1:]
+		default:
+			// A selector may start with a field name without the leading $.
+			rest = "." + rest
+		}
+	}
+	return selector, nil
+}
+
+func parseBracket(content string) (selectorStep, error) {
+	content = strings.TrimSpace(content)
+	if content == "*" {
+		return selectorStep{wildcard: true}, nil
+	}
+	if len(content) >= 2 && (content[0] == '\'' || content[0] == '"') && content[len(content)-1] == content[0] {
+		return selectorStep{field: content[1 : len(content)-1]}, nil
+	}
+	index, err := strconv.Atoi(content)
+	if err != nil {
+		return selectorStep{}, fmt.Errorf("unsupported expression [%s]", content)
+	}
+	return selectorStep{index: index, isIndex: true}, nil
+}
+
+// Select returns the values matched by the selector in the given json or yaml document
+func (s *Selector) Select(source []byte) ([]interface{}, error) {
+	var document interface{}
+	err := yaml.Unmarshal(source, &document)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []interface{}{document}
+	for _, step := range s.steps {
+		var selected []interface{}
+		for _, value := range values {
+			selected = append(selected, step.apply(value)...)
+		}
+		values = selected
+	}
+	return values, nil
+}
+
+func (step selectorStep) apply(value interface{}) []interface{} {
+	switch typed := value.(type) {
+	case []interface{}:
+		if step.wildcard {
+			return typed
+		}
+		if step.isIndex {
+			index := step.index
+			if index < 0 {
+				index += len(typed)
+			}
+			if index >= 0 && index < len(typed) {
+				return []interface{}{typed[index]}
+			}
+		}
+	case map[string]interface{}:
+		if step.wildcard {
+			keys := make([]string, 0, len(typed))
+			for key := range typed {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			values := make([]interface{}, 0, len(keys))
+			for _, key := range keys {
+				values = append(values, typed[key])
+			}
+			return values
+		}
+		if child, ok := typed[step.field]; ok && !step.isIndex {
+			return []interface{}{child}
+		}
+	}
+	return nil
+}
+
+// ParseSelected parses the ip addresses and cidrs matched by the selector in a json or yaml document.
+// Ports, protocol and description are taken from the defaults
+func (o *Options) ParseSelected(source []byte, selector *Selector) ([]utils.IpPermission, []Issue, error) {
+	values, err := selector.Select(source)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ipPermissions []utils.IpPermission
+	var issues []Issue
+	for _, value := range values {
+		ipCidr, ok := value.(string)
+		if !ok {
+			issues = append(issues, Issue{Reason: fmt.Sprintf("Selected value %v is not a string", value)})
+			continue
+		}
+		ipPermission, err := o.newIpPermission(strings.TrimSpace(ipCidr), "", "", "", "")
+		if err != nil {
+			issues = append(issues, Issue{Reason: err.Error()})
+			continue
+		}
+		ipPermissions = utils.CombineIpPermission(ipPermissions, []utils.IpPermission{ipPermission})
+	}
+	return ipPermissions, issues, nil
+}
@@ -0,0 +1,97 @@
+package format
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelect(t *testing.T) {
+	source := []byte(`{"prefixes": [
+		{"ip_prefix": "127.0.0.1/32", "service": "EC2"},
+		{"ip_prefix": "10.0.0.0/8", "service": "S3"}],
+		"hooks": {"web": ["192.168.0.1"], "api": ["172.16.0.0/12"]}}`)
+
+	tests := []struct {
+		name     string
+		selector string
+		want     []interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "wildcard over array",
+			selector: "$.prefixes[*].ip_prefix",
+			want:     []interface{}{"127.0.0.1/32", "10.0.0.0/8"},
+		},
+		{
+			name:     "without root",
+			selector: "prefixes[1]['ip_prefix']",
+			want:     []interface{}{"10.0.0.0/8"},
+		},
+		{
+			name:     "negative index",
+			selector: "$.prefixes[-1].service",
+			want:     []interface{}{"S3"},
+		},
+		{
+			name:     "wildcard over object",
+			selector: "$.hooks.*[*]",
+			want:     []interface{}{"172.16.0.0/12", "192.168.0.1"},
+		},
+		{
+			name:     "missing field",
+			selector: "$.missing[*]",
+		},
+		{
+			name:     "filter expression",
+			selector: "$.prefixes[?(@.service=='EC2')]",
+			wantErr:  true,
+		},
+		{
+			name:     "unterminated bracket",
+			selector: "$.prefixes[*",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := NewSelector(tt.selector)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Got no error for selector %s", tt.selector)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			got, err := selector.Select(source)
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got = %v, wanted %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSelected(t *testing.T) {
+	options := Options{DefaultFromPort: &fromPort, DefaultToPort: &toPort, DefaultIpProtocol: &ipProtocol}
+	selector, err := NewSelector("$.ips[*]")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, issues, err := options.ParseSelected([]byte(`{"ips": ["127.0.0.1", "10.0.0.0/8", "localhost", 42]}`), selector)
+	if err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+	if len(got) != 1 || len(got[0].IpRanges) != 2 || *got[0].IpRanges[0].IpCidr != ipCidr {
+		t.Errorf("Got = %v, wanted %s and %s", got, ipCidr, ipCidr2)
+	}
+	wantIssues := []Issue{{Reason: "Invalid ipCidr localhost"}, {Reason: "Selected value 42 is not a string"}}
+	if !reflect.DeepEqual(issues, wantIssues) {
+		t.Errorf("Got issues = %v, wanted %v", issues, wantIssues)
+	}
+}
@@ -0,0 +1,173 @@
+package format
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+)
+
+// Issue describes an invalid entry of an ip list that was rejected
+type Issue struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (i Issue) String() string {
+	location := i.File
+	if i.Line > 0 {
+		location = fmt.Sprintf("%s:%d", location, i.Line)
+	}
+	if location == "" {
+		return i.Reason
+	}
+	return location + ": " + i.Reason
+}
+
+// validateIpPermission checks the ports and protocol of an ip permission
+func validateIpPermission(ipPermission utils.IpPermission) error {
+	if ipPermission.FromPort == nil {
+		return errors.New("Missing fromPort")
+	}
+	if ipPermission.ToPort == nil {
+		return errors.New("Missing toPort")
+	}
+	if ipPermission.IpProtocol == nil || *ipPermission.IpProtocol == "" {
+		return errors.New("Missing ipProtocol")
+	}
+	if *ipPermission.FromPort < -1 || *ipPermission.FromPort > 65535 {
+		return fmt.Errorf("Invalid fromPort %d", *ipPermission.FromPort)
+	}
+	if *ipPermission.ToPort < -1 || *ipPermission.ToPort > 65535 {
+		return fmt.Errorf("Invalid toPort %d", *ipPermission.ToPort)
+	}
+	switch strings.ToLower(*ipPermission.IpProtocol) {
+	case "tcp", "udp", "6", "17":
+		if *ipPermission.FromPort > *ipPermission.ToPort {
+			return fmt.Errorf("fromPort %d is greater than toPort %d", *ipPermission.FromPort, *ipPermission.ToPort)
+		}
+	}
+	return nil
+}
+
+// ValidateIpPermissions checks ip permissions that were not parsed by Parse, e.g. those of a plugin. Invalid
+// ip permissions, ip ranges, security groups and prefix lists are left out and returned as issues
+func (o *Options) ValidateIpPermissions(ipPermissions []utils.IpPermission) ([]utils.IpPermission, []Issue) {
+	var validIpPermissions []utils.IpPermission
+	var issues []Issue
+	for i, ipPermission := range ipPermissions {
+		if err := validateIpPermission(ipPermission); err != nil {
+			issues = append(issues, Issue{Reason: fmt.Sprintf("ipPermissions[%d]: %v", i, err)})
+			continue
+		}
+		ipPermission, ok := o.filterEntries(ipPermission, func(key string, index int, err error) {
+			location := fmt.Sprintf("ipPermissions[%d]", i)
+			if key != "" {
+				location = fmt.Sprintf("%s.%s[%d]", location, key, index)
+			}
+			issues = append(issues, Issue{Reason: fmt.Sprintf("%s: %v", location, err)})
+		})
+		if ok {
+			validIpPermissions = utils.CombineIpPermission(validIpPermissions, []utils.IpPermission{ipPermission})
+		}
+	}
+	return validIpPermissions, issues
+}
+
+// filterEntries checks the ip ranges, security groups and prefix lists of an ip permission and returns it
+// with the valid ones. reject is called with the list and index of every invalid one, or with an empty
+// list if the ip permission has none at all. It returns false if no valid one is left
+func (o *Options) filterEntries(ipPermission utils.IpPermission,
+	reject func(key string, index int, err error)) (utils.IpPermission, bool) {
+
+	var ipRanges []*utils.IpRange
+	for index, ipRange := range ipPermission.IpRanges {
+		if err := o.validateIpRange(ipRange); err != nil {
+			reject("ipRanges", index, err)
+			continue
+		}
+		ipRanges = append(ipRanges, ipRange)
+	}
+	var userIdGroupPairs []*utils.UserIdGroupPair
+	for index, userIdGroupPair := range ipPermission.UserIdGroupPairs {
+		if err := o.validateUserIdGroupPair(userIdGroupPair); err != nil {
+			reject("userIdGroupPairs", index, err)
+			continue
+		}
+		userIdGroupPairs = append(userIdGroupPairs, userIdGroupPair)
+	}
+	var prefixListIds []*utils.PrefixListId
+	for index, prefixListId := range ipPermission.PrefixListIds {
+		if err := o.validatePrefixListId(prefixListId); err != nil {
+			reject("prefixListIds", index, err)
+			continue
+		}
+		prefixListIds = append(prefixListIds, prefixListId)
+	}
+	if len(ipRanges) == 0 && len(userIdGroupPairs) == 0 && len(prefixListIds) == 0 {
+		if len(ipPermission.IpRanges) == 0 && len(ipPermission.UserIdGroupPairs) == 0 && len(ipPermission.PrefixListIds) == 0 {
+			reject("", 0, errors.New("Missing ipRanges, userIdGroupPairs or prefixListIds"))
+		}
+		return ipPermission, false
+	}
+
+	ipPermission.IpRanges = ipRanges
+	ipPermission.UserIdGroupPairs = userIdGroupPairs
+	ipPermission.PrefixListIds = prefixListIds
+	return ipPermission, true
+}
+
+// validateIpRange checks the cidr of an ip range and sets the default description if it has none
+func (o *Options) validateIpRange(ipRange *utils.IpRange) error {
+	if ipRange == nil || ipRange.IpCidr == nil || *ipRange.IpCidr == "" {
+		return errors.New("Missing ipCidr")
+	}
+	if _, _, err := net.ParseCIDR(*ipRange.IpCidr); err != nil {
+		return fmt.Errorf("Invalid ipCidr %s", *ipRange.IpCidr)
+	}
+	if ipRange.Description == nil || *ipRange.Description == "" {
+		description := o.getDefaultDescription()
+		ipRange.Description = &description
+	}
+	return nil
+}
+
+// validateUserIdGroupPair checks the id of a security group and sets the default description if it has none
+func (o *Options) validateUserIdGroupPair(userIdGroupPair *utils.UserIdGroupPair) error {
+	if userIdGroupPair == nil || userIdGroupPair.GroupId == nil || *userIdGroupPair.GroupId == "" {
+		return errors.New("Missing groupId")
+	}
+	if !strings.HasPrefix(*userIdGroupPair.GroupId, "sg-") {
+		return fmt.Errorf("Invalid groupId %s", *userIdGroupPair.GroupId)
+	}
+	if userIdGroupPair.Description == nil || *userIdGroupPair.Description == "" {
+		description := o.getDefaultDescription()
+		userIdGroupPair.Description = &description
+	}
+	return nil
+}
+
+// validatePrefixListId checks the id of a prefix list and sets the default description if it has none
+func (o *Options) validatePrefixListId(prefixListId *utils.PrefixListId) error {
+	if prefixListId == nil || prefixListId.PrefixListId == nil || *prefixListId.PrefixListId == "" {
+		return errors.New("Missing prefixListId")
+	}
+	if !strings.HasPrefix(*prefixListId.PrefixListId, "pl-") {
+		return fmt.Errorf("Invalid prefixListId %s", *prefixListId.PrefixListId)
+	}
+	if prefixListId.Description == nil || *prefixListId.Description == "" {
+		description := o.getDefaultDescription()
+		prefixListId.Description = &description
+	}
+	return nil
+}
+
+func (o *Options) getDefaultDescription() string {
+	if o.DefaultDescription != "" {
+		return o.DefaultDescription
+	}
+	return defaultDescription
+}
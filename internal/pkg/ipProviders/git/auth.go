@@ -0,0 +1,130 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	cryptoSsh "golang.org/x/crypto/ssh"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/stakater/Whitelister/pkg/kube"
+)
+
+var (
+	defaultUsername        = "Stakater" //can be anything except empty string
+	defaultSSHUsername     = "git"
+	defaultSSHKeySecretKey = "ssh-privatekey"
+	knownHostsSecretKey    = "known_hosts"
+)
+
+// getAuth returns the auth method for the configured credentials. An ssh private key
+// takes precedence over an access token and no credentials at all means anonymous access
+func (g *Git) getAuth() (transport.AuthMethod, error) {
+	if g.SSHKey != "" || g.SSHKeySecret != "" {
+		return g.getSSHAuth()
+	}
+
+	if g.AccessToken != "" {
+		username := g.Username
+		if username == "" {
+			username = defaultUsername
+		}
+		return &http.BasicAuth{
+			Username: username,
+			Password: g.AccessToken,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+func (g *Git) getSSHAuth() (transport.AuthMethod, error) {
+	username := g.Username
+	if username == "" {
+		username = defaultSSHUsername
+	}
+
+	var publicKeys *ssh.PublicKeys
+	var knownHosts []byte
+	var err error
+
+	if g.SSHKey != "" {
+		publicKeys, err = ssh.NewPublicKeysFromFile(username, g.SSHKey, g.SSHKeyPassword)
+	} else {
+		var secretData map[string][]byte
+		secretData, err = readSecret(g.SSHKeySecret)
+		if err != nil {
+			return nil, err
+		}
+		secretKey := g.SSHKeySecretKey
+		if secretKey == "" {
+			secretKey = defaultSSHKeySecretKey
+		}
+		privateKey, ok := secretData[secretKey]
+		if !ok {
+			return nil, fmt.Errorf("Missing key %s in secret %s", secretKey, g.SSHKeySecret)
+		}
+		knownHosts = secretData[knownHostsSecretKey]
+		publicKeys, err = ssh.NewPublicKeys(username, privateKey, g.SSHKeyPassword)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if g.InsecureIgnoreHostKey {
+		publicKeys.HostKeyCallback = cryptoSsh.InsecureIgnoreHostKey()
+	} else if g.KnownHosts != "" {
+		publicKeys.HostKeyCallback, err = ssh.NewKnownHostsCallback(g.KnownHosts)
+	} else if len(knownHosts) > 0 {
+		publicKeys.HostKeyCallback, err = getKnownHostsCallback(knownHosts)
+	}
+	// Otherwise the callback defaults to SSH_KNOWN_HOSTS or ~/.ssh/known_hosts
+	if err != nil {
+		return nil, err
+	}
+
+	return publicKeys, nil
+}
+
+// readSecret reads the data of a kubernetes secret referenced as "namespace/name"
+func readSecret(secretRef string) (map[string][]byte, error) {
+	parts := strings.Split(secretRef, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, errors.New("SSHKeySecret must be of the form namespace/name")
+	}
+
+	client, err := kube.GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := client.CoreV1().Secrets(parts[0]).Get(context.TODO(), parts[1], metaV1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return secret.Data, nil
+}
+
+// getKnownHostsCallback builds a host key callback from known_hosts content, the
+// underlying library only accepts files so the content is written to a temporary file
+func getKnownHostsCallback(knownHosts []byte) (cryptoSsh.HostKeyCallback, error) {
+	file, err := ioutil.TempFile("", "whitelister-known-hosts")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	_, err = file.Write(knownHosts)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewKnownHostsCallback(file.Name())
+}
@@ -0,0 +1,60 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/format"
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+)
+
+// readConfig reads every config file matched by g.Config and merges their ip permissions. Invalid
+// entries are left out and recorded in g.issues
+func (g *Git) readConfig() (Config, error) {
+	g.issues = nil
+	files, err := format.GetFiles(g.path, []string{g.Config}, g.Format != "")
+	if err != nil {
+		g.issues = append(g.issues, format.Issue{Reason: err.Error()})
+		return Config{}, err
+	}
+
+	var ipPermissionLists [][]utils.IpPermission
+	for _, file := range files {
+		config, issues, err := g.readConfigFile(file)
+		for _, issue := range issues {
+			issue.File = file
+			g.issues = append(g.issues, issue)
+		}
+		if err != nil {
+			g.issues = append(g.issues, format.Issue{File: file, Reason: err.Error()})
+			return Config{}, fmt.Errorf("%s: %v", file, err)
+		}
+		format.SetOrigin(config.IpPermissions, file, g.DescribeOrigin)
+		logrus.Infof("Read %d ip permissions from %s", len(config.IpPermissions), file)
+		ipPermissionLists = append(ipPermissionLists, config.IpPermissions)
+	}
+
+	ipPermissions, issues := format.Merge(ipPermissionLists...)
+	g.issues = append(g.issues, issues...)
+	return Config{IpPermissions: ipPermissions}, nil
+}
+
+// readConfigFile reads a config file in the configured format or the format detected from its extension
+func (g *Git) readConfigFile(file string) (Config, []format.Issue, error) {
+	var config Config
+	source, err := ioutil.ReadFile(filepath.Join(g.path, file))
+	if err != nil {
+		return config, nil, err
+	}
+
+	ipPermissions, issues, err := g.Options.Parse(source, g.Options.GetFormat(file))
+	if err != nil {
+		return config, issues, err
+	}
+	config.IpPermissions = ipPermissions
+
+	return config, issues, nil
+}
@@ -0,0 +1,107 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/format"
+	testUtils "github.com/stakater/Whitelister/internal/pkg/test/utils"
+)
+
+func TestReadConfigFiles(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "whitelister-git-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testUtils.DeleteDir(tmpDir)
+
+	files := map[string]string{
+		"users/alice.yaml": "ipPermissions:\n- fromPort: 22\n  toPort: 22\n  ipProtocol: tcp\n  ipRanges:\n" +
+			"  - ipCidr: 10.0.0.1/32\n    description: alice\n",
+		"users/bob.yml": "ipPermissions:\n- fromPort: 22\n  toPort: 22\n  ipProtocol: tcp\n  ipRanges:\n" +
+			"  - ipCidr: 10.0.0.1/32\n    description: bob\n  - ipCidr: 10.0.0.2/32\n    description: bob\n",
+		"users/README.md": "Add your ip address in a file named after you",
+	}
+	for file, content := range files {
+		err := os.MkdirAll(filepath.Join(tmpDir, filepath.Dir(file)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(tmpDir, file), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		config      string
+		wantOrigins map[string]string
+		wantIssues  []format.Issue
+		wantErr     bool
+	}{
+		{
+			name:        "directory",
+			config:      "users",
+			wantOrigins: map[string]string{"10.0.0.1/32": "users/alice.yaml", "10.0.0.2/32": "users/bob.yml"},
+			wantIssues: []format.Issue{{
+				File:   "users/bob.yml",
+				Reason: "Duplicate rule tcp 22-22 10.0.0.1/32, already defined in users/alice.yaml",
+			}},
+		},
+		{
+			name:        "glob",
+			config:      "users/*.yaml",
+			wantOrigins: map[string]string{"10.0.0.1/32": "users/alice.yaml"},
+		},
+		{
+			name:        "single file",
+			config:      "users/bob.yml",
+			wantOrigins: map[string]string{"10.0.0.1/32": "users/bob.yml", "10.0.0.2/32": "users/bob.yml"},
+		},
+		{
+			name:       "no match",
+			config:     "admins/*.yaml",
+			wantIssues: []format.Issue{{Reason: "No files match admins/*.yaml"}},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &Git{Config: tt.config, path: tmpDir}
+			config, err := got.readConfig()
+			if !reflect.DeepEqual(got.issues, tt.wantIssues) {
+				t.Errorf("Got issues %v, wanted %v", got.issues, tt.wantIssues)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Got no error, wanted error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+
+			if len(config.IpPermissions) != 1 {
+				t.Fatalf("Got %d ip permissions, wanted 1", len(config.IpPermissions))
+			}
+			origins := map[string]string{}
+			for _, ipRange := range config.IpPermissions[0].IpRanges {
+				origins[*ipRange.IpCidr] = ipRange.Origin
+			}
+			if len(origins) != len(config.IpPermissions[0].IpRanges) || len(origins) != len(tt.wantOrigins) {
+				t.Fatalf("Got origins %v, wanted %v", origins, tt.wantOrigins)
+			}
+			for ipCidr, origin := range tt.wantOrigins {
+				if origins[ipCidr] != origin {
+					t.Errorf("Got origins %v, wanted %v", origins, tt.wantOrigins)
+				}
+			}
+		})
+	}
+}
@@ -1,35 +1,90 @@
 package git
 
 import (
+	"crypto/sha256"
 	"errors"
-	"io/ioutil"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 	git "gopkg.in/src-d/go-git.v4"
-	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
-	yaml "gopkg.in/yaml.v2"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
 
 	"github.com/mitchellh/mapstructure"
 
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/format"
 	"github.com/stakater/Whitelister/internal/pkg/utils"
 )
 
-var path = "/tmp/whitelister-config"
+// baseDir is the directory under which every git provider gets its own working directory
+var baseDir = "/tmp/whitelister-config"
 
 // Git Ip provider class implementing the IpProvider interface
 type Git struct {
-	AccessToken string
-	URL         string
-	Config      string
-	repository  *git.Repository
-	workingTree *git.Worktree
+	AccessToken           string
+	Username              string
+	SSHKey                string
+	SSHKeySecret          string
+	SSHKeySecretKey       string
+	SSHKeyPassword        string
+	KnownHosts            string
+	InsecureIgnoreHostKey bool
+	URL                   string
+	Config                string
+	DescribeOrigin        bool
+	Branch                string
+	Tag                   string
+	Revision              string
+	VerifyKeyring         string
+	VerifyAllCommits      bool
+	Depth                 int
+	SingleBranch          bool
+	format.Options        `mapstructure:",squash"`
+	ReportWebhook         string
+	ReportWebhookToken    string
+	path                  string
+	auth                  transport.AuthMethod
+	resolvedRevision      string
+	appliedRevision       string
+	syncedRevision        string
+	syncedState           string
+	armoredKeyring        string
+	verifiedRevision      string
+	verifiedConfig        *Config
+	issues                []format.Issue
+	reportedRevision      string
+	repository            *git.Repository
+	workingTree           *git.Worktree
 }
 
 // Equal Compares Git objects
 func (git1 *Git) Equal(git2 *Git) bool {
 	if git1.URL != git2.URL ||
 		git1.AccessToken != git2.AccessToken ||
-		git1.Config != git2.Config {
+		git1.Username != git2.Username ||
+		git1.SSHKey != git2.SSHKey ||
+		git1.SSHKeySecret != git2.SSHKeySecret ||
+		git1.SSHKeySecretKey != git2.SSHKeySecretKey ||
+		git1.SSHKeyPassword != git2.SSHKeyPassword ||
+		git1.KnownHosts != git2.KnownHosts ||
+		git1.InsecureIgnoreHostKey != git2.InsecureIgnoreHostKey ||
+		git1.Config != git2.Config ||
+		git1.DescribeOrigin != git2.DescribeOrigin ||
+		git1.Branch != git2.Branch ||
+		git1.Tag != git2.Tag ||
+		git1.Revision != git2.Revision ||
+		git1.VerifyKeyring != git2.VerifyKeyring ||
+		git1.VerifyAllCommits != git2.VerifyAllCommits ||
+		git1.Depth != git2.Depth ||
+		git1.SingleBranch != git2.SingleBranch ||
+		!reflect.DeepEqual(git1.Options, git2.Options) ||
+		git1.ReportWebhook != git2.ReportWebhook ||
+		git1.ReportWebhookToken != git2.ReportWebhookToken {
 		return false
 	}
 	return true
@@ -52,10 +107,6 @@ func (g *Git) Init(params map[interface{}]interface{}) error {
 		return err
 	}
 
-	if g.AccessToken == "" {
-		return errors.New("Missing Git Access Token")
-	}
-
 	if g.URL == "" {
 		return errors.New("Missing Git URL")
 	}
@@ -64,54 +115,114 @@ func (g *Git) Init(params map[interface{}]interface{}) error {
 		g.Config = "config.yaml"
 	}
 
+	if (g.Branch != "" && g.Tag != "") || (g.Branch != "" && g.Revision != "") || (g.Tag != "" && g.Revision != "") {
+		return errors.New("Only one of Git Branch, Tag or Revision can be specified")
+	}
+
+	err = g.Options.Validate()
+	if err != nil {
+		return err
+	}
+
+	if g.Depth < 0 {
+		return errors.New("Git Depth cannot be negative")
+	}
+
+	if g.VerifyKeyring != "" {
+		err = g.readKeyring()
+		if err != nil {
+			return err
+		}
+	}
+
+	g.auth, err = g.getAuth()
+	if err != nil {
+		return err
+	}
+
+	g.path = g.getWorkingDir()
 	return g.cloneRepository()
 }
 
 // GetIPPermissions - Get List of IP addresses to whitelist
 func (g *Git) GetIPPermissions() ([]utils.IpPermission, error) {
+	g.appliedRevision = ""
 	err := g.pullRepository()
 
 	if err != nil {
 		return nil, err
 	}
 
+	if g.armoredKeyring != "" {
+		err = g.verifyRevision()
+		if err != nil {
+			if g.verifiedConfig == nil {
+				return nil, err
+			}
+			logrus.Errorf("Refusing unverified revision %s, keeping config of last verified revision %s : %v",
+				g.resolvedRevision, g.verifiedRevision, err)
+			g.appliedRevision = g.verifiedRevision
+			return g.verifiedConfig.IpPermissions, nil
+		}
+	}
+
 	conf, err := g.readConfig()
+	g.reportIssues(err)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if g.armoredKeyring != "" {
+		g.verifiedRevision = g.resolvedRevision
+		g.verifiedConfig = &conf
+	}
+
+	g.appliedRevision = g.resolvedRevision
 	return conf.IpPermissions, nil
 }
 
+// getWorkingDir returns the clone directory of this provider, derived from the URL and the tracked reference
+// so that multiple git providers do not clobber each other
+func (g *Git) getWorkingDir() string {
+	key := strings.Join([]string{g.URL, g.Branch, g.Tag, g.Revision}, "#")
+	return filepath.Join(baseDir, fmt.Sprintf("%x", sha256.Sum256([]byte(key)))[:16])
+}
+
+func (g *Git) getCloneOptions() *git.CloneOptions {
+	options := &git.CloneOptions{
+		URL:          g.URL,
+		Auth:         g.auth,
+		Depth:        g.Depth,
+		SingleBranch: g.SingleBranch,
+	}
+	if g.Branch != "" {
+		options.ReferenceName = plumbing.NewBranchReferenceName(g.Branch)
+		options.SingleBranch = true
+	}
+	return options
+}
+
 func (g *Git) cloneRepository() error {
 	var err error
 	// Clone the given repository, creating the remote, the local branches
 	// and fetching the objects, exactly as:
-	logrus.Infof("Cloning Repo %s at %s", g.URL, path)
+	logrus.Infof("Cloning Repo %s at %s", g.URL, g.path)
 
-	options := &git.CloneOptions{
-		URL: g.URL,
-		Auth: &http.BasicAuth{
-			Username: "Stakater", //can be anything except empty string
-			Password: g.AccessToken,
-		},
-	}
-	g.repository, err = git.PlainClone(path, false, options)
+	g.repository, err = git.PlainClone(g.path, false, g.getCloneOptions())
 
-	if err != nil {
-		if err == git.ErrRepositoryAlreadyExists {
-			logrus.Infof("Repo already cloned. Cotinuing")
-			g.repository, err = git.PlainOpen(path)
-			if err != nil {
-				return err
-			}
-		} else {
-			if err == git.ErrRepositoryAlreadyExists {
-				return err
-			}
+	if err == git.ErrRepositoryAlreadyExists {
+		logrus.Infof("Repo already cloned. Cotinuing")
+		g.repository, err = g.openRepository()
+		if err != nil {
+			logrus.Warnf("Unable to reuse repo at %s, cloning again : %v", g.path, err)
+			return g.recloneRepository()
 		}
 	}
+	if err != nil {
+		g.repository = nil
+		return err
+	}
 
 	// Get the working directory for the repository
 	g.workingTree, err = g.repository.Worktree()
@@ -122,12 +233,71 @@ func (g *Git) cloneRepository() error {
 	return nil
 }
 
+// openRepository opens an existing clone and makes sure that it is a healthy clone of the configured URL
+func (g *Git) openRepository() (*git.Repository, error) {
+	repository, err := git.PlainOpen(g.path)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := repository.Remote("origin")
+	if err != nil {
+		return nil, err
+	}
+	urls := remote.Config().URLs
+	if len(urls) == 0 || urls[0] != g.URL {
+		return nil, fmt.Errorf("remote URL %v does not match %s", urls, g.URL)
+	}
+
+	head, err := repository.Head()
+	if err != nil {
+		return nil, err
+	}
+	_, err = repository.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	return repository, nil
+}
+
+// recloneRepository removes the local clone and clones the repository again
+func (g *Git) recloneRepository() error {
+	g.repository = nil
+	g.resolvedRevision = ""
+
+	err := os.RemoveAll(g.path)
+	if err != nil {
+		return err
+	}
+	return g.cloneRepository()
+}
+
+// isRecoverableError returns false for errors of the remote or of the configuration that cloning again would not fix
+func isRecoverableError(err error) bool {
+	switch err {
+	case transport.ErrRepositoryNotFound,
+		transport.ErrEmptyRemoteRepository,
+		transport.ErrAuthenticationRequired,
+		transport.ErrAuthorizationFailed,
+		transport.ErrInvalidAuthMethod:
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return false
+	}
+	return true
+}
+
 func (g *Git) printLatestCommit() {
 	ref, err := g.repository.Head()
 	if err != nil {
 		logrus.Errorf("Unable to get head : %v", err)
 		return
 	}
+	g.resolvedRevision = ref.Hash().String()
 
 	commit, err := g.repository.CommitObject(ref.Hash())
 
@@ -141,12 +311,40 @@ func (g *Git) printLatestCommit() {
 }
 
 func (g *Git) pullRepository() error {
+	if g.repository == nil {
+		err := g.cloneRepository()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := g.updateRepository()
+	if err != nil && isRecoverableError(err) {
+		// The local clone is corrupt or has diverged, e.g. after a force push
+		logrus.Warnf("Unable to update repo at %s, cloning again : %v", g.path, err)
+		err = g.recloneRepository()
+		if err == nil {
+			err = g.updateRepository()
+		}
+	}
+	return err
+}
+
+// updateRepository brings the working tree to the latest commit of the tracked branch or to the pinned revision
+func (g *Git) updateRepository() error {
+	if g.Tag != "" || g.Revision != "" {
+		return g.checkoutPinnedRevision()
+	}
+
 	var pullOptions *git.PullOptions = &git.PullOptions{
-		RemoteName: "origin",
-		Auth: &http.BasicAuth{
-			Username: "Stakater", //can be anything except empty string
-			Password: g.AccessToken,
-		},
+		RemoteName:   "origin",
+		Auth:         g.auth,
+		Depth:        g.Depth,
+		SingleBranch: g.SingleBranch,
+	}
+	if g.Branch != "" {
+		pullOptions.ReferenceName = plumbing.NewBranchReferenceName(g.Branch)
+		pullOptions.SingleBranch = true
 	}
 	err := g.workingTree.Pull(pullOptions)
 
@@ -161,22 +359,50 @@ func (g *Git) pullRepository() error {
 		g.printLatestCommit()
 	}
 
+	if g.resolvedRevision == "" {
+		if ref, err := g.repository.Head(); err == nil {
+			g.resolvedRevision = ref.Hash().String()
+		}
+	}
+	logrus.Infof("Using revision %s of %s", g.resolvedRevision, g.URL)
+
 	return nil
 }
 
-func (g *Git) readConfig() (Config, error) {
-	var config Config
-	// Read YML file
-	source, err := ioutil.ReadFile(path + "/" + g.Config)
-	if err != nil {
-		return config, err
+// checkoutPinnedRevision fetches the remote and checks out the commit that the configured tag or revision points to
+func (g *Git) checkoutPinnedRevision() error {
+	err := g.repository.Fetch(&git.FetchOptions{
+		RemoteName: "origin",
+		Auth:       g.auth,
+		Depth:      g.Depth,
+		Tags:       git.AllTags,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
 	}
 
-	// Unmarshall
-	err = yaml.Unmarshal(source, &config)
+	revision := g.Revision
+	if g.Tag != "" {
+		revision = plumbing.NewTagReferenceName(g.Tag).String()
+	}
+	hash, err := g.repository.ResolveRevision(plumbing.Revision(revision))
 	if err != nil {
-		return config, err
+		return fmt.Errorf("Unable to resolve git revision %s : %w", revision, err)
+	}
+
+	if hash.String() != g.resolvedRevision {
+		err = g.workingTree.Checkout(&git.CheckoutOptions{
+			Hash:  *hash,
+			Force: true,
+		})
+		if err != nil {
+			return err
+		}
+		g.printLatestCommit()
+	} else {
+		logrus.Info("No changes to fetch from git")
 	}
+	logrus.Infof("Using revision %s of %s", g.resolvedRevision, g.URL)
 
-	return config, nil
+	return nil
 }
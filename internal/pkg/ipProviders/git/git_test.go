@@ -2,12 +2,26 @@ package git
 
 import (
 	"errors"
+	"fmt"
 	"github.com/stakater/Whitelister/internal/pkg/utils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/format"
 	testUtils "github.com/stakater/Whitelister/internal/pkg/test/utils"
 )
 
@@ -15,6 +29,9 @@ var (
 	configFilePath = "../../../../configs/testConfigs/"
 	accessToken    = "access_token"
 	url            = "https://github.com/"
+	sshURL         = "git@github.com:stakater/whitelister-config.git"
+	sshKey         = "/tmp/whitelister-missing-ssh-key"
+	username       = "whitelister"
 	configFile     = "config.yaml"
 	testFile       = "sampleConfig.yaml"
 	emptyFile      = "Empty.yaml"
@@ -48,9 +65,69 @@ func TestGitInit(t *testing.T) {
 			args: map[interface{}]interface{}{
 				"URL": url,
 			},
-			want:     &Git{URL: url},
+			want:     &Git{URL: url, Config: configFile},
+			wantErr:  false,
+			errValue: nil,
+		},
+		{
+			name: "url, access token and username",
+			args: map[interface{}]interface{}{
+				"AccessToken": accessToken,
+				"Username":    username,
+				"URL":         url,
+			},
+			want:     &Git{AccessToken: accessToken, Username: username, URL: url, Config: configFile},
+			wantErr:  false,
+			errValue: nil,
+		},
+		{
+			name: "ssh key file not found",
+			args: map[interface{}]interface{}{
+				"SSHKey": sshKey,
+				"URL":    sshURL,
+			},
+			want:     &Git{SSHKey: sshKey, URL: sshURL, Config: configFile},
+			wantErr:  true,
+			errValue: errors.New("open " + sshKey + ": no such file or directory"),
+		},
+		{
+			name: "malformed ssh key secret",
+			args: map[interface{}]interface{}{
+				"SSHKeySecret": "secret",
+				"URL":          sshURL,
+			},
+			want:     &Git{SSHKeySecret: "secret", URL: sshURL, Config: configFile},
 			wantErr:  true,
-			errValue: errors.New("Missing Git Access Token"),
+			errValue: errors.New("SSHKeySecret must be of the form namespace/name"),
+		},
+		{
+			name: "unsupported format",
+			args: map[interface{}]interface{}{
+				"URL":    url,
+				"Format": "xml",
+			},
+			want:     &Git{URL: url, Config: configFile, Options: format.Options{Format: "xml"}},
+			wantErr:  true,
+			errValue: errors.New("Unsupported format xml"),
+		},
+		{
+			name: "csv format options",
+			args: map[interface{}]interface{}{
+				"URL":               url,
+				"Config":            "ips.csv",
+				"CSVColumns":        map[interface{}]interface{}{"ipCidr": "Address"},
+				"DefaultFromPort":   fromPort,
+				"DefaultToPort":     toPort,
+				"DefaultIpProtocol": ipProtocol,
+			},
+			want: &Git{URL: url, Config: "ips.csv", Options: format.Options{
+				CSVColumns:        map[string]string{"ipCidr": "Address"},
+				DefaultFromPort:   &fromPort,
+				DefaultToPort:     &toPort,
+				DefaultIpProtocol: &ipProtocol,
+			}},
+			wantErr:  false,
+			errValue: nil,
 		},
 		{
 			name: "url and access token Only",
@@ -95,6 +172,7 @@ func TestGitInit(t *testing.T) {
 
 func TestReadConfig(t *testing.T) {
 
+	path := filepath.Join(os.TempDir(), "whitelister-read-config")
 	result, err := testUtils.CopyFile(configFilePath+testFile, testFile, path)
 	if !result && err != nil {
 		t.Errorf("Cannot copy file. Error: %v", err)
@@ -153,6 +231,7 @@ func TestReadConfig(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got := tt.args
+			got.path = path
 			config, err := got.readConfig()
 
 			if err != nil && tt.wantErr {
@@ -189,3 +268,319 @@ func TestReadConfig(t *testing.T) {
 		t.Error(err.Error())
 	}
 }
+
+func TestGetAuth(t *testing.T) {
+
+	tests := []struct {
+		name string
+		args Git
+		want transport.AuthMethod
+	}{
+		{
+			name: "anonymous",
+			args: Git{URL: url},
+			want: nil,
+		},
+		{
+			name: "access token with default username",
+			args: Git{URL: url, AccessToken: accessToken},
+			want: &http.BasicAuth{Username: defaultUsername, Password: accessToken},
+		},
+		{
+			name: "access token with username",
+			args: Git{URL: url, AccessToken: accessToken, Username: username},
+			want: &http.BasicAuth{Username: username, Password: accessToken},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.args.getAuth()
+			if err != nil {
+				t.Errorf("Got Err: %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got = %v, wanted %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// commitConfig commits a config whitelisting the given port, signed by signKey unless it is nil
+func commitConfig(t *testing.T, dir string, workingTree *git.Worktree, port int, signKey *openpgp.Entity) plumbing.Hash {
+	content := fmt.Sprintf("ipPermissions:\n- fromPort: %d\n  toPort: %d\n  ipProtocol: tcp\n  ipRanges:\n  - ipCidr: 127.0.0.1/32\n", port, port)
+	err := ioutil.WriteFile(filepath.Join(dir, configFile), []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = workingTree.Add(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := workingTree.Commit(fmt.Sprintf("port %d", port), &git.CommitOptions{
+		Author:  &object.Signature{Name: "Whitelister", Email: "whitelister@stakater.com", When: time.Now()},
+		SignKey: signKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// createOriginRepository creates a local repository whose first commit whitelists port 80, tagged v1 and
+// branched as release, and whose second commit on master whitelists port 443
+func createOriginRepository(t *testing.T, dir string) string {
+	repository, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	workingTree, err := repository.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstCommit := commitConfig(t, dir, workingTree, 80, nil)
+	_, err = repository.CreateTag("v1", firstCommit, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repository.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("release"), firstCommit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitConfig(t, dir, workingTree, 443, nil)
+
+	return firstCommit.String()
+}
+
+func TestGetIPPermissionsPinning(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "whitelister-git-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testUtils.DeleteDir(tmpDir)
+
+	originDir := filepath.Join(tmpDir, "origin")
+	firstCommit := createOriginRepository(t, originDir)
+
+	defaultBaseDir := baseDir
+	baseDir = tmpDir
+	defer func() { baseDir = defaultBaseDir }()
+
+	tests := []struct {
+		name         string
+		args         map[interface{}]interface{}
+		wantPort     int64
+		wantRevision string
+	}{
+		{
+			name:     "default branch",
+			args:     map[interface{}]interface{}{"URL": originDir},
+			wantPort: 443,
+		},
+		{
+			name:         "branch",
+			args:         map[interface{}]interface{}{"URL": originDir, "Branch": "release"},
+			wantPort:     80,
+			wantRevision: firstCommit,
+		},
+		{
+			name:         "tag",
+			args:         map[interface{}]interface{}{"URL": originDir, "Tag": "v1"},
+			wantPort:     80,
+			wantRevision: firstCommit,
+		},
+		{
+			name:         "revision",
+			args:         map[interface{}]interface{}{"URL": originDir, "Revision": firstCommit},
+			wantPort:     80,
+			wantRevision: firstCommit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &Git{}
+			err := got.Init(tt.args)
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+
+			ipPermissions, err := got.GetIPPermissions()
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			if len(ipPermissions) != 1 || *ipPermissions[0].FromPort != tt.wantPort {
+				t.Errorf("Got = %v, wanted port %d", ipPermissions, tt.wantPort)
+			}
+			if tt.wantRevision != "" && got.appliedRevision != tt.wantRevision {
+				t.Errorf("Got revision = %s, wanted %s", got.appliedRevision, tt.wantRevision)
+			}
+		})
+	}
+}
+
+func TestGitInitWithMultiplePins(t *testing.T) {
+	got := &Git{}
+	err := got.Init(map[interface{}]interface{}{"URL": url, "Branch": "release", "Tag": "v1"})
+	if err == nil || err.Error() != "Only one of Git Branch, Tag or Revision can be specified" {
+		t.Errorf("Got Err: %v", err)
+	}
+}
+
+func TestGetIPPermissionsVerification(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "whitelister-git-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testUtils.DeleteDir(tmpDir)
+
+	signKey, err := openpgp.NewEntity("Whitelister", "", "whitelister@stakater.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyringFile := filepath.Join(tmpDir, "keyring.asc")
+	keyring, err := os.Create(keyringFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	armored, err := armor.Encode(keyring, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = signKey.Serialize(armored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	armored.Close()
+	keyring.Close()
+
+	defaultBaseDir := baseDir
+	baseDir = tmpDir
+	defer func() { baseDir = defaultBaseDir }()
+
+	tests := []struct {
+		name             string
+		verifyAllCommits bool
+		wantPorts        []int64
+	}{
+		{
+			name:      "verify head",
+			wantPorts: []int64{80, 80, 8080},
+		},
+		{
+			name:             "verify all commits",
+			verifyAllCommits: true,
+			wantPorts:        []int64{80, 80, 80},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originDir := filepath.Join(tmpDir, fmt.Sprintf("origin-%d", i))
+			repository, err := git.PlainInit(originDir, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			workingTree, err := repository.Worktree()
+			if err != nil {
+				t.Fatal(err)
+			}
+			commitConfig(t, originDir, workingTree, 80, signKey)
+
+			got := &Git{}
+			err = got.Init(map[interface{}]interface{}{
+				"URL":              originDir,
+				"VerifyKeyring":    keyringFile,
+				"VerifyAllCommits": tt.verifyAllCommits,
+			})
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+
+			for sync, wantPort := range tt.wantPorts {
+				switch sync {
+				case 1:
+					commitConfig(t, originDir, workingTree, 443, nil)
+				case 2:
+					commitConfig(t, originDir, workingTree, 8080, signKey)
+				}
+				ipPermissions, err := got.GetIPPermissions()
+				if err != nil {
+					t.Fatalf("Got Err: %v", err)
+				}
+				if len(ipPermissions) != 1 || *ipPermissions[0].FromPort != wantPort {
+					t.Errorf("Sync %d: Got = %v, wanted port %d", sync, ipPermissions, wantPort)
+				}
+			}
+		})
+	}
+}
+
+func TestGetWorkingDir(t *testing.T) {
+	git1 := &Git{URL: url}
+	git2 := &Git{URL: sshURL}
+	git3 := &Git{URL: url, Branch: "release"}
+
+	if git1.getWorkingDir() == git2.getWorkingDir() || git1.getWorkingDir() == git3.getWorkingDir() {
+		t.Errorf("Got same working dir for different providers")
+	}
+	if git1.getWorkingDir() != (&Git{URL: url}).getWorkingDir() {
+		t.Errorf("Got different working dir for same provider")
+	}
+}
+
+func TestGetIPPermissionsRecovery(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "whitelister-git-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testUtils.DeleteDir(tmpDir)
+
+	defaultBaseDir := baseDir
+	baseDir = tmpDir
+	defer func() { baseDir = defaultBaseDir }()
+
+	originDir := filepath.Join(tmpDir, "origin")
+	firstCommit := createOriginRepository(t, originDir)
+
+	got := &Git{}
+	err = got.Init(map[interface{}]interface{}{"URL": originDir, "Depth": 1})
+	if err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+	ipPermissions, err := got.GetIPPermissions()
+	if err != nil || len(ipPermissions) != 1 || *ipPermissions[0].FromPort != 443 {
+		t.Fatalf("Got = %v, Err: %v, wanted port 443", ipPermissions, err)
+	}
+
+	t.Run("force push", func(t *testing.T) {
+		repository, err := git.PlainOpen(originDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		workingTree, err := repository.Worktree()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = workingTree.Reset(&git.ResetOptions{Commit: plumbing.NewHash(firstCommit), Mode: git.HardReset})
+		if err != nil {
+			t.Fatal(err)
+		}
+		commitConfig(t, originDir, workingTree, 8443, nil)
+
+		ipPermissions, err := got.GetIPPermissions()
+		if err != nil || len(ipPermissions) != 1 || *ipPermissions[0].FromPort != 8443 {
+			t.Errorf("Got = %v, Err: %v, wanted port 8443", ipPermissions, err)
+		}
+	})
+
+	t.Run("remote URL mismatch", func(t *testing.T) {
+		other := &Git{URL: filepath.Join(tmpDir, "other"), path: got.path}
+		_, err := other.openRepository()
+		if err == nil {
+			t.Errorf("Got no error opening a clone of a different URL")
+		}
+	})
+}
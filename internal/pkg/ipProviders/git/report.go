@@ -0,0 +1,150 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/format"
+)
+
+var (
+	reportContext        = "whitelister"
+	syncReportContext    = "whitelister/sync"
+	reportTimeout        = 10 * time.Second
+	maxReportDescription = 140 // Maximum length of a GitHub commit status description
+)
+
+// report is posted to the report webhook. State, description and context follow the
+// GitHub commit status API so that the webhook can point at it directly
+type report struct {
+	State       string         `json:"state"`
+	Description string         `json:"description"`
+	Context     string         `json:"context"`
+	Repository  string         `json:"repository"`
+	Revision    string         `json:"revision"`
+	Issues      []format.Issue `json:"issues,omitempty"`
+}
+
+// reportIssues logs the issues found while reading the config of a newly pulled revision and,
+// if a webhook is configured, posts them as a report
+func (g *Git) reportIssues(readErr error) {
+	if g.resolvedRevision != "" && g.resolvedRevision == g.reportedRevision {
+		return
+	}
+
+	for _, issue := range g.issues {
+		logrus.Warnf("Rejected entry in %s at revision %s : %s", g.URL, g.resolvedRevision, issue)
+	}
+
+	if g.ReportWebhook == "" {
+		g.reportedRevision = g.resolvedRevision
+		return
+	}
+
+	err := g.postReport(g.newReport(readErr))
+	if err != nil {
+		// Retried on the next sync
+		logrus.Errorf("Error posting validation report of %s to webhook : %v", g.URL, err)
+		return
+	}
+	g.reportedRevision = g.resolvedRevision
+}
+
+func (g *Git) newReport(readErr error) report {
+	newReport := report{
+		State:       "success",
+		Description: "All entries are valid",
+		Context:     reportContext,
+		Repository:  g.URL,
+		Revision:    g.resolvedRevision,
+		Issues:      g.issues,
+	}
+	if len(g.issues) > 0 {
+		newReport.State = "failure"
+		newReport.Description = fmt.Sprintf("%d rejected entries, first: %s", len(g.issues), g.issues[0])
+	}
+	if readErr != nil {
+		newReport.State = "failure"
+		newReport.Description = readErr.Error()
+	}
+	newReport.Description = truncateDescription(newReport.Description)
+	return newReport
+}
+
+// WriteStatus records the revision whose config the last sync whitelisted, for auditing. It is logged on
+// every sync and, if a webhook is configured, posted as a report with the sync context whenever the
+// revision or the outcome changed
+func (g *Git) WriteStatus(targetGroups []string, err error) {
+	if g.appliedRevision == "" {
+		// The config could not be read, which is logged and reported already
+		return
+	}
+
+	syncReport := report{
+		State:       "success",
+		Description: fmt.Sprintf("Whitelisted in %d target groups", len(targetGroups)),
+		Context:     syncReportContext,
+		Repository:  g.URL,
+		Revision:    g.appliedRevision,
+	}
+	if err != nil {
+		syncReport.State = "failure"
+		syncReport.Description = truncateDescription(err.Error())
+		logrus.Errorf("Failed to whitelist revision %s of %s : %v", g.appliedRevision, g.URL, err)
+	} else {
+		logrus.Infof("Whitelisted revision %s of %s in %s", g.appliedRevision, g.URL, strings.Join(targetGroups, ", "))
+	}
+
+	if g.ReportWebhook == "" || (g.appliedRevision == g.syncedRevision && syncReport.State == g.syncedState) {
+		return
+	}
+	postErr := g.postReport(syncReport)
+	if postErr != nil {
+		// Retried on the next sync
+		logrus.Errorf("Error posting sync report of %s to webhook : %v", g.URL, postErr)
+		return
+	}
+	g.syncedRevision, g.syncedState = g.appliedRevision, syncReport.State
+}
+
+func truncateDescription(description string) string {
+	if len(description) > maxReportDescription {
+		return description[:maxReportDescription-3] + "..."
+	}
+	return description
+}
+
+func (g *Git) postReport(newReport report) error {
+	body, err := json.Marshal(newReport)
+	if err != nil {
+		return err
+	}
+
+	url := strings.Replace(g.ReportWebhook, "{revision}", newReport.Revision, -1)
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if g.ReportWebhookToken != "" {
+		request.Header.Set("Authorization", "Bearer "+g.ReportWebhookToken)
+	}
+
+	client := &http.Client{Timeout: reportTimeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return nil
+}
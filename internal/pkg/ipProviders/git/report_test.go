@@ -0,0 +1,118 @@
+package git
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/format"
+)
+
+func TestReportIssues(t *testing.T) {
+	var reports []report
+	var paths []string
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var received report
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("Got Err decoding report: %v", err)
+		}
+		reports = append(reports, received)
+		paths = append(paths, r.URL.Path)
+		tokens = append(tokens, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	issues := []format.Issue{{File: "config.yaml", Line: 2, Reason: "Missing fromPort"}}
+	got := &Git{
+		URL:                url,
+		ReportWebhook:      server.URL + "/statuses/{revision}",
+		ReportWebhookToken: accessToken,
+		resolvedRevision:   "abc123",
+		issues:             issues,
+	}
+
+	got.reportIssues(nil)
+	// Reported only once per revision
+	got.reportIssues(nil)
+
+	if len(reports) != 1 {
+		t.Fatalf("Got %d reports, wanted 1", len(reports))
+	}
+	want := report{
+		State:       "failure",
+		Description: "1 rejected entries, first: config.yaml:2: Missing fromPort",
+		Context:     reportContext,
+		Repository:  url,
+		Revision:    "abc123",
+		Issues:      issues,
+	}
+	if !reflect.DeepEqual(reports[0], want) {
+		t.Errorf("Got report = %v, wanted %v", reports[0], want)
+	}
+	if paths[0] != "/statuses/abc123" {
+		t.Errorf("Got path = %s, wanted /statuses/abc123", paths[0])
+	}
+	if tokens[0] != "Bearer "+accessToken {
+		t.Errorf("Got Authorization = %s, wanted Bearer %s", tokens[0], accessToken)
+	}
+
+	got.resolvedRevision = "def456"
+	got.issues = nil
+	got.reportIssues(nil)
+	if len(reports) != 2 || reports[1].State != "success" {
+		t.Errorf("Got reports = %v, wanted a success report for the new revision", reports)
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	var reports []report
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var received report
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("Got Err decoding report: %v", err)
+		}
+		reports = append(reports, received)
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	// The last verified revision is applied while the pulled revision is refused
+	got := &Git{
+		URL:              url,
+		ReportWebhook:    server.URL + "/statuses/{revision}",
+		resolvedRevision: "def456",
+		appliedRevision:  "abc123",
+	}
+
+	got.WriteStatus([]string{"sg-1", "sg-2"}, nil)
+	// Reported only once per revision and outcome
+	got.WriteStatus([]string{"sg-1", "sg-2"}, nil)
+	got.WriteStatus(nil, errors.New("UnauthorizedOperation"))
+
+	want := []report{
+		{State: "success", Description: "Whitelisted in 2 target groups", Context: syncReportContext, Repository: url,
+			Revision: "abc123"},
+		{State: "failure", Description: "UnauthorizedOperation", Context: syncReportContext, Repository: url,
+			Revision: "abc123"},
+	}
+	if !reflect.DeepEqual(reports, want) {
+		t.Errorf("Got reports = %v, wanted %v", reports, want)
+	}
+	if len(paths) == 0 || paths[0] != "/statuses/abc123" {
+		t.Errorf("Got paths = %v, wanted the applied revision", paths)
+	}
+
+	// Nothing was applied when the config could not be read
+	got.appliedRevision = ""
+	got.WriteStatus(nil, errors.New("Unable to get ips"))
+	if len(reports) != 2 {
+		t.Errorf("Got reports = %v, wanted no report without an applied revision", reports)
+	}
+}
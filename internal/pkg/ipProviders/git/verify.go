@@ -0,0 +1,81 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/openpgp"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// readKeyring reads the armored GPG keyring that commits are verified against
+func (g *Git) readKeyring() error {
+	keyring, err := ioutil.ReadFile(g.VerifyKeyring)
+	if err != nil {
+		return err
+	}
+	_, err = openpgp.ReadArmoredKeyRing(strings.NewReader(string(keyring)))
+	if err != nil {
+		return fmt.Errorf("Invalid Git Verify Keyring %s : %v", g.VerifyKeyring, err)
+	}
+	g.armoredKeyring = string(keyring)
+	return nil
+}
+
+// verifyRevision verifies the signature of HEAD or, with VerifyAllCommits, of every
+// commit between HEAD and the last verified revision
+func (g *Git) verifyRevision() error {
+	head, err := g.repository.Head()
+	if err != nil {
+		return err
+	}
+	if head.Hash().String() == g.verifiedRevision {
+		return nil
+	}
+
+	if !g.VerifyAllCommits || g.verifiedRevision == "" {
+		commit, err := g.repository.CommitObject(head.Hash())
+		if err != nil {
+			return err
+		}
+		return g.verifyCommit(commit)
+	}
+
+	commits, err := g.repository.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return err
+	}
+	lastVerified := plumbing.NewHash(g.verifiedRevision)
+	foundLastVerified := false
+	err = commits.ForEach(func(commit *object.Commit) error {
+		if commit.Hash == lastVerified {
+			foundLastVerified = true
+			return storer.ErrStop
+		}
+		return g.verifyCommit(commit)
+	})
+	if err != nil {
+		return err
+	}
+	if !foundLastVerified {
+		return fmt.Errorf("Last verified revision %s is not an ancestor of %s", g.verifiedRevision, head.Hash())
+	}
+	return nil
+}
+
+func (g *Git) verifyCommit(commit *object.Commit) error {
+	if commit.PGPSignature == "" {
+		return fmt.Errorf("Commit %s is not signed", commit.Hash)
+	}
+	entity, err := commit.Verify(g.armoredKeyring)
+	if err != nil {
+		return fmt.Errorf("Unable to verify signature of commit %s : %v", commit.Hash, err)
+	}
+	logrus.Infof("Commit %s is signed by key %s", commit.Hash, entity.PrimaryKey.KeyIdString())
+	return nil
+}
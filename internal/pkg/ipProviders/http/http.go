@@ -0,0 +1,209 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	netHttp "net/http"
+	netUrl "net/url"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/format"
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+)
+
+var defaultTimeout = 30 * time.Second
+
+// Http Ip provider class implementing the IpProvider interface, it fetches an ip list from a URL
+type Http struct {
+	URL            string
+	BearerToken    string
+	Username       string
+	Password       string
+	Headers        map[string]string
+	CABundle       string
+	Timeout        string
+	Selector       string
+	format.Options `mapstructure:",squash"`
+
+	client        *netHttp.Client
+	selector      *format.Selector
+	etag          string
+	lastModified  string
+	ipPermissions []utils.IpPermission
+}
+
+// GetName returns the name of IP Provider
+func (h *Http) GetName() string {
+	return "HTTP"
+}
+
+// Init initializes the Http Configuration like URL and credentials
+func (h *Http) Init(params map[interface{}]interface{}) error {
+	err := mapstructure.Decode(params, h) //Converts the params to http struct fields
+	if err != nil {
+		return err
+	}
+
+	if h.URL == "" {
+		return errors.New("Missing Http URL")
+	}
+	if _, err := netUrl.ParseRequestURI(h.URL); err != nil {
+		return fmt.Errorf("Invalid Http URL %s : %v", h.URL, err)
+	}
+	if h.BearerToken != "" && (h.Username != "" || h.Password != "") {
+		return errors.New("Only one of Http BearerToken or Username and Password can be specified")
+	}
+	if err := h.Options.Validate(); err != nil {
+		return err
+	}
+	if h.Selector != "" {
+		if h.Format == format.CSV || h.Format == format.Text {
+			return fmt.Errorf("Http Selector cannot be used with format %s", h.Format)
+		}
+		h.selector, err = format.NewSelector(h.Selector)
+		if err != nil {
+			return err
+		}
+	}
+
+	h.client, err = h.getClient()
+	return err
+}
+
+func (h *Http) getClient() (*netHttp.Client, error) {
+	timeout := defaultTimeout
+	if h.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(h.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Http Timeout %s : %v", h.Timeout, err)
+		}
+	}
+
+	transport := netHttp.DefaultTransport.(*netHttp.Transport).Clone()
+	if h.CABundle != "" {
+		caBundle, err := ioutil.ReadFile(h.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read Http CABundle : %v", err)
+		}
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("No certificates found in Http CABundle %s", h.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+	}
+
+	return &netHttp.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// GetIPPermissions - Get List of IP addresses to whitelist
+func (h *Http) GetIPPermissions() ([]utils.IpPermission, error) {
+	body, response, err := h.Fetch()
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		logrus.Infof("Ip list at %s has not been modified", h.URL)
+		return h.ipPermissions, nil
+	}
+
+	var ipPermissions []utils.IpPermission
+	var issues []format.Issue
+	if h.selector != nil {
+		ipPermissions, issues, err = h.Options.ParseSelected(body, h.selector)
+	} else {
+		ipPermissions, issues, err = h.Options.Parse(body, h.getFormat(response))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse ip list at %s : %v", h.URL, err)
+	}
+	for _, issue := range issues {
+		logrus.Warnf("Rejected entry in %s : %s", h.URL, issue)
+	}
+	logrus.Infof("Read %d ip permissions from %s", len(ipPermissions), h.URL)
+
+	h.ipPermissions = ipPermissions
+	h.Cache(response)
+	return ipPermissions, nil
+}
+
+// Fetch requests the URL with the configured credentials and headers. It returns a nil body if the
+// response has not been modified since the last response passed to Cache
+func (h *Http) Fetch() ([]byte, *netHttp.Response, error) {
+	request, err := netHttp.NewRequest(netHttp.MethodGet, h.URL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, value := range h.Headers {
+		request.Header.Set(name, value)
+	}
+	if h.BearerToken != "" {
+		request.Header.Set("Authorization", "Bearer "+h.BearerToken)
+	} else if h.Username != "" || h.Password != "" {
+		request.SetBasicAuth(h.Username, h.Password)
+	}
+	if h.etag != "" {
+		request.Header.Set("If-None-Match", h.etag)
+	}
+	if h.lastModified != "" {
+		request.Header.Set("If-Modified-Since", h.lastModified)
+	}
+
+	response, err := h.client.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == netHttp.StatusNotModified {
+		return nil, response, nil
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("Unexpected status %s from %s", response.Status, h.URL)
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, response, nil
+}
+
+// Cache remembers the ETag and Last-Modified headers of a response, so that the next Fetch only downloads
+// the ip list if it has been modified. Callers only cache a response once it has been parsed, so that a
+// broken list is fetched again
+func (h *Http) Cache(response *netHttp.Response) {
+	h.etag = response.Header.Get("ETag")
+	h.lastModified = response.Header.Get("Last-Modified")
+}
+
+// getFormat returns the configured format or detects it from the extension of the URL path, falling back
+// to the content type as many servers e.g. raw file hosts serve every file as text/plain
+func (h *Http) getFormat(response *netHttp.Response) string {
+	if h.Format != "" {
+		return h.Format
+	}
+	if path := response.Request.URL.Path; format.IsSupported(path) {
+		return format.Detect(path)
+	}
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		return format.JSON
+	case "text/csv":
+		return format.CSV
+	case "text/plain":
+		return format.Text
+	}
+	return format.YAML
+}
@@ -0,0 +1,259 @@
+package http
+
+import (
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	netHttp "net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	testUtils "github.com/stakater/Whitelister/internal/pkg/test/utils"
+)
+
+var (
+	bearerToken = "bearer_token"
+	etag        = `"v1"`
+)
+
+func TestHttpInit(t *testing.T) {
+	type args struct {
+		params map[interface{}]interface{}
+	}
+	tests := []struct {
+		name     string
+		args     args
+		wantErr  bool
+		errValue error
+	}{
+		{
+			name: "Init with URL and selector",
+			args: args{
+				params: map[interface{}]interface{}{
+					"URL":         "https://example.com/ips.json",
+					"BearerToken": bearerToken,
+					"Headers":     map[interface{}]interface{}{"Accept": "application/json"},
+					"Selector":    "$.prefixes[*].ip_prefix",
+					"Timeout":     "5s",
+				},
+			},
+		},
+		{
+			name:     "Init without URL",
+			args:     args{params: map[interface{}]interface{}{}},
+			wantErr:  true,
+			errValue: errors.New("Missing Http URL"),
+		},
+		{
+			name: "Init with bearer token and basic auth",
+			args: args{
+				params: map[interface{}]interface{}{
+					"URL":         "https://example.com/ips.json",
+					"BearerToken": bearerToken,
+					"Username":    "user",
+				},
+			},
+			wantErr:  true,
+			errValue: errors.New("Only one of Http BearerToken or Username and Password can be specified"),
+		},
+		{
+			name: "Init with selector and text format",
+			args: args{
+				params: map[interface{}]interface{}{
+					"URL":      "https://example.com/ips.txt",
+					"Selector": "$.ips[*]",
+					"Format":   "text",
+				},
+			},
+			wantErr:  true,
+			errValue: errors.New("Http Selector cannot be used with format text"),
+		},
+		{
+			name: "Init with invalid timeout",
+			args: args{
+				params: map[interface{}]interface{}{
+					"URL":     "https://example.com/ips.json",
+					"Timeout": "soon",
+				},
+			},
+			wantErr:  true,
+			errValue: errors.New(`Invalid Http Timeout soon : time: invalid duration "soon"`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Http{}
+			err := h.Init(tt.args.params)
+			if tt.wantErr {
+				if err == nil || err.Error() != tt.errValue.Error() {
+					t.Errorf("Http.Init() Got Err: %v, Wanted Err: %v", err, tt.errValue)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Http.Init() Got Err: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetIPPermissions(t *testing.T) {
+	tests := []struct {
+		name        string
+		params      map[interface{}]interface{}
+		path        string
+		contentType string
+		body        string
+		wantCidrs   []string
+	}{
+		{
+			name:        "yaml",
+			path:        "/config.yaml",
+			contentType: "text/plain",
+			body:        "ipPermissions:\n- fromPort: 80\n  toPort: 80\n  ipProtocol: tcp\n  ipRanges:\n  - ipCidr: 127.0.0.1/32\n",
+			wantCidrs:   []string{"127.0.0.1/32"},
+		},
+		{
+			name: "text detected from content type",
+			params: map[interface{}]interface{}{
+				"DefaultFromPort": 443, "DefaultToPort": 443, "DefaultIpProtocol": "tcp",
+			},
+			path:        "/ips",
+			contentType: "text/plain; charset=utf-8",
+			body:        "127.0.0.1 # Sample address\n10.0.0.0/8\n",
+			wantCidrs:   []string{"127.0.0.1/32", "10.0.0.0/8"},
+		},
+		{
+			name: "json with selector",
+			params: map[interface{}]interface{}{
+				"Selector":        "$.prefixes[*].ip_prefix",
+				"DefaultFromPort": 443, "DefaultToPort": 443, "DefaultIpProtocol": "tcp",
+			},
+			path:        "/api/ranges",
+			contentType: "application/json",
+			body:        `{"prefixes": [{"ip_prefix": "127.0.0.1/32"}, {"ip_prefix": "10.0.0.0/8"}]}`,
+			wantCidrs:   []string{"127.0.0.1/32", "10.0.0.0/8"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			params := map[interface{}]interface{}{"URL": server.URL + tt.path}
+			for key, value := range tt.params {
+				params[key] = value
+			}
+			h := &Http{}
+			if err := h.Init(params); err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			got, err := h.GetIPPermissions()
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+
+			var gotCidrs []string
+			for _, ipPermission := range got {
+				for _, ipRange := range ipPermission.IpRanges {
+					gotCidrs = append(gotCidrs, *ipRange.IpCidr)
+				}
+			}
+			if len(gotCidrs) != len(tt.wantCidrs) {
+				t.Fatalf("Got = %v, wanted %v", gotCidrs, tt.wantCidrs)
+			}
+			for i := range gotCidrs {
+				if gotCidrs[i] != tt.wantCidrs[i] {
+					t.Errorf("Got = %v, wanted %v", gotCidrs, tt.wantCidrs)
+				}
+			}
+		})
+	}
+}
+
+func TestGetIPPermissionsAuthAndCaching(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer "+bearerToken || r.Header.Get("X-Team") != "platform" {
+			w.WriteHeader(netHttp.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(netHttp.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte("127.0.0.1\n"))
+	}))
+	defer server.Close()
+
+	params := map[interface{}]interface{}{
+		"URL":             server.URL + "/ips.txt",
+		"Headers":         map[string]string{"X-Team": "platform"},
+		"DefaultFromPort": 80, "DefaultToPort": 80, "DefaultIpProtocol": "tcp",
+	}
+
+	unauthorized := &Http{}
+	if err := unauthorized.Init(params); err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+	if _, err := unauthorized.GetIPPermissions(); err == nil {
+		t.Errorf("Got no error without bearer token")
+	}
+
+	params["BearerToken"] = bearerToken
+	h := &Http{}
+	if err := h.Init(params); err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		got, err := h.GetIPPermissions()
+		if err != nil || len(got) != 1 || *got[0].IpRanges[0].IpCidr != "127.0.0.1/32" {
+			t.Errorf("Sync %d: Got = %v, Err: %v, wanted 127.0.0.1/32", i, got, err)
+		}
+	}
+	if requests != 3 {
+		t.Errorf("Got %d requests, wanted 3", requests)
+	}
+}
+
+func TestGetIPPermissionsCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		w.Write([]byte("ipPermissions:\n- fromPort: 80\n  toPort: 80\n  ipProtocol: tcp\n  ipRanges:\n  - ipCidr: 127.0.0.1/32\n"))
+	}))
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "whitelister-http-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testUtils.DeleteDir(tmpDir)
+
+	caBundle := filepath.Join(tmpDir, "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caBundle, certificate, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	untrusted := &Http{}
+	if err := untrusted.Init(map[interface{}]interface{}{"URL": server.URL}); err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+	if _, err := untrusted.GetIPPermissions(); err == nil {
+		t.Errorf("Got no error for untrusted certificate")
+	}
+
+	h := &Http{}
+	if err := h.Init(map[interface{}]interface{}{"URL": server.URL + "/config.yaml", "CABundle": caBundle}); err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+	got, err := h.GetIPPermissions()
+	if err != nil || len(got) != 1 {
+		t.Errorf("Got = %v, Err: %v, wanted 1 ip permission", got, err)
+	}
+}
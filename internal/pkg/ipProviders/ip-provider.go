@@ -4,9 +4,18 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/stakater/Whitelister/internal/pkg/config"
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/aws"
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/crd"
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/dns"
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/exec"
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/file"
 	"github.com/stakater/Whitelister/internal/pkg/ipProviders/git"
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/http"
 	"github.com/stakater/Whitelister/internal/pkg/ipProviders/kube"
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/plugin"
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/published"
 	"github.com/stakater/Whitelister/internal/pkg/utils"
+	pluginClient "github.com/stakater/Whitelister/pkg/plugin"
 )
 
 // IpProvider interface so that other IpProvider like github can implement this
@@ -16,6 +25,17 @@ type IpProvider interface {
 	GetName() string
 }
 
+// StatusWriter is implemented by IpProviders that record the outcome of a reconcile on their sources
+type StatusWriter interface {
+	WriteStatus(targetGroups []string, err error)
+}
+
+// Watcher is implemented by IpProviders that notice changes of their sources, they send on changed
+// to reconcile without waiting for the sync interval
+type Watcher interface {
+	Watch(changed chan<- struct{}) error
+}
+
 // PopulateFromConfig populates the IpProvider from config
 func PopulateFromConfig(configIpProviders []config.IpProvider) []IpProvider {
 	var populatedIpProviders []IpProvider
@@ -40,6 +60,24 @@ func MapToIpProvider(ipProviderName string) IpProvider {
 		return &kube.Kube{}
 	case "git":
 		return &git.Git{}
+	case "crd":
+		return &crd.Crd{}
+	case "http":
+		return &http.Http{}
+	case "published-ranges":
+		return &published.Published{}
+	case "dns":
+		return &dns.Dns{}
+	case "file":
+		return &file.File{}
+	case "aws":
+		return &aws.Aws{}
+	case "exec":
+		return &exec.Exec{}
+	}
+	// Ip providers that are not built in can be plugins in the plugin directory
+	if path, ok := pluginClient.Find(ipProviderName); ok {
+		return &plugin.Plugin{Name: ipProviderName, Path: path}
 	}
 	logrus.Errorf("Cannot find an ip provider for : %s", ipProviderName)
 	return nil
@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/format"
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+	pluginClient "github.com/stakater/Whitelister/pkg/plugin"
+)
+
+// Plugin Ip provider class implementing the IpProvider interface, it calls an ip provider plugin
+// running out of process
+type Plugin struct {
+	Name   string
+	Path   string
+	client *pluginClient.Client
+}
+
+// GetName returns the name of IP Provider
+func (p *Plugin) GetName() string {
+	return p.Name
+}
+
+// Init starts the plugin and passes the params to it
+func (p *Plugin) Init(params map[interface{}]interface{}) error {
+	p.client = pluginClient.NewClient(p.Path)
+	handshake, err := p.client.Handshake()
+	if err != nil {
+		return err
+	}
+	if !handshake.IpProvider {
+		p.client.Close()
+		return fmt.Errorf("Plugin %s is not an ip provider", p.Name)
+	}
+	if handshake.Name != "" {
+		p.Name = handshake.Name
+	}
+	return p.client.Init(pluginClient.MethodIpProviderInit, pluginClient.InitParams{Params: pluginClient.ConvertParams(params)})
+}
+
+// GetIPPermissions - Get List of IP addresses to whitelist. The ip permissions of the plugin are validated
+// like those of ip lists, invalid entries are logged and left out
+func (p *Plugin) GetIPPermissions() ([]utils.IpPermission, error) {
+	var pluginIpPermissions []pluginClient.IpPermission
+	err := p.client.Call(pluginClient.MethodGetIPPermissions, nil, &pluginIpPermissions)
+	if err != nil {
+		return nil, err
+	}
+
+	ipPermissions := make([]utils.IpPermission, 0, len(pluginIpPermissions))
+	for _, pluginIpPermission := range pluginIpPermissions {
+		fromPort, toPort, ipProtocol := pluginIpPermission.FromPort, pluginIpPermission.ToPort, pluginIpPermission.IpProtocol
+		ipPermission := utils.IpPermission{FromPort: &fromPort, ToPort: &toPort, IpProtocol: &ipProtocol}
+		for _, pluginIpRange := range pluginIpPermission.IpRanges {
+			ipCidr, description := pluginIpRange.IpCidr, pluginIpRange.Description
+			ipPermission.IpRanges = append(ipPermission.IpRanges, &utils.IpRange{
+				IpCidr:      &ipCidr,
+				Description: &description,
+				Origin:      "plugin " + p.Name,
+			})
+		}
+		for _, pluginUserIdGroupPair := range pluginIpPermission.UserIdGroupPairs {
+			groupId, description := pluginUserIdGroupPair.GroupId, pluginUserIdGroupPair.Description
+			userIdGroupPair := &utils.UserIdGroupPair{GroupId: &groupId, Description: &description, Origin: "plugin " + p.Name}
+			if pluginUserIdGroupPair.UserId != "" {
+				userId := pluginUserIdGroupPair.UserId
+				userIdGroupPair.UserId = &userId
+			}
+			ipPermission.UserIdGroupPairs = append(ipPermission.UserIdGroupPairs, userIdGroupPair)
+		}
+		for _, pluginPrefixListId := range pluginIpPermission.PrefixListIds {
+			prefixListId, description := pluginPrefixListId.PrefixListId, pluginPrefixListId.Description
+			ipPermission.PrefixListIds = append(ipPermission.PrefixListIds, &utils.PrefixListId{
+				PrefixListId: &prefixListId,
+				Description:  &description,
+				Origin:       "plugin " + p.Name,
+			})
+		}
+		ipPermissions = append(ipPermissions, ipPermission)
+	}
+
+	ipPermissions, issues := (&format.Options{}).ValidateIpPermissions(ipPermissions)
+	for _, issue := range issues {
+		issue.File = "plugin " + p.Name
+		logrus.Warnf("Rejected entry : %s", issue)
+	}
+	return ipPermissions, nil
+}
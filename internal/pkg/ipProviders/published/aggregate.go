@@ -0,0 +1,113 @@
+package published
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"net"
+	"sort"
+)
+
+// ipv4Interval is an inclusive range of ipv4 addresses
+type ipv4Interval struct {
+	start uint64
+	end   uint64
+}
+
+// aggregate merges overlapping and adjacent ipv4 cidrs into the smallest list of cidrs covering the same addresses
+func aggregate(ipNets []*net.IPNet) []string {
+	var intervals []ipv4Interval
+	for _, ipNet := range ipNets {
+		ip := ipNet.IP.To4()
+		if ip == nil {
+			continue
+		}
+		ones, _ := ipNet.Mask.Size()
+		start := uint64(binary.BigEndian.Uint32(ip))
+		intervals = append(intervals, ipv4Interval{start, start + (uint64(1) << uint(32-ones)) - 1})
+	}
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].start < intervals[j].start
+	})
+
+	var merged []ipv4Interval
+	for _, interval := range intervals {
+		last := len(merged) - 1
+		if last >= 0 && interval.start <= merged[last].end+1 {
+			if interval.end > merged[last].end {
+				merged[last].end = interval.end
+			}
+			continue
+		}
+		merged = append(merged, interval)
+	}
+
+	var cidrs []string
+	for _, interval := range merged {
+		cidrs = append(cidrs, interval.toCidrs()...)
+	}
+	return cidrs
+}
+
+// toCidrs splits an interval into the largest cidrs aligned on their own size
+func (interval ipv4Interval) toCidrs() []string {
+	var cidrs []string
+	start := interval.start
+	for start <= interval.end {
+		// The largest block aligned at start, limited by the addresses left in the interval
+		size := uint(32)
+		if start != 0 {
+			size = uint(bits.TrailingZeros64(start))
+			if size > 32 {
+				size = 32
+			}
+		}
+		for start+(uint64(1)<<size)-1 > interval.end {
+			size--
+		}
+
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, uint32(start))
+		ipNet := net.IPNet{IP: ip, Mask: net.CIDRMask(32-int(size), 32)}
+		cidrs = append(cidrs, ipNet.String())
+		start += uint64(1) << size
+	}
+	return cidrs
+}
+
+// aggregateIpv6 removes the duplicate ipv6 cidrs and those covered by another one, adjacent ipv6 cidrs are
+// not merged as vendors publish few of them
+func aggregateIpv6(ipNets []*net.IPNet) []string {
+	var ipv6Nets []*net.IPNet
+	for _, ipNet := range ipNets {
+		if ipNet.IP.To4() == nil {
+			ipv6Nets = append(ipv6Nets, ipNet)
+		}
+	}
+	// Larger cidrs first, so that the cidrs they cover are dropped
+	sort.Slice(ipv6Nets, func(i, j int) bool {
+		onesI, _ := ipv6Nets[i].Mask.Size()
+		onesJ, _ := ipv6Nets[j].Mask.Size()
+		return onesI < onesJ
+	})
+
+	var kept []*net.IPNet
+	for _, ipNet := range ipv6Nets {
+		covered := false
+		for _, keptNet := range kept {
+			if keptNet.Contains(ipNet.IP) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			kept = append(kept, ipNet)
+		}
+	}
+
+	var cidrs []string
+	for _, ipNet := range kept {
+		cidrs = append(cidrs, ipNet.String())
+	}
+	sort.Strings(cidrs)
+	return cidrs
+}
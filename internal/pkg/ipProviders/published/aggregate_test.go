@@ -0,0 +1,76 @@
+package published
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		name  string
+		cidrs []string
+		want  []string
+	}{
+		{
+			name:  "adjacent halves",
+			cidrs: []string{"10.0.0.128/25", "10.0.0.0/25"},
+			want:  []string{"10.0.0.0/24"},
+		},
+		{
+			name:  "contained and duplicate",
+			cidrs: []string{"10.0.0.0/8", "10.1.2.0/24", "10.0.0.0/8"},
+			want:  []string{"10.0.0.0/8"},
+		},
+		{
+			name:  "unaligned adjacent",
+			cidrs: []string{"10.0.1.0/24", "10.0.2.0/24"},
+			want:  []string{"10.0.1.0/24", "10.0.2.0/24"},
+		},
+		{
+			name:  "three quarters",
+			cidrs: []string{"10.0.0.0/26", "10.0.0.64/26", "10.0.0.128/26"},
+			want:  []string{"10.0.0.0/25", "10.0.0.128/26"},
+		},
+		{
+			name:  "whole address space",
+			cidrs: []string{"0.0.0.0/1", "128.0.0.0/1"},
+			want:  []string{"0.0.0.0/0"},
+		},
+		{
+			name:  "single addresses",
+			cidrs: []string{"255.255.255.255/32", "192.168.0.1/32"},
+			want:  []string{"192.168.0.1/32", "255.255.255.255/32"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ipNets []*net.IPNet
+			for _, cidr := range tt.cidrs {
+				_, ipNet, err := net.ParseCIDR(cidr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ipNets = append(ipNets, ipNet)
+			}
+			if got := aggregate(ipNets); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got = %v, wanted %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregateIpv6(t *testing.T) {
+	var ipNets []*net.IPNet
+	for _, cidr := range []string{"2600:1f00::/40", "10.0.0.0/8", "2600:1f00:1::/48", "2400:cb00::/32", "2600:1f00::/40"} {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+	want := []string{"2400:cb00::/32", "2600:1f00::/40"}
+	if got := aggregateIpv6(ipNets); !reflect.DeepEqual(got, want) {
+		t.Errorf("Got = %v, wanted %v", got, want)
+	}
+}
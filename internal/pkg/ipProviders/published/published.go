@@ -0,0 +1,168 @@
+package published
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders/http"
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+)
+
+// Published Ip provider class implementing the IpProvider interface, it whitelists the ip ranges
+// published by cloud and SaaS vendors e.g. AWS ip-ranges.json or GitHub meta
+type Published struct {
+	Source      string
+	URL         string
+	Services    []string
+	Regions     []string
+	FromPort    *int64
+	ToPort      *int64
+	IpProtocol  *string
+	Description string
+	BearerToken string
+	Headers     map[string]string
+	CABundle    string
+	Timeout     string
+
+	source        source
+	fetcher       *http.Http
+	ipPermissions []utils.IpPermission
+}
+
+// GetName returns the name of IP Provider
+func (p *Published) GetName() string {
+	return "Published Ranges"
+}
+
+// Init initializes the Published Configuration like source and filters
+func (p *Published) Init(params map[interface{}]interface{}) error {
+	err := mapstructure.Decode(params, p) //Converts the params to published struct fields
+	if err != nil {
+		return err
+	}
+
+	var ok bool
+	p.source, ok = sources[strings.ToLower(p.Source)]
+	if !ok {
+		return fmt.Errorf("Unsupported Published Ranges Source %s, supported sources are %s",
+			p.Source, strings.Join(getSourceNames(), ", "))
+	}
+	if len(p.Regions) > 0 && !p.source.supportsRegion {
+		return fmt.Errorf("Published Ranges Source %s does not support Regions", p.Source)
+	}
+	if p.FromPort == nil {
+		return errors.New("Missing Published Ranges From Port")
+	}
+	if p.ToPort == nil {
+		return errors.New("Missing Published Ranges To Port")
+	}
+	if p.IpProtocol == nil || *p.IpProtocol == "" {
+		return errors.New("Missing Published Ranges Ip Protocol")
+	}
+	if p.Description == "" {
+		p.Description = fmt.Sprintf("%s published ranges", strings.ToLower(p.Source))
+	}
+
+	url := p.URL
+	if url == "" {
+		url = p.source.url
+	}
+	p.fetcher = &http.Http{}
+	return p.fetcher.Init(map[interface{}]interface{}{
+		"URL":         url,
+		"BearerToken": p.BearerToken,
+		"Headers":     p.Headers,
+		"CABundle":    p.CABundle,
+		"Timeout":     p.Timeout,
+	})
+}
+
+func getSourceNames() []string {
+	var names []string
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetIPPermissions - Get List of IP addresses to whitelist
+func (p *Published) GetIPPermissions() ([]utils.IpPermission, error) {
+	body, response, err := p.fetcher.Fetch()
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		logrus.Infof("Published %s ranges have not been modified", p.Source)
+		return p.ipPermissions, nil
+	}
+
+	ranges, err := p.source.parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse published %s ranges : %v", p.Source, err)
+	}
+
+	ipNets := p.filter(ranges)
+	if len(ipNets) == 0 {
+		return nil, fmt.Errorf("No published %s ranges match services %v and regions %v", p.Source, p.Services, p.Regions)
+	}
+
+	var ipRanges []*utils.IpRange
+	for _, ipCidr := range append(aggregate(ipNets), aggregateIpv6(ipNets)...) {
+		ipCidr := ipCidr
+		ipRanges = append(ipRanges, &utils.IpRange{
+			IpCidr:      &ipCidr,
+			Description: &p.Description,
+		})
+	}
+	logrus.Infof("Aggregated %d published %s ranges into %d", len(ipNets), p.Source, len(ipRanges))
+
+	p.ipPermissions = []utils.IpPermission{
+		{
+			IpRanges:   ipRanges,
+			FromPort:   p.FromPort,
+			ToPort:     p.ToPort,
+			IpProtocol: p.IpProtocol,
+		},
+	}
+	p.fetcher.Cache(response)
+	return p.ipPermissions, nil
+}
+
+// filter returns the ipv4 and ipv6 ranges matching the configured services and regions
+func (p *Published) filter(ranges []publishedRange) []*net.IPNet {
+	var ipNets []*net.IPNet
+	for _, publishedRange := range ranges {
+		if !matches(p.Services, publishedRange.Services) || !matches(p.Regions, publishedRange.Regions) {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(publishedRange.IpCidr)
+		if err != nil {
+			logrus.Warnf("Ignoring invalid published %s range %s", p.Source, publishedRange.IpCidr)
+			continue
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+	return ipNets
+}
+
+// matches returns true if no filter is configured or any of the values is in the filter
+func matches(filter []string, values []string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, wanted := range filter {
+		for _, value := range values {
+			if strings.EqualFold(wanted, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package published
+
+import (
+	"errors"
+	netHttp "net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+var (
+	fromPort   = 443
+	toPort     = 443
+	ipProtocol = "tcp"
+)
+
+const (
+	awsRanges = `{"prefixes": [
+		{"ip_prefix": "10.0.0.0/25", "region": "us-east-1", "service": "EC2"},
+		{"ip_prefix": "10.0.0.128/25", "region": "us-east-1", "service": "EC2"},
+		{"ip_prefix": "10.0.1.0/24", "region": "us-west-2", "service": "EC2"},
+		{"ip_prefix": "10.1.0.0/16", "region": "us-east-1", "service": "S3"}],
+		"ipv6_prefixes": [{"ipv6_prefix": "2600:1f00::/40", "region": "us-east-1", "service": "EC2"}]}`
+	githubMeta = `{"verifiable_password_authentication": true,
+		"hooks": ["192.30.252.0/22", "185.199.108.0/22"],
+		"actions": ["13.64.0.0/16"]}`
+	cloudflareIps   = `{"success": true, "result": {"ipv4_cidrs": ["173.245.48.0/20"], "ipv6_cidrs": ["2400:cb00::/32"]}}`
+	atlassianRanges = `{"items": [
+		{"cidr": "13.52.5.0/25", "region": ["us-west-1"], "product": ["jira", "confluence"]},
+		{"cidr": "18.136.214.0/25", "region": ["ap-southeast-1"], "product": ["bitbucket"]}]}`
+	googleRanges = `{"prefixes": [
+		{"ipv4Prefix": "34.80.0.0/15", "service": "Google Cloud", "scope": "asia-east1"},
+		{"ipv4Prefix": "34.64.0.0/11", "service": "Google Cloud", "scope": "us-central1"},
+		{"ipv6Prefix": "2600:1900::/35", "service": "Google Cloud", "scope": "us-central1"}]}`
+)
+
+func TestPublishedInit(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   map[interface{}]interface{}
+		wantErr  bool
+		errValue error
+	}{
+		{
+			name: "Init with source and filters",
+			params: map[interface{}]interface{}{
+				"Source": "aws", "Services": []string{"EC2"}, "Regions": []string{"us-east-1"},
+				"FromPort": fromPort, "ToPort": toPort, "IpProtocol": ipProtocol,
+			},
+		},
+		{
+			name:     "Init with unsupported source",
+			params:   map[interface{}]interface{}{"Source": "azure", "FromPort": fromPort, "ToPort": toPort, "IpProtocol": ipProtocol},
+			wantErr:  true,
+			errValue: errors.New("Unsupported Published Ranges Source azure, supported sources are atlassian, aws, cloudflare, github, google"),
+		},
+		{
+			name: "Init with regions for github",
+			params: map[interface{}]interface{}{
+				"Source": "github", "Regions": []string{"us-east-1"},
+				"FromPort": fromPort, "ToPort": toPort, "IpProtocol": ipProtocol,
+			},
+			wantErr:  true,
+			errValue: errors.New("Published Ranges Source github does not support Regions"),
+		},
+		{
+			name:     "Init without ports",
+			params:   map[interface{}]interface{}{"Source": "cloudflare", "IpProtocol": ipProtocol},
+			wantErr:  true,
+			errValue: errors.New("Missing Published Ranges From Port"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Published{}
+			err := p.Init(tt.params)
+			if tt.wantErr {
+				if err == nil || err.Error() != tt.errValue.Error() {
+					t.Errorf("Published.Init() Got Err: %v, Wanted Err: %v", err, tt.errValue)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Published.Init() Got Err: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetIPPermissions(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		body      string
+		services  []string
+		regions   []string
+		wantCidrs []string
+		wantErr   bool
+	}{
+		{
+			name:      "aws aggregated by service and region",
+			source:    "aws",
+			body:      awsRanges,
+			services:  []string{"ec2"},
+			regions:   []string{"us-east-1"},
+			wantCidrs: []string{"10.0.0.0/24", "2600:1f00::/40"},
+		},
+		{
+			name:      "aws without filters",
+			source:    "aws",
+			body:      awsRanges,
+			wantCidrs: []string{"10.0.0.0/23", "10.1.0.0/16", "2600:1f00::/40"},
+		},
+		{
+			name:      "github hooks",
+			source:    "github",
+			body:      githubMeta,
+			services:  []string{"hooks"},
+			wantCidrs: []string{"185.199.108.0/22", "192.30.252.0/22"},
+		},
+		{
+			name:      "cloudflare",
+			source:    "cloudflare",
+			body:      cloudflareIps,
+			wantCidrs: []string{"173.245.48.0/20", "2400:cb00::/32"},
+		},
+		{
+			name:      "atlassian jira",
+			source:    "atlassian",
+			body:      atlassianRanges,
+			services:  []string{"jira"},
+			wantCidrs: []string{"13.52.5.0/25"},
+		},
+		{
+			name:      "google scope",
+			source:    "google",
+			body:      googleRanges,
+			regions:   []string{"us-central1"},
+			wantCidrs: []string{"34.64.0.0/11", "2600:1900::/35"},
+		},
+		{
+			name:     "no matching ranges",
+			source:   "aws",
+			body:     awsRanges,
+			services: []string{"CLOUDFRONT"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			p := &Published{}
+			err := p.Init(map[interface{}]interface{}{
+				"Source": tt.source, "URL": server.URL, "Services": tt.services, "Regions": tt.regions,
+				"FromPort": fromPort, "ToPort": toPort, "IpProtocol": ipProtocol,
+			})
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			got, err := p.GetIPPermissions()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Got = %v, wanted an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			if len(got) != 1 {
+				t.Fatalf("Got = %v, wanted 1 ip permission", got)
+			}
+
+			var gotCidrs []string
+			for _, ipRange := range got[0].IpRanges {
+				gotCidrs = append(gotCidrs, *ipRange.IpCidr)
+				if *ipRange.Description != tt.source+" published ranges" {
+					t.Errorf("Got description = %s", *ipRange.Description)
+				}
+			}
+			if !reflect.DeepEqual(gotCidrs, tt.wantCidrs) {
+				t.Errorf("Got = %v, wanted %v", gotCidrs, tt.wantCidrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package published
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// publishedRange is a single cidr of a published list with the services and regions it belongs to
+type publishedRange struct {
+	IpCidr   string
+	Services []string
+	Regions  []string
+}
+
+// source describes a well-known published list of ip ranges and how to parse it
+type source struct {
+	url            string
+	supportsRegion bool
+	parse          func(body []byte) ([]publishedRange, error)
+}
+
+var sources = map[string]source{
+	"aws": {
+		url:            "https://ip-ranges.amazonaws.com/ip-ranges.json",
+		supportsRegion: true,
+		parse:          parseAws,
+	},
+	"github": {
+		url:   "https://api.github.com/meta",
+		parse: parseGithub,
+	},
+	"cloudflare": {
+		url:   "https://api.cloudflare.com/client/v4/ips",
+		parse: parseCloudflare,
+	},
+	"atlassian": {
+		url:            "https://ip-ranges.atlassian.com/",
+		supportsRegion: true,
+		parse:          parseAtlassian,
+	},
+	"google": {
+		url:            "https://www.gstatic.com/ipranges/cloud.json",
+		supportsRegion: true,
+		parse:          parseGoogle,
+	},
+}
+
+// parseAws parses https://ip-ranges.amazonaws.com/ip-ranges.json, services are e.g. EC2 or CLOUDFRONT
+func parseAws(body []byte) ([]publishedRange, error) {
+	var document struct {
+		Prefixes []struct {
+			IpPrefix string `json:"ip_prefix"`
+			Region   string `json:"region"`
+			Service  string `json:"service"`
+		} `json:"prefixes"`
+		Ipv6Prefixes []struct {
+			Ipv6Prefix string `json:"ipv6_prefix"`
+			Region     string `json:"region"`
+			Service    string `json:"service"`
+		} `json:"ipv6_prefixes"`
+	}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+
+	var ranges []publishedRange
+	for _, prefix := range document.Prefixes {
+		ranges = append(ranges, publishedRange{prefix.IpPrefix, []string{prefix.Service}, []string{prefix.Region}})
+	}
+	for _, prefix := range document.Ipv6Prefixes {
+		ranges = append(ranges, publishedRange{prefix.Ipv6Prefix, []string{prefix.Service}, []string{prefix.Region}})
+	}
+	return ranges, nil
+}
+
+// parseGithub parses https://api.github.com/meta, services are its lists e.g. hooks or actions
+func parseGithub(body []byte) ([]publishedRange, error) {
+	var document map[string]interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+
+	services := make([]string, 0, len(document))
+	for service := range document {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	var ranges []publishedRange
+	for _, service := range services {
+		// Only lists of cidrs, skipping e.g. verifiable_password_authentication and ssh_key_fingerprints
+		values, ok := document[service].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, value := range values {
+			if ipCidr, ok := value.(string); ok {
+				ranges = append(ranges, publishedRange{IpCidr: ipCidr, Services: []string{service}})
+			}
+		}
+	}
+	return ranges, nil
+}
+
+// parseCloudflare parses https://api.cloudflare.com/client/v4/ips
+func parseCloudflare(body []byte) ([]publishedRange, error) {
+	var document struct {
+		Success bool `json:"success"`
+		Result  struct {
+			Ipv4Cidrs []string `json:"ipv4_cidrs"`
+			Ipv6Cidrs []string `json:"ipv6_cidrs"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+	if !document.Success {
+		return nil, fmt.Errorf("Cloudflare api responded without success")
+	}
+
+	var ranges []publishedRange
+	for _, ipCidr := range append(document.Result.Ipv4Cidrs, document.Result.Ipv6Cidrs...) {
+		ranges = append(ranges, publishedRange{IpCidr: ipCidr})
+	}
+	return ranges, nil
+}
+
+// parseAtlassian parses https://ip-ranges.atlassian.com/, services are its products e.g. jira or bitbucket
+func parseAtlassian(body []byte) ([]publishedRange, error) {
+	var document struct {
+		Items []struct {
+			Cidr    string   `json:"cidr"`
+			Region  []string `json:"region"`
+			Product []string `json:"product"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+
+	var ranges []publishedRange
+	for _, item := range document.Items {
+		ranges = append(ranges, publishedRange{item.Cidr, item.Product, item.Region})
+	}
+	return ranges, nil
+}
+
+// parseGoogle parses https://www.gstatic.com/ipranges/cloud.json, regions are its scopes e.g. us-central1
+func parseGoogle(body []byte) ([]publishedRange, error) {
+	var document struct {
+		Prefixes []struct {
+			Ipv4Prefix string `json:"ipv4Prefix"`
+			Ipv6Prefix string `json:"ipv6Prefix"`
+			Service    string `json:"service"`
+			Scope      string `json:"scope"`
+		} `json:"prefixes"`
+	}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+
+	var ranges []publishedRange
+	for _, prefix := range document.Prefixes {
+		ipCidr := prefix.Ipv4Prefix
+		if ipCidr == "" {
+			ipCidr = prefix.Ipv6Prefix
+		}
+		ranges = append(ranges, publishedRange{ipCidr, []string{prefix.Service}, []string{prefix.Scope}})
+	}
+	return ranges, nil
+}
@@ -2,25 +2,66 @@ package aws
 
 import (
 	"errors"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"fmt"
+	"strings"
+	"sync"
+
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elb/elbiface"
+	"github.com/aws/aws-sdk-go/service/servicequotas"
+	"github.com/aws/aws-sdk-go/service/servicequotas/servicequotasiface"
 	"github.com/mitchellh/mapstructure"
 	"github.com/sirupsen/logrus"
 	"github.com/stakater/Whitelister/internal/pkg/config"
 	clientset "k8s.io/client-go/kubernetes"
 
 	"github.com/stakater/Whitelister/internal/pkg/utils"
+	awsClient "github.com/stakater/Whitelister/pkg/aws"
 )
 
 // Aws provider class implementing the Provider interface
 type Aws struct {
 	ClientSet                 clientset.Interface
-	RoleArn                   string
+	awsClient.Options         `mapstructure:",squash"`
 	Region                    string
+	Targets                   []Target
 	RemoveRule                bool
 	KeepRuleDescriptionPrefix string
+	RemoveReferences          bool
+	PrefixListName            string
+	PrefixListMaxEntries      int64
+	Direction                 string
+	RulesPerGroup             int
+	OverflowGroups            int
+	CreateOverflowGroups      bool
+	NetworkAclRuleStart       int64
+	NetworkAclRuleEnd         int64
+	targetGroups              []string
+	targets                   []*target
+	initErr                   error
+}
+
+// Target is an account and region whose security groups are whitelisted. The role to assume in the
+// account, its external id and the direction of the rules default to the RoleArn, ExternalID and
+// Direction of the provider
+type Target struct {
+	RoleArn    string
+	ExternalID string
+	Region     string
+	Direction  string
+}
+
+// target holds the clients of a Target and its quota of rules per security group, they are created on
+// the first sync and reused by later syncs
+type target struct {
+	Target
+	options       awsClient.Options
+	ec2Client     ec2iface.EC2API
+	elbClient     elbiface.ELBAPI
+	quotasClient  servicequotasiface.ServiceQuotasAPI
+	rulesPerGroup int
 }
 
 // GetName Returns name of provider
@@ -28,58 +69,279 @@ func (a *Aws) GetName() string {
 	return "Amazon Web Services"
 }
 
-// Init initializes the Aws Provider Configuration like Access Token and Region
+// Init initializes the Aws Provider Configuration like Access Token and Region. An invalid configuration
+// is kept as the error of every later WhiteListIps call, so that syncs fail instead of doing nothing
 func (a *Aws) Init(params map[interface{}]interface{}, clientSet clientset.Interface) error {
+	a.initErr = a.configure(params, clientSet)
+	if a.initErr != nil {
+		a.targets = nil
+	}
+	return a.initErr
+}
+
+func (a *Aws) configure(params map[interface{}]interface{}, clientSet clientset.Interface) error {
 	a.ClientSet = clientSet
 	err := mapstructure.Decode(params, &a) //Converts the params to Aws struct fields
 	if err != nil {
 		return err
 	}
-	if a.RoleArn == "" || a.Region == "" {
-		return errors.New("missing Aws Assume Role ARN or Region")
+
+	if a.PrefixListMaxEntries < 0 {
+		return fmt.Errorf("invalid Aws PrefixListMaxEntries %d", a.PrefixListMaxEntries)
+	}
+	if a.RulesPerGroup < 0 {
+		return fmt.Errorf("invalid Aws RulesPerGroup %d", a.RulesPerGroup)
+	}
+	if a.OverflowGroups < 0 {
+		return fmt.Errorf("invalid Aws OverflowGroups %d", a.OverflowGroups)
+	}
+	if a.CreateOverflowGroups && a.OverflowGroups == 0 {
+		return errors.New("missing Aws OverflowGroups to create")
+	}
+	if a.NetworkAclRuleStart == 0 {
+		a.NetworkAclRuleStart = defaultNetworkAclRuleStart
+	}
+	if a.NetworkAclRuleEnd == 0 {
+		a.NetworkAclRuleEnd = defaultNetworkAclRuleEnd
+	}
+	if a.NetworkAclRuleStart < 1 || a.NetworkAclRuleStart > maxNetworkAclRuleNumber {
+		return fmt.Errorf("invalid Aws NetworkAclRuleStart %d", a.NetworkAclRuleStart)
+	}
+	if a.NetworkAclRuleEnd < a.NetworkAclRuleStart || a.NetworkAclRuleEnd > maxNetworkAclRuleNumber {
+		return fmt.Errorf("invalid Aws NetworkAclRuleEnd %d", a.NetworkAclRuleEnd)
+	}
+
+	targets := a.Targets
+	if len(targets) == 0 {
+		if a.Region == "" {
+			return errors.New("missing Aws Region")
+		}
+		targets = []Target{{Region: a.Region}}
+	}
+	a.targets = nil
+	for i, configTarget := range targets {
+		if configTarget.Region == "" {
+			return fmt.Errorf("missing Aws Region of target %d", i+1)
+		}
+		options := a.Options
+		if configTarget.RoleArn != "" {
+			options.RoleArn = configTarget.RoleArn
+		}
+		if configTarget.ExternalID != "" {
+			options.ExternalID = configTarget.ExternalID
+		}
+		configTarget.RoleArn = options.RoleArn
+		if configTarget.Direction == "" {
+			configTarget.Direction = a.Direction
+		}
+		if configTarget.Direction == "" {
+			configTarget.Direction = Ingress
+		}
+		if configTarget.Direction != Ingress && configTarget.Direction != Egress {
+			return fmt.Errorf("invalid Aws Direction %s of target %d", configTarget.Direction, i+1)
+		}
+		if err := options.Validate(); err != nil {
+			return err
+		}
+		a.targets = append(a.targets, &target{Target: configTarget, options: options})
 	}
 	return nil
 }
 
-// WhiteListIps - Get List of IP addresses to whitelist
+// GetTargetGroups returns the ids of security groups or network acls updated by the last WhiteListIps call
+func (a *Aws) GetTargetGroups() []string {
+	return a.targetGroups
+}
+
+// WhiteListIps - Get List of IP addresses to whitelist. The targets are reconciled concurrently, a
+// target that fails does not stop the others
 func (a *Aws) WhiteListIps(filter config.Filter, ipPermissions []utils.IpPermission) error {
+	a.targetGroups = nil
+	if a.initErr != nil {
+		return fmt.Errorf("Invalid aws provider configuration : %v", a.initErr)
+	}
+
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	var failures []string
+	for _, t := range a.targets {
+		waitGroup.Add(1)
+		go func(t *target) {
+			defer waitGroup.Done()
+			targetGroups, err := a.whiteListTargetIps(t, filter, ipPermissions)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			a.targetGroups = append(a.targetGroups, targetGroups...)
+			if err != nil {
+				logrus.Errorf("Error whitelisting ips in %s : %v", t, err)
+				failures = append(failures, fmt.Sprintf("%s : %v", t, err))
+				return
+			}
+			logrus.Infof("Whitelisted ips in %d %s in %s", len(targetGroups), getResourceName(filter), t)
+		}(t)
+	}
+	waitGroup.Wait()
 
-	// Initial credentials loaded from SDK's default credential chain. Such as
-	// the environment, shared credentials (~/.aws/credentials), or EC2 Instance
-	// Role. These credentials will be used to to make the STS Assume Role API.
-	awsSession, err := session.NewSession()
+	if len(failures) > 0 {
+		return fmt.Errorf("Failed to whitelist ips in %d of %d aws targets : %s",
+			len(failures), len(a.targets), strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// whiteListTargetIps updates the security groups or network acls of a target and returns the ids of the
+// updated ones
+func (a *Aws) whiteListTargetIps(t *target, filter config.Filter, ipPermissions []utils.IpPermission) ([]string, error) {
+	err := t.connect()
 	if err != nil {
-		logrus.Errorf("%v", err)
-		return err
+		return nil, err
 	}
 
-	// Create the credentials from AssumeRoleProvider to assume the role
-	// referenced by the "myRoleARN" ARN.
-	roleCredentials := stscreds.NewCredentials(awsSession, a.RoleArn)
-	securityGroups, err := a.fetchSecurityGroup(awsSession, roleCredentials, filter)
+	if filter.FilterType == config.NetworkAcl {
+		return a.whiteListTargetNetworkAclIps(t, filter, ipPermissions)
+	}
 
+	securityGroups, err := a.fetchSecurityGroup(t, filter)
 	if err != nil {
-		logrus.Errorf("%v", err)
-		return err
+		return nil, err
+	}
+	if len(securityGroups) == 0 {
+		return nil, errors.New("No security groups match the filter")
 	}
 
-	if len(securityGroups) != 1 {
-		logrus.Errorf("FIX ME : %v", securityGroups)
-		return nil
+	ec2IpPermissions := getEc2IpPermissions(ipPermissions)
+	managedPrefixLists := map[string]*ec2.ManagedPrefixList{}
+	if a.PrefixListName != "" {
+		ec2IpPermissions, managedPrefixLists, err = a.syncPrefixLists(t, ec2IpPermissions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rulesPerGroup := a.getRulesPerGroup(t)
+	var targetGroups []string
+	for _, securityGroup := range securityGroups {
+		updatedGroups, err := a.whiteListSecurityGroupIps(t, securityGroup, ec2IpPermissions, managedPrefixLists, rulesPerGroup)
+		targetGroups = append(targetGroups, updatedGroups...)
+		if err != nil {
+			return targetGroups, err
+		}
+	}
+	return targetGroups, nil
+}
+
+// whiteListTargetNetworkAclIps updates the network acls of a target and returns the ids of the updated
+// network acls
+func (a *Aws) whiteListTargetNetworkAclIps(t *target, filter config.Filter, ipPermissions []utils.IpPermission) ([]string, error) {
+	networkAcls, err := a.getNetworkAclsByFilter(t, filter)
+	if err != nil {
+		return nil, err
 	}
 
 	ec2IpPermissions := getEc2IpPermissions(ipPermissions)
+	var updatedNetworkAcls []string
+	var failures []string
+	for _, networkAcl := range networkAcls {
+		if err := a.whiteListNetworkAclIps(t, networkAcl, ec2IpPermissions); err != nil {
+			logrus.Errorf("%v", err)
+			failures = append(failures, err.Error())
+			continue
+		}
+		updatedNetworkAcls = append(updatedNetworkAcls, *networkAcl.NetworkAclId)
+	}
+	if len(failures) > 0 {
+		return updatedNetworkAcls, errors.New(strings.Join(failures, ", "))
+	}
+	return updatedNetworkAcls, nil
+}
 
-	ec2Client := ec2.New(awsSession, &aws.Config{
-		Credentials: roleCredentials,
-		Region:      aws.String(a.Region),
-	})
+// whiteListSecurityGroupIps spreads the rules over the security group and its overflow groups, creating
+// overflow groups if the rules do not fit and it is allowed, and returns the ids of the updated groups. It
+// fails if some of the rules fit in none of the groups, after updating the groups with the rules that fit
+func (a *Aws) whiteListSecurityGroupIps(t *target, securityGroup *ec2.SecurityGroup, ipPermissions []*ec2.IpPermission,
+	managedPrefixLists map[string]*ec2.ManagedPrefixList, rulesPerGroup int) ([]string, error) {
 
-	for _, securityGroup := range securityGroups {
-		err := a.updateSecurityGroup(ec2Client, securityGroup, ec2IpPermissions)
+	overflowGroups, err := a.getOverflowGroups(t.ec2Client, securityGroup)
+	if err != nil {
+		return nil, err
+	}
+	securityGroups := append([]*ec2.SecurityGroup{securityGroup}, overflowGroups...)
+	rules := getRules(ipPermissions, managedPrefixLists)
+	wanted := map[string]bool{}
+	for _, r := range rules {
+		wanted[r.key()] = true
+	}
+	assigned, unassigned := a.shardRules(securityGroups, t.Direction, rules, managedPrefixLists, rulesPerGroup)
+	for len(unassigned) > 0 && a.CreateOverflowGroups && len(securityGroups) <= a.OverflowGroups {
+		overflowGroup, err := createOverflowGroup(t.ec2Client, securityGroup, len(securityGroups))
 		if err != nil {
+			return nil, err
+		}
+		securityGroups = append(securityGroups, overflowGroup)
+		assigned, unassigned = a.shardRules(securityGroups, t.Direction, rules, managedPrefixLists, rulesPerGroup)
+	}
+
+	var failures []string
+	if a.CreateOverflowGroups && len(securityGroups) > 1 {
+		if err := attachOverflowGroups(t.ec2Client, securityGroup, securityGroups[1:]); err != nil {
 			logrus.Errorf("%v", err)
+			failures = append(failures, err.Error())
 		}
 	}
+
+	var updatedGroups []string
+	for i, group := range securityGroups {
+		groupIpPermissions := getSecurityGroupIpPermissions(group, t.Direction)
+		setSecurityGroupIpPermissions(group, t.Direction, a.filterReferences(groupIpPermissions, managedPrefixLists, wanted))
+		err := a.updateSecurityGroup(t.ec2Client, group, t.Direction, getIpPermissions(assigned[i]))
+		if err != nil {
+			logrus.Errorf("%v", err)
+			failures = append(failures, err.Error())
+		} else {
+			updatedGroups = append(updatedGroups, *group.GroupId)
+		}
+	}
+
+	if len(unassigned) > 0 {
+		failures = append(failures, fmt.Sprintf("No room for %d of %d rules in security group %s and %d overflow groups "+
+			"of %d rules, raise the quota of rules per security group or allow more OverflowGroups",
+			len(unassigned), len(rules), *securityGroup.GroupId, len(securityGroups)-1, rulesPerGroup))
+	}
+	if len(failures) > 0 {
+		return updatedGroups, errors.New(strings.Join(failures, ", "))
+	}
+	return updatedGroups, nil
+}
+
+// connect creates the clients on the first sync, later syncs reuse them. The clients refresh the
+// credentials of the assumed role before they expire
+func (t *target) connect() error {
+	if t.ec2Client != nil {
+		return nil
+	}
+	awsSession, roleCredentials, err := t.options.GetSession(t.Region)
+	if err != nil {
+		return err
+	}
+	t.ec2Client = ec2.New(awsSession, t.options.GetEc2Config(roleCredentials, t.Region))
+	t.elbClient = elb.New(awsSession, t.options.GetElbConfig(roleCredentials, t.Region))
+	t.quotasClient = servicequotas.New(awsSession, t.options.GetQuotasConfig(roleCredentials, t.Region))
 	return nil
 }
+
+// getResourceName returns the name of the resources whitelisted with the filter for logs
+func getResourceName(filter config.Filter) string {
+	if filter.FilterType == config.NetworkAcl {
+		return "network acls"
+	}
+	return "security groups"
+}
+
+// String returns the role and region of the target for logs
+func (t *target) String() string {
+	if t.RoleArn == "" {
+		return t.Region
+	}
+	return t.RoleArn + " in " + t.Region
+}
@@ -0,0 +1,1190 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/servicequotas"
+	"github.com/aws/aws-sdk-go/service/servicequotas/servicequotasiface"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/stakater/Whitelister/internal/pkg/config"
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+)
+
+var (
+	roleArn      = "arn:aws:iam::111111111111:role/whitelister"
+	otherRoleArn = "arn:aws:iam::222222222222:role/whitelister"
+)
+
+// fakeEc2 returns a fixed security group unless groupId is empty, or the groups of otherGroupIds and the
+// overflow groups too, or fails if err is set, and records the filters of the security groups and the added and removed rules. It keeps managed prefix lists, overflow groups, network interfaces and a network acl in memory
+type fakeEc2 struct {
+	ec2iface.EC2API
+	groupId             string
+	otherGroupIds       []string
+	groupFilters        []*ec2.Filter
+	ipPermissions       []*ec2.IpPermission
+	ipPermissionsEgress []*ec2.IpPermission
+	err                 error
+	added               []*ec2.IpPermission
+	addedCidrs          map[string][]string
+	removed             []*ec2.IpPermission
+	addedEgress         []*ec2.IpPermission
+	removedEgress       map[string][]*ec2.IpPermission
+	prefixLists         map[string]*fakePrefixList
+	modifications       []string
+	overflowGroups      []*ec2.SecurityGroup
+	networkInterfaces   []*ec2.NetworkInterface
+	networkAcl          *ec2.NetworkAcl
+	networkAclChanges   []string
+	authorizeErr        error
+}
+
+// fakeQuotas returns the quota of rules per security group, or fails if err is set
+type fakeQuotas struct {
+	servicequotasiface.ServiceQuotasAPI
+	value float64
+	err   error
+	calls int
+}
+
+func (f *fakeQuotas) GetServiceQuota(input *servicequotas.GetServiceQuotaInput) (*servicequotas.GetServiceQuotaOutput, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &servicequotas.GetServiceQuotaOutput{Quota: &servicequotas.ServiceQuota{
+		QuotaCode: input.QuotaCode, Value: aws.Float64(f.value),
+	}}, nil
+}
+
+type fakePrefixList struct {
+	prefixList *ec2.ManagedPrefixList
+	entries    map[string]string
+}
+
+func (f *fakeEc2) DescribeSecurityGroups(input *ec2.DescribeSecurityGroupsInput) (*ec2.DescribeSecurityGroupsOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if *input.Filters[0].Name == "tag:"+overflowGroupTag {
+		return &ec2.DescribeSecurityGroupsOutput{SecurityGroups: f.overflowGroups}, nil
+	}
+	f.groupFilters = input.Filters
+	var securityGroups []*ec2.SecurityGroup
+	if f.groupId != "" {
+		securityGroups = append(securityGroups, &ec2.SecurityGroup{
+			GroupId: aws.String(f.groupId), GroupName: aws.String(f.groupId),
+			IpPermissions: f.ipPermissions, IpPermissionsEgress: f.ipPermissionsEgress,
+		})
+	}
+	for _, groupId := range f.otherGroupIds {
+		securityGroups = append(securityGroups, &ec2.SecurityGroup{GroupId: aws.String(groupId), GroupName: aws.String(groupId)})
+	}
+	// Overflow groups match filters on the vpc or the ManagedBy tag
+	securityGroups = append(securityGroups, f.overflowGroups...)
+	return &ec2.DescribeSecurityGroupsOutput{SecurityGroups: securityGroups}, nil
+}
+
+// DescribeSecurityGroupsPages returns the security groups of DescribeSecurityGroups one per page
+func (f *fakeEc2) DescribeSecurityGroupsPages(input *ec2.DescribeSecurityGroupsInput,
+	fn func(*ec2.DescribeSecurityGroupsOutput, bool) bool) error {
+	output, err := f.DescribeSecurityGroups(input)
+	if err != nil {
+		return err
+	}
+	for i, securityGroup := range output.SecurityGroups {
+		lastPage := i == len(output.SecurityGroups)-1
+		if !fn(&ec2.DescribeSecurityGroupsOutput{SecurityGroups: []*ec2.SecurityGroup{securityGroup}}, lastPage) || lastPage {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeEc2) AuthorizeSecurityGroupIngress(input *ec2.AuthorizeSecurityGroupIngressInput) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	if f.authorizeErr != nil {
+		return nil, f.authorizeErr
+	}
+	f.added = append(f.added, input.IpPermissions...)
+	if f.addedCidrs == nil {
+		f.addedCidrs = map[string][]string{}
+	}
+	for _, ipPermission := range input.IpPermissions {
+		for _, ipRange := range ipPermission.IpRanges {
+			f.addedCidrs[*input.GroupId] = append(f.addedCidrs[*input.GroupId], *ipRange.CidrIp)
+		}
+		for _, ipv6Range := range ipPermission.Ipv6Ranges {
+			f.addedCidrs[*input.GroupId] = append(f.addedCidrs[*input.GroupId], *ipv6Range.CidrIpv6)
+		}
+	}
+	return &ec2.AuthorizeSecurityGroupIngressOutput{}, nil
+}
+
+func (f *fakeEc2) RevokeSecurityGroupIngress(input *ec2.RevokeSecurityGroupIngressInput) (*ec2.RevokeSecurityGroupIngressOutput, error) {
+	f.removed = append(f.removed, input.IpPermissions...)
+	return &ec2.RevokeSecurityGroupIngressOutput{}, nil
+}
+
+func (f *fakeEc2) AuthorizeSecurityGroupEgress(input *ec2.AuthorizeSecurityGroupEgressInput) (*ec2.AuthorizeSecurityGroupEgressOutput, error) {
+	f.addedEgress = append(f.addedEgress, input.IpPermissions...)
+	return &ec2.AuthorizeSecurityGroupEgressOutput{}, nil
+}
+
+func (f *fakeEc2) RevokeSecurityGroupEgress(input *ec2.RevokeSecurityGroupEgressInput) (*ec2.RevokeSecurityGroupEgressOutput, error) {
+	if f.removedEgress == nil {
+		f.removedEgress = map[string][]*ec2.IpPermission{}
+	}
+	f.removedEgress[*input.GroupId] = append(f.removedEgress[*input.GroupId], input.IpPermissions...)
+	return &ec2.RevokeSecurityGroupEgressOutput{}, nil
+}
+
+func (f *fakeEc2) CreateSecurityGroup(input *ec2.CreateSecurityGroupInput) (*ec2.CreateSecurityGroupOutput, error) {
+	id := fmt.Sprintf("sg-new-%d", len(f.overflowGroups)+1)
+	f.overflowGroups = append(f.overflowGroups, &ec2.SecurityGroup{
+		GroupId: aws.String(id), GroupName: input.GroupName, VpcId: input.VpcId, Tags: input.TagSpecifications[0].Tags,
+	})
+	return &ec2.CreateSecurityGroupOutput{GroupId: aws.String(id)}, nil
+}
+
+func (f *fakeEc2) DescribeNetworkInterfacesPages(input *ec2.DescribeNetworkInterfacesInput,
+	fn func(*ec2.DescribeNetworkInterfacesOutput, bool) bool) error {
+	fn(&ec2.DescribeNetworkInterfacesOutput{NetworkInterfaces: f.networkInterfaces}, true)
+	return nil
+}
+
+func (f *fakeEc2) ModifyNetworkInterfaceAttribute(input *ec2.ModifyNetworkInterfaceAttributeInput) (*ec2.ModifyNetworkInterfaceAttributeOutput, error) {
+	for _, networkInterface := range f.networkInterfaces {
+		if *networkInterface.NetworkInterfaceId != *input.NetworkInterfaceId {
+			continue
+		}
+		if aws.BoolValue(networkInterface.RequesterManaged) {
+			return nil, errors.New("InvalidNetworkInterface.InUse")
+		}
+		networkInterface.Groups = nil
+		for _, groupId := range input.Groups {
+			networkInterface.Groups = append(networkInterface.Groups, &ec2.GroupIdentifier{GroupId: groupId})
+		}
+	}
+	return &ec2.ModifyNetworkInterfaceAttributeOutput{}, nil
+}
+
+func (f *fakeEc2) DescribeNetworkAclsPages(input *ec2.DescribeNetworkAclsInput,
+	fn func(*ec2.DescribeNetworkAclsOutput, bool) bool) error {
+	if f.err != nil {
+		return f.err
+	}
+	fn(&ec2.DescribeNetworkAclsOutput{NetworkAcls: []*ec2.NetworkAcl{f.networkAcl}}, true)
+	return nil
+}
+
+func (f *fakeEc2) CreateNetworkAclEntry(input *ec2.CreateNetworkAclEntryInput) (*ec2.CreateNetworkAclEntryOutput, error) {
+	entry := &ec2.NetworkAclEntry{
+		RuleNumber: input.RuleNumber, Egress: input.Egress, RuleAction: input.RuleAction, Protocol: input.Protocol,
+		CidrBlock: input.CidrBlock, Ipv6CidrBlock: input.Ipv6CidrBlock, PortRange: input.PortRange, IcmpTypeCode: input.IcmpTypeCode,
+	}
+	for _, existing := range f.networkAcl.Entries {
+		if *existing.RuleNumber == *entry.RuleNumber && *existing.Egress == *entry.Egress {
+			return nil, errors.New("NetworkAclEntryAlreadyExists")
+		}
+	}
+	f.networkAcl.Entries = append(f.networkAcl.Entries, entry)
+	f.networkAclChanges = append(f.networkAclChanges, fmt.Sprintf("create %d %s", *entry.RuleNumber, getNetworkAclEntry(entry)))
+	return &ec2.CreateNetworkAclEntryOutput{}, nil
+}
+
+func (f *fakeEc2) DeleteNetworkAclEntry(input *ec2.DeleteNetworkAclEntryInput) (*ec2.DeleteNetworkAclEntryOutput, error) {
+	var entries []*ec2.NetworkAclEntry
+	for _, existing := range f.networkAcl.Entries {
+		if *existing.RuleNumber != *input.RuleNumber || *existing.Egress != *input.Egress {
+			entries = append(entries, existing)
+		}
+	}
+	f.networkAcl.Entries = entries
+	f.networkAclChanges = append(f.networkAclChanges, fmt.Sprintf("delete %d", *input.RuleNumber))
+	return &ec2.DeleteNetworkAclEntryOutput{}, nil
+}
+
+func (f *fakeEc2) DescribeManagedPrefixListsPages(input *ec2.DescribeManagedPrefixListsInput,
+	fn func(*ec2.DescribeManagedPrefixListsOutput, bool) bool) error {
+	var prefixLists []*ec2.ManagedPrefixList
+	for _, prefixList := range f.prefixLists {
+		if matched, _ := filepath.Match(*input.Filters[0].Values[0], *prefixList.prefixList.PrefixListName); matched {
+			copied := *prefixList.prefixList
+			prefixLists = append(prefixLists, &copied)
+		}
+	}
+	fn(&ec2.DescribeManagedPrefixListsOutput{PrefixLists: prefixLists}, true)
+	return nil
+}
+
+// DescribeManagedPrefixLists returns the prefix list, a change in progress completes after it was described once
+func (f *fakeEc2) DescribeManagedPrefixLists(input *ec2.DescribeManagedPrefixListsInput) (*ec2.DescribeManagedPrefixListsOutput, error) {
+	prefixList := f.prefixLists[*input.PrefixListIds[0]]
+	copied := *prefixList.prefixList
+	switch *prefixList.prefixList.State {
+	case ec2.PrefixListStateCreateInProgress:
+		prefixList.prefixList.State = aws.String(ec2.PrefixListStateCreateComplete)
+	case ec2.PrefixListStateModifyInProgress:
+		prefixList.prefixList.State = aws.String(ec2.PrefixListStateModifyComplete)
+	}
+	return &ec2.DescribeManagedPrefixListsOutput{PrefixLists: []*ec2.ManagedPrefixList{&copied}}, nil
+}
+
+func (f *fakeEc2) CreateManagedPrefixList(input *ec2.CreateManagedPrefixListInput) (*ec2.CreateManagedPrefixListOutput, error) {
+	id := fmt.Sprintf("pl-%d", len(f.prefixLists)+1)
+	prefixList := &ec2.ManagedPrefixList{
+		PrefixListId: aws.String(id), PrefixListName: input.PrefixListName, AddressFamily: input.AddressFamily,
+		MaxEntries: input.MaxEntries, Version: aws.Int64(1), State: aws.String(ec2.PrefixListStateCreateInProgress),
+	}
+	f.prefixLists[id] = &fakePrefixList{prefixList: prefixList, entries: map[string]string{}}
+	f.modifications = append(f.modifications, fmt.Sprintf("create %s %d", *input.PrefixListName, *input.MaxEntries))
+	copied := *prefixList
+	return &ec2.CreateManagedPrefixListOutput{PrefixList: &copied}, nil
+}
+
+func (f *fakeEc2) GetManagedPrefixListEntriesPages(input *ec2.GetManagedPrefixListEntriesInput,
+	fn func(*ec2.GetManagedPrefixListEntriesOutput, bool) bool) error {
+	var entries []*ec2.PrefixListEntry
+	for cidr, description := range f.prefixLists[*input.PrefixListId].entries {
+		entries = append(entries, &ec2.PrefixListEntry{Cidr: aws.String(cidr), Description: aws.String(description)})
+	}
+	fn(&ec2.GetManagedPrefixListEntriesOutput{Entries: entries}, true)
+	return nil
+}
+
+// ModifyManagedPrefixList modifies the prefix list like ec2, a resize cannot modify entries
+func (f *fakeEc2) ModifyManagedPrefixList(input *ec2.ModifyManagedPrefixListInput) (*ec2.ModifyManagedPrefixListOutput, error) {
+	fake := f.prefixLists[*input.PrefixListId]
+	prefixList := fake.prefixList
+	if *input.CurrentVersion != *prefixList.Version || *prefixList.State == ec2.PrefixListStateModifyInProgress {
+		return nil, errors.New("PrefixListVersionMismatch")
+	}
+	if input.MaxEntries != nil {
+		if len(input.AddEntries) > 0 || len(input.RemoveEntries) > 0 {
+			return nil, errors.New("Entries cannot be modified while resizing")
+		}
+		prefixList.MaxEntries = input.MaxEntries
+		f.modifications = append(f.modifications, fmt.Sprintf("resize %d", *input.MaxEntries))
+	}
+
+	if len(input.AddEntries) > maxPrefixListChanges || len(input.RemoveEntries) > maxPrefixListChanges {
+		return nil, errors.New("Too many entries")
+	}
+	for _, entry := range input.RemoveEntries {
+		delete(fake.entries, *entry.Cidr)
+	}
+	for _, entry := range input.AddEntries {
+		fake.entries[*entry.Cidr] = *entry.Description
+	}
+	if int64(len(fake.entries)) > *prefixList.MaxEntries {
+		return nil, errors.New("PrefixListMaxEntriesExceeded")
+	}
+	if len(input.AddEntries) > 0 || len(input.RemoveEntries) > 0 {
+		f.modifications = append(f.modifications, fmt.Sprintf("modify %s +%d -%d",
+			*prefixList.PrefixListName, len(input.AddEntries), len(input.RemoveEntries)))
+	}
+	prefixList.Version = aws.Int64(*prefixList.Version + 1)
+	prefixList.State = aws.String(ec2.PrefixListStateModifyInProgress)
+	return &ec2.ModifyManagedPrefixListOutput{}, nil
+}
+
+func TestAwsInit(t *testing.T) {
+	tests := []struct {
+		name        string
+		params      map[interface{}]interface{}
+		wantTargets []Target
+		wantErr     bool
+		errValue    error
+	}{
+		{
+			name:        "Init with region",
+			params:      map[interface{}]interface{}{"RoleArn": roleArn, "Region": "us-west-2"},
+			wantTargets: []Target{{RoleArn: roleArn, Region: "us-west-2", Direction: Ingress}},
+		},
+		{
+			name: "Init with targets",
+			params: map[interface{}]interface{}{
+				"RoleArn": roleArn,
+				"Targets": []map[string]interface{}{
+					{"Region": "us-west-2"},
+					{"RoleArn": otherRoleArn, "ExternalID": "whitelister", "Region": "eu-west-1"},
+				},
+			},
+			wantTargets: []Target{
+				{RoleArn: roleArn, Region: "us-west-2", Direction: Ingress},
+				{RoleArn: otherRoleArn, ExternalID: "whitelister", Region: "eu-west-1", Direction: Ingress},
+			},
+		},
+		{
+			name: "Init with directions",
+			params: map[interface{}]interface{}{
+				"Direction": "Egress",
+				"Targets":   []map[string]interface{}{{"Region": "us-west-2"}, {"Region": "eu-west-1", "Direction": "Ingress"}},
+			},
+			wantTargets: []Target{{Region: "us-west-2", Direction: Egress}, {Region: "eu-west-1", Direction: Ingress}},
+		},
+		{
+			name:     "Init with invalid direction",
+			params:   map[interface{}]interface{}{"Region": "us-west-2", "Direction": "Outbound"},
+			wantErr:  true,
+			errValue: errors.New("invalid Aws Direction Outbound of target 1"),
+		},
+		{
+			name:     "Init without region",
+			params:   map[interface{}]interface{}{"RoleArn": roleArn},
+			wantErr:  true,
+			errValue: errors.New("missing Aws Region"),
+		},
+		{
+			name: "Init with target without region",
+			params: map[interface{}]interface{}{
+				"Targets": []map[string]interface{}{{"Region": "us-west-2"}, {"RoleArn": otherRoleArn}},
+			},
+			wantErr:  true,
+			errValue: errors.New("missing Aws Region of target 2"),
+		},
+		{
+			name:     "Init with negative rules per group",
+			params:   map[interface{}]interface{}{"Region": "us-west-2", "RulesPerGroup": -1},
+			wantErr:  true,
+			errValue: errors.New("invalid Aws RulesPerGroup -1"),
+		},
+		{
+			name:     "Init creating overflow groups without overflow groups",
+			params:   map[interface{}]interface{}{"Region": "us-west-2", "CreateOverflowGroups": true},
+			wantErr:  true,
+			errValue: errors.New("missing Aws OverflowGroups to create"),
+		},
+		{
+			name:     "Init with network acl rule numbers in the wrong order",
+			params:   map[interface{}]interface{}{"Region": "us-west-2", "NetworkAclRuleStart": 50, "NetworkAclRuleEnd": 10},
+			wantErr:  true,
+			errValue: errors.New("invalid Aws NetworkAclRuleEnd 10"),
+		},
+		{
+			name: "Init with target external id without role",
+			params: map[interface{}]interface{}{
+				"Targets": []map[string]interface{}{{"ExternalID": "whitelister", "Region": "us-west-2"}},
+			},
+			wantErr:  true,
+			errValue: errors.New("Missing Aws RoleArn to assume with ExternalID, SessionName, SessionDuration or WebIdentityTokenFile"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Aws{}
+			err := a.Init(tt.params, nil)
+			if tt.wantErr {
+				if err == nil || err.Error() != tt.errValue.Error() {
+					t.Errorf("Aws.Init() Got Err: %v, Wanted Err: %v", err, tt.errValue)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Aws.Init() Got Err: %v", err)
+			}
+			var gotTargets []Target
+			for _, target := range a.targets {
+				gotTargets = append(gotTargets, target.Target)
+				if target.options.RoleArn != target.RoleArn || target.options.ExternalID != target.ExternalID {
+					t.Errorf("Got options %v for target %v", target.options, target.Target)
+				}
+			}
+			if !reflect.DeepEqual(gotTargets, tt.wantTargets) {
+				t.Errorf("Got targets = %v, wanted %v", gotTargets, tt.wantTargets)
+			}
+		})
+	}
+}
+
+func TestWhiteListIps(t *testing.T) {
+	a := &Aws{}
+	err := a.Init(map[interface{}]interface{}{
+		"RoleArn": roleArn,
+		"Targets": []map[string]interface{}{
+			{"Region": "us-west-2"}, {"Region": "eu-west-1"}, {"RoleArn": otherRoleArn, "Region": "us-west-2"},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+	clients := []*fakeEc2{
+		{groupId: "sg-1", otherGroupIds: []string{"sg-3"}, prefixLists: map[string]*fakePrefixList{}},
+		{groupId: "sg-2", prefixLists: map[string]*fakePrefixList{}},
+		{err: errors.New("UnauthorizedOperation")},
+	}
+	for i, client := range clients {
+		a.targets[i].ec2Client = client
+		a.targets[i].quotasClient = &fakeQuotas{value: 60}
+	}
+
+	port := int64(443)
+	ipPermissions := []utils.IpPermission{{
+		FromPort: &port, ToPort: &port, IpProtocol: aws.String("tcp"),
+		IpRanges: []*utils.IpRange{{IpCidr: aws.String("10.0.0.1/32"), Description: aws.String("office")}},
+	}}
+	err = a.WhiteListIps(config.Filter{FilterType: config.SecurityGroup, LabelName: "whitelister", LabelValue: "true"}, ipPermissions)
+
+	wantErr := "Failed to whitelist ips in 1 of 3 aws targets : " + otherRoleArn + " in us-west-2 : UnauthorizedOperation"
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("Got Err: %v, Wanted Err: %s", err, wantErr)
+	}
+	gotTargetGroups := a.GetTargetGroups()
+	sort.Strings(gotTargetGroups)
+	if !reflect.DeepEqual(gotTargetGroups, []string{"sg-1", "sg-2", "sg-3"}) {
+		t.Errorf("Got target groups = %v, wanted the groups of the targets that succeeded", gotTargetGroups)
+	}
+	for _, client := range clients[:2] {
+		for _, groupId := range append([]string{client.groupId}, client.otherGroupIds...) {
+			if !reflect.DeepEqual(client.addedCidrs[groupId], []string{"10.0.0.1/32"}) {
+				t.Errorf("Got added cidrs = %v in %s, wanted 10.0.0.1/32", client.addedCidrs[groupId], groupId)
+			}
+		}
+	}
+}
+
+func TestWhiteListIpsWithInvalidConfig(t *testing.T) {
+	a := &Aws{}
+	err := a.Init(map[interface{}]interface{}{"Region": "us-west-2", "Direction": "Outbound"}, nil)
+	if err == nil {
+		t.Fatalf("Got no error, wanted an invalid direction")
+	}
+
+	filter := config.Filter{FilterType: config.SecurityGroup, LabelName: "whitelister", LabelValue: "true"}
+	for sync := 1; sync <= 2; sync++ {
+		err = a.WhiteListIps(filter, nil)
+		wantErr := "Invalid aws provider configuration : invalid Aws Direction Outbound of target 1"
+		if err == nil || err.Error() != wantErr {
+			t.Errorf("Got Err: %v in sync %d, Wanted Err: %s", err, sync, wantErr)
+		}
+	}
+	if len(a.GetTargetGroups()) != 0 {
+		t.Errorf("Got target groups = %v, wanted none", a.GetTargetGroups())
+	}
+}
+
+func TestWhiteListIpsWithPrefixLists(t *testing.T) {
+	defaultMaxPrefixListChanges, defaultPrefixListPollInterval := maxPrefixListChanges, prefixListPollInterval
+	maxPrefixListChanges, prefixListPollInterval = 5, time.Millisecond
+	defer func() {
+		maxPrefixListChanges, prefixListPollInterval = defaultMaxPrefixListChanges, defaultPrefixListPollInterval
+	}()
+
+	a := &Aws{}
+	err := a.Init(map[interface{}]interface{}{
+		"Region": "us-west-2", "RemoveRule": true, "KeepRuleDescriptionPrefix": "Important: ", "PrefixListName": "whitelister",
+	}, nil)
+	if err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+
+	// The ssh prefix list has a stale entry, an entry of another owner and room for 10 entries
+	client := &fakeEc2{
+		groupId: "sg-1",
+		prefixLists: map[string]*fakePrefixList{"pl-1": {
+			prefixList: &ec2.ManagedPrefixList{
+				PrefixListId: aws.String("pl-1"), PrefixListName: aws.String("whitelister-tcp-22-22"),
+				MaxEntries: aws.Int64(10), Version: aws.Int64(3), State: aws.String(ec2.PrefixListStateModifyComplete),
+			},
+			entries: map[string]string{"10.0.0.99/32": "left", "10.0.0.1/32": "alice"},
+		}},
+		ipPermissions: []*ec2.IpPermission{{
+			FromPort: aws.Int64(22), ToPort: aws.Int64(22), IpProtocol: aws.String("tcp"),
+			IpRanges:      []*ec2.IpRange{{CidrIp: aws.String("10.0.0.1/32"), Description: aws.String("alice")}},
+			PrefixListIds: []*ec2.PrefixListId{{PrefixListId: aws.String("pl-foreign"), Description: aws.String("vpn")}},
+		}},
+	}
+	a.targets[0].ec2Client = client
+	a.targets[0].quotasClient = &fakeQuotas{value: 60}
+
+	sshPort, httpsPort := int64(22), int64(443)
+	sshPermission := utils.IpPermission{FromPort: &sshPort, ToPort: &sshPort, IpProtocol: aws.String("tcp")}
+	for i := 1; i <= 12; i++ {
+		sshPermission.IpRanges = append(sshPermission.IpRanges, &utils.IpRange{
+			IpCidr: aws.String(fmt.Sprintf("10.0.0.%d/32", i)), Description: aws.String("office"),
+		})
+	}
+	httpsPermission := utils.IpPermission{FromPort: &httpsPort, ToPort: &httpsPort, IpProtocol: aws.String("tcp"),
+		IpRanges: []*utils.IpRange{{IpCidr: aws.String("2001:db8::/64"), Description: aws.String("office")}},
+	}
+	err = a.WhiteListIps(config.Filter{FilterType: config.SecurityGroup, LabelName: "whitelister", LabelValue: "true"},
+		[]utils.IpPermission{sshPermission, httpsPermission})
+	if err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+
+	wantModifications := []string{
+		"modify whitelister-tcp-22-22 +0 -2",
+		"resize 20",
+		"modify whitelister-tcp-22-22 +5 -0",
+		"modify whitelister-tcp-22-22 +5 -0",
+		"modify whitelister-tcp-22-22 +2 -0",
+		"create whitelister-tcp-443-443-ipv6 10",
+		"modify whitelister-tcp-443-443-ipv6 +1 -0",
+	}
+	if !reflect.DeepEqual(client.modifications, wantModifications) {
+		t.Errorf("Got modifications = %v, wanted %v", client.modifications, wantModifications)
+	}
+	if entries := client.prefixLists["pl-1"].entries; len(entries) != 12 || entries["10.0.0.99/32"] != "" ||
+		entries["10.0.0.1/32"] != "office" {
+		t.Errorf("Got entries = %v, wanted the 12 office cidrs", entries)
+	}
+
+	// The ssh rule is replaced by a reference to the prefix list, the rule of the foreign prefix list is kept
+	if len(client.removed) != 1 || len(client.removed[0].PrefixListIds) != 0 || len(client.removed[0].IpRanges) != 1 {
+		t.Errorf("Got removed rules = %v, wanted the ssh cidr only", client.removed)
+	}
+	var gotPrefixListIds []string
+	for _, ipPermission := range client.added {
+		if len(ipPermission.IpRanges) != 0 || len(ipPermission.Ipv6Ranges) != 0 {
+			t.Errorf("Got added rule with cidrs = %v, wanted prefix lists only", ipPermission)
+		}
+		for _, prefixListId := range ipPermission.PrefixListIds {
+			gotPrefixListIds = append(gotPrefixListIds, fmt.Sprintf("%d:%s", *ipPermission.FromPort, *prefixListId.PrefixListId))
+		}
+	}
+	if !reflect.DeepEqual(gotPrefixListIds, []string{"22:pl-1", "443:pl-2"}) {
+		t.Errorf("Got added prefix lists = %v, wanted the ssh and https prefix lists", gotPrefixListIds)
+	}
+}
+
+func TestWhiteListIpsWithOverflowGroups(t *testing.T) {
+	sshPort := int64(22)
+	sshPermission := utils.IpPermission{FromPort: &sshPort, ToPort: &sshPort, IpProtocol: aws.String("tcp")}
+	for i := 1; i <= 12; i++ {
+		sshPermission.IpRanges = append(sshPermission.IpRanges, &utils.IpRange{
+			IpCidr: aws.String(fmt.Sprintf("10.0.0.%d/32", i)), Description: aws.String("office"),
+		})
+	}
+	sshPermission.IpRanges = append(sshPermission.IpRanges, &utils.IpRange{
+		IpCidr: aws.String("2001:db8::/64"), Description: aws.String("office"),
+	})
+	filter := config.Filter{FilterType: config.SecurityGroup, LabelName: "whitelister", LabelValue: "true"}
+
+	// The security group has a kept rule and 3 of the cidrs, an overflow group tagged by the user has a stale cidr
+	newClient := func() *fakeEc2 {
+		return &fakeEc2{
+			groupId: "sg-1",
+			ipPermissions: []*ec2.IpPermission{{
+				FromPort: aws.Int64(22), ToPort: aws.Int64(22), IpProtocol: aws.String("tcp"),
+				IpRanges: []*ec2.IpRange{
+					{CidrIp: aws.String("10.1.0.0/16"), Description: aws.String("Important: vpn")},
+					{CidrIp: aws.String("10.0.0.1/32"), Description: aws.String("office")},
+					{CidrIp: aws.String("10.0.0.2/32"), Description: aws.String("office")},
+					{CidrIp: aws.String("10.0.0.3/32"), Description: aws.String("office")},
+				},
+			}},
+			overflowGroups: []*ec2.SecurityGroup{{
+				GroupId: aws.String("sg-2"), GroupName: aws.String("sg-1-overflow-1"),
+				Tags: []*ec2.Tag{{Key: aws.String(overflowGroupTag), Value: aws.String("sg-1")}},
+				IpPermissions: []*ec2.IpPermission{{
+					FromPort: aws.Int64(22), ToPort: aws.Int64(22), IpProtocol: aws.String("tcp"),
+					IpRanges: []*ec2.IpRange{{CidrIp: aws.String("10.0.0.99/32"), Description: aws.String("left")}},
+				}},
+			}},
+			networkInterfaces: []*ec2.NetworkInterface{
+				{NetworkInterfaceId: aws.String("eni-1"), Groups: []*ec2.GroupIdentifier{{GroupId: aws.String("sg-1")}}},
+				{NetworkInterfaceId: aws.String("eni-2"), RequesterManaged: aws.Bool(true), RequesterId: aws.String("amazon-elb"),
+					Groups: []*ec2.GroupIdentifier{{GroupId: aws.String("sg-1")}}},
+			},
+		}
+	}
+
+	t.Run("create overflow group", func(t *testing.T) {
+		a := &Aws{}
+		err := a.Init(map[interface{}]interface{}{
+			"Region": "us-west-2", "RemoveRule": true, "KeepRuleDescriptionPrefix": "Important: ",
+			"OverflowGroups": 2, "CreateOverflowGroups": true,
+		}, nil)
+		if err != nil {
+			t.Fatalf("Got Err: %v", err)
+		}
+		client := newClient()
+		quotas := &fakeQuotas{value: 5}
+		a.targets[0].ec2Client = client
+		a.targets[0].quotasClient = quotas
+
+		if err := a.WhiteListIps(filter, []utils.IpPermission{sshPermission}); err != nil {
+			t.Fatalf("Got Err: %v", err)
+		}
+
+		// The kept rule leaves room for 4 ipv4 rules in sg-1, the cidrs it has stay there
+		wantCidrs := map[string][]string{
+			"sg-1":     {"10.0.0.1/32", "10.0.0.2/32", "10.0.0.3/32", "10.0.0.4/32", "2001:db8::/64"},
+			"sg-2":     {"10.0.0.5/32", "10.0.0.6/32", "10.0.0.7/32", "10.0.0.8/32", "10.0.0.9/32"},
+			"sg-new-2": {"10.0.0.10/32", "10.0.0.11/32", "10.0.0.12/32"},
+		}
+		if !reflect.DeepEqual(client.addedCidrs, wantCidrs) {
+			t.Errorf("Got added cidrs = %v, wanted %v", client.addedCidrs, wantCidrs)
+		}
+		if len(client.removedEgress["sg-new-2"]) != 1 || *client.removedEgress["sg-new-2"][0].IpRanges[0].CidrIp != "0.0.0.0/0" {
+			t.Errorf("Got removed outbound rules = %v, wanted the default outbound rule of the created group revoked", client.removedEgress)
+		}
+		created := client.overflowGroups[1]
+		if *created.GroupName != "sg-1-overflow-2" || *created.Tags[0].Key != overflowGroupTag || *created.Tags[0].Value != "sg-1" {
+			t.Errorf("Got created group %v, wanted the second overflow group of sg-1", created)
+		}
+		if !reflect.DeepEqual(a.GetTargetGroups(), []string{"sg-1", "sg-2", "sg-new-2"}) {
+			t.Errorf("Got target groups = %v, wanted the security group and its overflow groups", a.GetTargetGroups())
+		}
+
+		var gotGroups []string
+		for _, group := range client.networkInterfaces[0].Groups {
+			gotGroups = append(gotGroups, *group.GroupId)
+		}
+		if !reflect.DeepEqual(gotGroups, []string{"sg-1", "sg-2", "sg-new-2"}) {
+			t.Errorf("Got groups of eni-1 = %v, wanted the overflow groups attached", gotGroups)
+		}
+		if len(client.networkInterfaces[1].Groups) != 1 {
+			t.Errorf("Got groups of eni-2 = %v, wanted the requester managed interface untouched", client.networkInterfaces[1].Groups)
+		}
+
+		// The quota is read once
+		if err := a.WhiteListIps(filter, []utils.IpPermission{sshPermission}); err != nil {
+			t.Fatalf("Got Err: %v", err)
+		}
+		if quotas.calls != 1 {
+			t.Errorf("Got %d quota calls, wanted 1", quotas.calls)
+		}
+	})
+
+	t.Run("capacity exhausted", func(t *testing.T) {
+		a := &Aws{}
+		err := a.Init(map[interface{}]interface{}{
+			"Region": "us-west-2", "RemoveRule": true, "KeepRuleDescriptionPrefix": "Important: ",
+			"RulesPerGroup": 5, "OverflowGroups": 1,
+		}, nil)
+		if err != nil {
+			t.Fatalf("Got Err: %v", err)
+		}
+		client := newClient()
+		a.targets[0].ec2Client = client
+
+		err = a.WhiteListIps(filter, []utils.IpPermission{sshPermission})
+		wantErr := "Failed to whitelist ips in 1 of 1 aws targets : us-west-2 : No room for 3 of 13 rules in security " +
+			"group sg-1 and 1 overflow groups of 5 rules, raise the quota of rules per security group or allow more OverflowGroups"
+		if err == nil || err.Error() != wantErr {
+			t.Errorf("Got Err: %v, Wanted Err: %s", err, wantErr)
+		}
+		// The rules that fit are whitelisted
+		if len(client.addedCidrs["sg-1"]) != 5 || len(client.addedCidrs["sg-2"]) != 5 || len(client.overflowGroups) != 1 {
+			t.Errorf("Got added cidrs = %v, wanted the groups filled without creating overflow groups", client.addedCidrs)
+		}
+		if !reflect.DeepEqual(a.GetTargetGroups(), []string{"sg-1", "sg-2"}) {
+			t.Errorf("Got target groups = %v, wanted the security group and its overflow group", a.GetTargetGroups())
+		}
+	})
+}
+
+func TestGetRulesPerGroup(t *testing.T) {
+	tests := []struct {
+		name          string
+		rulesPerGroup int
+		quotas        *fakeQuotas
+		want          int
+	}{
+		{
+			name:          "configured",
+			rulesPerGroup: 100,
+			quotas:        &fakeQuotas{value: 200},
+			want:          100,
+		},
+		{
+			name:   "read from service quotas",
+			quotas: &fakeQuotas{value: 200},
+			want:   200,
+		},
+		{
+			name:   "default when service quotas fails",
+			quotas: &fakeQuotas{err: errors.New("AccessDeniedException")},
+			want:   defaultRulesPerGroup,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Aws{RulesPerGroup: tt.rulesPerGroup}
+			target := &target{Target: Target{Region: "us-west-2"}, quotasClient: tt.quotas}
+			if got := a.getRulesPerGroup(target); got != tt.want {
+				t.Errorf("Got = %d, wanted %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhiteListIpsEgress(t *testing.T) {
+	a := &Aws{}
+	err := a.Init(map[interface{}]interface{}{
+		"Region": "us-west-2", "RemoveRule": true, "KeepRuleDescriptionPrefix": "Important: ", "Direction": "Egress",
+	}, nil)
+	if err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+
+	// The default outbound rule is replaced by the partner endpoint, the kept dns rule and the inbound rules stay
+	client := &fakeEc2{
+		groupId: "sg-1",
+		ipPermissions: []*ec2.IpPermission{{
+			FromPort: aws.Int64(22), ToPort: aws.Int64(22), IpProtocol: aws.String("tcp"),
+			IpRanges: []*ec2.IpRange{{CidrIp: aws.String("10.0.0.1/32"), Description: aws.String("office")}},
+		}},
+		ipPermissionsEgress: []*ec2.IpPermission{
+			{IpProtocol: aws.String("-1"), IpRanges: []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}}},
+			{
+				FromPort: aws.Int64(53), ToPort: aws.Int64(53), IpProtocol: aws.String("udp"),
+				IpRanges: []*ec2.IpRange{{CidrIp: aws.String("10.0.0.2/32"), Description: aws.String("Important: dns")}},
+			},
+		},
+	}
+	a.targets[0].ec2Client = client
+	a.targets[0].quotasClient = &fakeQuotas{value: 60}
+
+	port := int64(443)
+	err = a.WhiteListIps(config.Filter{FilterType: config.SecurityGroup, LabelName: "whitelister", LabelValue: "true"},
+		[]utils.IpPermission{{
+			FromPort: &port, ToPort: &port, IpProtocol: aws.String("tcp"),
+			IpRanges: []*utils.IpRange{{IpCidr: aws.String("192.0.2.10/32"), Description: aws.String("partner")}},
+		}})
+	if err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+
+	if len(client.added) != 0 || len(client.removed) != 0 {
+		t.Errorf("Got added = %v and removed = %v inbound rules, wanted none", client.added, client.removed)
+	}
+	if len(client.addedEgress) != 1 || *client.addedEgress[0].IpRanges[0].CidrIp != "192.0.2.10/32" {
+		t.Errorf("Got added outbound rules = %v, wanted the partner rule", client.addedEgress)
+	}
+	removed := client.removedEgress["sg-1"]
+	if len(removed) != 1 || *removed[0].IpProtocol != "-1" {
+		t.Errorf("Got removed outbound rules = %v, wanted the default outbound rule", removed)
+	}
+}
+
+func TestWhiteListIpsWithReferences(t *testing.T) {
+	port := int64(443)
+	office := &ec2.IpRange{CidrIp: aws.String("10.0.0.1/32"), Description: aws.String("office")}
+	ciRunners := &ec2.UserIdGroupPair{GroupId: aws.String("sg-ci"), UserId: aws.String("111111111111"), Description: aws.String("CI runners")}
+	loadBalancer := &ec2.UserIdGroupPair{GroupId: aws.String("sg-elb"), UserId: aws.String("111111111111")}
+	keptLoadBalancer := &ec2.UserIdGroupPair{GroupId: aws.String("sg-nlb"), Description: aws.String("Important: nlb")}
+	ipPermissions := []utils.IpPermission{{
+		FromPort: &port, ToPort: &port, IpProtocol: aws.String("tcp"),
+		IpRanges:         []*utils.IpRange{{IpCidr: aws.String("10.0.0.1/32"), Description: aws.String("office")}},
+		UserIdGroupPairs: []*utils.UserIdGroupPair{{GroupId: aws.String("sg-ci"), Description: aws.String("CI runners")}},
+	}}
+
+	tests := []struct {
+		name              string
+		removeReferences  bool
+		userIdGroupPairs  []*ec2.UserIdGroupPair
+		wantAdded         bool
+		wantRemovedGroups []string
+	}{
+		{
+			name:             "security group added without removing other security groups",
+			userIdGroupPairs: []*ec2.UserIdGroupPair{loadBalancer},
+			wantAdded:        true,
+		},
+		{
+			name:             "security group already whitelisted",
+			userIdGroupPairs: []*ec2.UserIdGroupPair{ciRunners, loadBalancer},
+		},
+		{
+			name:              "other security groups removed",
+			removeReferences:  true,
+			userIdGroupPairs:  []*ec2.UserIdGroupPair{loadBalancer, keptLoadBalancer},
+			wantAdded:         true,
+			wantRemovedGroups: []string{"sg-elb"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Aws{}
+			err := a.Init(map[interface{}]interface{}{
+				"Region": "us-west-2", "RemoveRule": true, "KeepRuleDescriptionPrefix": "Important: ",
+				"RemoveReferences": tt.removeReferences,
+			}, nil)
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			client := &fakeEc2{
+				groupId: "sg-1",
+				ipPermissions: []*ec2.IpPermission{{
+					FromPort: aws.Int64(443), ToPort: aws.Int64(443), IpProtocol: aws.String("tcp"),
+					IpRanges: []*ec2.IpRange{office}, UserIdGroupPairs: tt.userIdGroupPairs,
+				}},
+			}
+			a.targets[0].ec2Client = client
+			a.targets[0].quotasClient = &fakeQuotas{value: 60}
+
+			err = a.WhiteListIps(config.Filter{FilterType: config.SecurityGroup, LabelName: "whitelister", LabelValue: "true"}, ipPermissions)
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+
+			if gotAdded := len(client.added) > 0; gotAdded != tt.wantAdded {
+				t.Errorf("Got added rules = %v, wanted added %v", client.added, tt.wantAdded)
+			}
+			if tt.wantAdded && (len(client.added) != 1 || len(client.added[0].UserIdGroupPairs) != 1 ||
+				*client.added[0].UserIdGroupPairs[0].GroupId != "sg-ci") {
+				t.Errorf("Got added rules = %v, wanted the office and the CI runners", client.added)
+			}
+			var gotRemovedGroups []string
+			for _, ipPermission := range client.removed {
+				for _, userIdGroupPair := range ipPermission.UserIdGroupPairs {
+					gotRemovedGroups = append(gotRemovedGroups, *userIdGroupPair.GroupId)
+				}
+			}
+			if !reflect.DeepEqual(gotRemovedGroups, tt.wantRemovedGroups) {
+				t.Errorf("Got removed security groups = %v, wanted %v", gotRemovedGroups, tt.wantRemovedGroups)
+			}
+		})
+	}
+}
+
+func TestWhiteListIpsWithNetworkAcls(t *testing.T) {
+	entry := func(ruleNumber int64, egress bool, ruleAction string, cidr string) *ec2.NetworkAclEntry {
+		return &ec2.NetworkAclEntry{
+			RuleNumber: aws.Int64(ruleNumber), Egress: aws.Bool(egress), RuleAction: aws.String(ruleAction),
+			Protocol: aws.String("6"), CidrBlock: aws.String(cidr), PortRange: &ec2.PortRange{From: aws.Int64(443), To: aws.Int64(443)},
+		}
+	}
+	defaultEntries := []*ec2.NetworkAclEntry{
+		{RuleNumber: aws.Int64(100), Egress: aws.Bool(false), RuleAction: aws.String("allow"), Protocol: aws.String("-1"), CidrBlock: aws.String("0.0.0.0/0")},
+		{RuleNumber: aws.Int64(32767), Egress: aws.Bool(false), RuleAction: aws.String("deny"), Protocol: aws.String("-1"), CidrBlock: aws.String("0.0.0.0/0")},
+		entry(2, true, "allow", "10.0.0.9/32"),
+	}
+	port := int64(443)
+	ipPermissions := []utils.IpPermission{{
+		FromPort: &port, ToPort: &port, IpProtocol: aws.String("tcp"),
+		IpRanges: []*utils.IpRange{
+			{IpCidr: aws.String("10.0.0.1/32"), Description: aws.String("office")},
+			{IpCidr: aws.String("10.0.0.2/32"), Description: aws.String("vpn")},
+		},
+	}}
+
+	tests := []struct {
+		name        string
+		removeRule  bool
+		ruleEnd     int
+		entries     []*ec2.NetworkAclEntry
+		wantChanges []string
+		wantErr     string
+	}{
+		{
+			name:       "entries added to an empty network acl",
+			removeRule: true,
+			wantChanges: []string{
+				"create 1 allow 6/443-443 10.0.0.1/32", "create 2 allow 6/443-443 10.0.0.2/32", "create 10 deny 6/443-443 0.0.0.0/0",
+			},
+		},
+		{
+			name:        "entries already whitelisted",
+			removeRule:  true,
+			entries:     []*ec2.NetworkAclEntry{entry(3, false, "allow", "10.0.0.1/32"), entry(5, false, "allow", "10.0.0.2/32"), entry(8, false, "deny", "0.0.0.0/0")},
+			wantChanges: nil,
+		},
+		{
+			name:        "entry replaced",
+			removeRule:  true,
+			entries:     []*ec2.NetworkAclEntry{entry(1, false, "allow", "10.0.0.1/32"), entry(2, false, "allow", "10.0.0.3/32"), entry(10, false, "deny", "0.0.0.0/0")},
+			wantChanges: []string{"delete 2", "create 2 allow 6/443-443 10.0.0.2/32"},
+		},
+		{
+			name:        "entry kept without RemoveRule",
+			entries:     []*ec2.NetworkAclEntry{entry(1, false, "allow", "10.0.0.1/32"), entry(2, false, "allow", "10.0.0.3/32"), entry(10, false, "deny", "0.0.0.0/0")},
+			wantChanges: []string{"create 3 allow 6/443-443 10.0.0.2/32"},
+		},
+		{
+			name:        "deny entry moved after the allow entries",
+			removeRule:  true,
+			entries:     []*ec2.NetworkAclEntry{entry(1, false, "allow", "10.0.0.1/32"), entry(2, false, "deny", "0.0.0.0/0")},
+			wantChanges: []string{"create 3 allow 6/443-443 10.0.0.2/32", "create 10 deny 6/443-443 0.0.0.0/0", "delete 2"},
+		},
+		{
+			name:       "no room for the entries",
+			removeRule: true,
+			ruleEnd:    2,
+			wantErr:    "No room for 1 of 3 entries in rule numbers 1 to 2 of network acl acl-1, raise NetworkAclRuleEnd or lower NetworkAclRuleStart",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruleEnd := tt.ruleEnd
+			if ruleEnd == 0 {
+				ruleEnd = 10
+			}
+			a := &Aws{}
+			err := a.Init(map[interface{}]interface{}{
+				"Region": "us-west-2", "RemoveRule": tt.removeRule, "NetworkAclRuleEnd": ruleEnd,
+			}, nil)
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			client := &fakeEc2{networkAcl: &ec2.NetworkAcl{
+				NetworkAclId: aws.String("acl-1"),
+				Entries:      append(append([]*ec2.NetworkAclEntry{}, defaultEntries...), tt.entries...),
+			}}
+			a.targets[0].ec2Client = client
+
+			err = a.WhiteListIps(config.Filter{FilterType: config.NetworkAcl, LabelName: "whitelister", LabelValue: "true"}, ipPermissions)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Got Err: %v, Wanted Err: %s", err, tt.wantErr)
+				}
+				if len(client.networkAclChanges) > 0 {
+					t.Errorf("Got changes = %v, wanted none", client.networkAclChanges)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			if !reflect.DeepEqual(client.networkAclChanges, tt.wantChanges) {
+				t.Errorf("Got changes = %v, wanted %v", client.networkAclChanges, tt.wantChanges)
+			}
+			if !reflect.DeepEqual(a.GetTargetGroups(), []string{"acl-1"}) {
+				t.Errorf("Got target groups = %v, wanted the network acl", a.GetTargetGroups())
+			}
+		})
+	}
+}
+
+func TestGetSecurityGroupFilters(t *testing.T) {
+	tests := []struct {
+		name        string
+		filter      config.Filter
+		wantFilters map[string][]string
+		wantErr     bool
+	}{
+		{
+			name:        "filter by label",
+			filter:      config.Filter{LabelName: "whitelister", LabelValue: "true"},
+			wantFilters: map[string][]string{"tag:whitelister": {"true"}},
+		},
+		{
+			name: "filter by ids, names, tags, tag keys and vpc",
+			filter: config.Filter{
+				GroupIds: []string{"sg-1", "sg-2"}, GroupNames: []string{"web"},
+				Tags: map[string]string{"team": "payments", "env": "production"}, TagKeys: []string{"whitelister"},
+				VpcId: "vpc-1",
+			},
+			wantFilters: map[string][]string{
+				"group-id": {"sg-1", "sg-2"}, "group-name": {"web"}, "tag:env": {"production"}, "tag:team": {"payments"},
+				"tag-key": {"whitelister"}, "vpc-id": {"vpc-1"},
+			},
+		},
+		{
+			name:    "filter without conditions",
+			filter:  config.Filter{FilterType: config.SecurityGroup},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := (&Aws{}).getSecurityGroupFilters(tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Got Err: %v, wanted error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			gotFilters := map[string][]string{}
+			for _, filter := range filters {
+				if _, exists := gotFilters[*filter.Name]; exists {
+					t.Errorf("Got filter %s twice, the values of a filter match any of them", *filter.Name)
+				}
+				gotFilters[*filter.Name] = aws.StringValueSlice(filter.Values)
+			}
+			if !reflect.DeepEqual(gotFilters, tt.wantFilters) {
+				t.Errorf("Got filters = %v, wanted %v", gotFilters, tt.wantFilters)
+			}
+		})
+	}
+}
+
+func TestGetNetworkAclFilters(t *testing.T) {
+	tests := []struct {
+		name        string
+		filter      config.Filter
+		wantFilters map[string][]string
+		wantErr     string
+	}{
+		{
+			name:        "filter by label",
+			filter:      config.Filter{LabelName: "whitelister", LabelValue: "true"},
+			wantFilters: map[string][]string{"tag:whitelister": {"true"}},
+		},
+		{
+			name: "filter by ids, tags, tag keys and vpc",
+			filter: config.Filter{
+				GroupIds: []string{"acl-1"}, Tags: map[string]string{"team": "payments"}, TagKeys: []string{"whitelister"},
+				VpcId: "vpc-1",
+			},
+			wantFilters: map[string][]string{
+				"network-acl-id": {"acl-1"}, "tag:team": {"payments"}, "tag-key": {"whitelister"}, "vpc-id": {"vpc-1"},
+			},
+		},
+		{
+			name:    "filter by names",
+			filter:  config.Filter{GroupNames: []string{"web"}, VpcId: "vpc-1"},
+			wantErr: "groupNames cannot filter network acls, filter them by groupIds instead",
+		},
+		{
+			name:    "filter without conditions",
+			filter:  config.Filter{FilterType: config.NetworkAcl},
+			wantErr: "missing labelName, groupIds, tags, tagKeys or vpcId to filter network acls",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := (&Aws{}).getNetworkAclFilters(tt.filter)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Got Err: %v, Wanted Err: %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			gotFilters := map[string][]string{}
+			for _, filter := range filters {
+				gotFilters[*filter.Name] = aws.StringValueSlice(filter.Values)
+			}
+			if !reflect.DeepEqual(gotFilters, tt.wantFilters) {
+				t.Errorf("Got filters = %v, wanted %v", gotFilters, tt.wantFilters)
+			}
+		})
+	}
+}
+
+func TestWhiteListIpsWithFailedAuthorize(t *testing.T) {
+	a := &Aws{}
+	err := a.Init(map[interface{}]interface{}{"Region": "us-west-2", "RemoveRule": true}, nil)
+	if err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+	a.targets[0].ec2Client = &fakeEc2{
+		groupId:      "sg-1",
+		authorizeErr: awserr.New(rulesLimitExceededCode, "The maximum number of rules per security group has been reached.", nil),
+	}
+	a.targets[0].quotasClient = &fakeQuotas{value: 60}
+
+	port := int64(443)
+	ipPermissions := []utils.IpPermission{{
+		FromPort: &port, ToPort: &port, IpProtocol: aws.String("tcp"),
+		IpRanges: []*utils.IpRange{{IpCidr: aws.String("10.0.0.1/32"), Description: aws.String("office")}},
+	}}
+	err = a.WhiteListIps(config.Filter{FilterType: config.SecurityGroup, LabelName: "whitelister", LabelValue: "true"}, ipPermissions)
+
+	if err == nil || !strings.Contains(err.Error(), "No room for Ingress security rules in security group sg-1") {
+		t.Errorf("Got Err: %v, wanted the quota error of sg-1", err)
+	}
+	if len(a.GetTargetGroups()) != 0 {
+		t.Errorf("Got target groups = %v, wanted none as adding the rules failed", a.GetTargetGroups())
+	}
+}
+
+func TestWhiteListIpsWithSecurityGroupFilters(t *testing.T) {
+	port := int64(443)
+	ipPermissions := []utils.IpPermission{{
+		FromPort: &port, ToPort: &port, IpProtocol: aws.String("tcp"),
+		IpRanges: []*utils.IpRange{{IpCidr: aws.String("10.0.0.1/32"), Description: aws.String("office")}},
+	}}
+	filter := config.Filter{FilterType: config.SecurityGroup, GroupIds: []string{"sg-1", "sg-2"}, VpcId: "vpc-1"}
+
+	tests := []struct {
+		name             string
+		client           *fakeEc2
+		wantTargetGroups []string
+		wantErr          string
+	}{
+		{
+			name:             "every matching security group whitelisted",
+			client:           &fakeEc2{groupId: "sg-1", otherGroupIds: []string{"sg-2"}},
+			wantTargetGroups: []string{"sg-1", "sg-2"},
+		},
+		{
+			name: "overflow groups not whitelisted as security groups",
+			client: &fakeEc2{groupId: "sg-1", otherGroupIds: []string{"sg-2"}, overflowGroups: []*ec2.SecurityGroup{{
+				GroupId: aws.String("sg-3"), GroupName: aws.String("sg-1-overflow-1"),
+				Tags: []*ec2.Tag{{Key: aws.String(overflowGroupTag), Value: aws.String("sg-1")}},
+			}}},
+			wantTargetGroups: []string{"sg-1", "sg-2"},
+		},
+		{
+			name:    "no matching security group",
+			client:  &fakeEc2{},
+			wantErr: "Failed to whitelist ips in 1 of 1 aws targets : us-west-2 : No security groups match the filter",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Aws{}
+			err := a.Init(map[interface{}]interface{}{"Region": "us-west-2", "RemoveRule": true}, nil)
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			a.targets[0].ec2Client = tt.client
+			a.targets[0].quotasClient = &fakeQuotas{value: 60}
+
+			err = a.WhiteListIps(filter, ipPermissions)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Got Err: %v, Wanted Err: %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+
+			gotFilters := map[string][]string{}
+			for _, groupFilter := range tt.client.groupFilters {
+				gotFilters[*groupFilter.Name] = aws.StringValueSlice(groupFilter.Values)
+			}
+			wantFilters := map[string][]string{"group-id": {"sg-1", "sg-2"}, "vpc-id": {"vpc-1"}}
+			if !reflect.DeepEqual(gotFilters, wantFilters) {
+				t.Errorf("Got filters = %v, wanted %v", gotFilters, wantFilters)
+			}
+			gotTargetGroups := a.GetTargetGroups()
+			sort.Strings(gotTargetGroups)
+			if !reflect.DeepEqual(gotTargetGroups, tt.wantTargetGroups) {
+				t.Errorf("Got target groups = %v, wanted %v", gotTargetGroups, tt.wantTargetGroups)
+			}
+			for _, groupId := range tt.wantTargetGroups {
+				if !reflect.DeepEqual(tt.client.addedCidrs[groupId], []string{"10.0.0.1/32"}) {
+					t.Errorf("Got added cidrs = %v in %s, wanted 10.0.0.1/32", tt.client.addedCidrs[groupId], groupId)
+				}
+			}
+		})
+	}
+}
+
+func TestWhiteListIpsWithoutLoadBalancers(t *testing.T) {
+	a := &Aws{}
+	err := a.Init(map[interface{}]interface{}{"Region": "us-west-2"}, fake.NewSimpleClientset())
+	if err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+	a.targets[0].ec2Client = &fakeEc2{groupId: "sg-1"}
+
+	err = a.WhiteListIps(config.Filter{FilterType: config.LoadBalancer, LabelName: "whitelister", LabelValue: "true"}, nil)
+	wantErr := "Failed to whitelist ips in 1 of 1 aws targets : us-west-2 : " +
+		"Cannot find any services with label name: whitelister , label value: true"
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("Got Err: %v, Wanted Err: %s", err, wantErr)
+	}
+}
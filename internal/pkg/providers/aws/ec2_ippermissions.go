@@ -4,6 +4,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/stakater/Whitelister/internal/pkg/utils"
 	"regexp"
+	"strings"
 )
 
 func getEc2IpPermissions(ipPermissions []utils.IpPermission) []*ec2.IpPermission {
@@ -15,7 +16,10 @@ func getEc2IpPermissions(ipPermissions []utils.IpPermission) []*ec2.IpPermission
 				SetIpProtocol(*ipPermission.IpProtocol).
 				SetFromPort(*ipPermission.FromPort).
 				SetToPort(*ipPermission.ToPort).
-				SetIpRanges(getEc2IpRanges(ipPermission.IpRanges)),
+				SetIpRanges(getEc2IpRanges(ipPermission.IpRanges)).
+				SetIpv6Ranges(getEc2Ipv6Ranges(ipPermission.IpRanges)).
+				SetUserIdGroupPairs(getEc2UserIdGroupPairs(ipPermission.UserIdGroupPairs)).
+				SetPrefixListIds(getEc2PrefixListIds(ipPermission.PrefixListIds)),
 		)
 	}
 
@@ -29,8 +33,10 @@ func (a *Aws) filterIpPermissions(ipPermissions []*ec2.IpPermission) []*ec2.IpPe
 	for _, ipPermission := range ipPermissions {
 		ipPermission.IpRanges = a.filterIpRanges(ipPermission.IpRanges)
 		ipPermission.Ipv6Ranges = a.filterIpv6Ranges(ipPermission.Ipv6Ranges)
+		ipPermission.UserIdGroupPairs = a.filterUserIdGroupPairs(ipPermission.UserIdGroupPairs)
 		//Must be checked otherwise all security rules are removed for a certain port range and protocol
-		if len(ipPermission.IpRanges) != 0 || len(ipPermission.Ipv6Ranges) != 0 {
+		if len(ipPermission.IpRanges) != 0 || len(ipPermission.Ipv6Ranges) != 0 || len(ipPermission.PrefixListIds) != 0 ||
+			len(ipPermission.UserIdGroupPairs) != 0 {
 			filteredIpPermissions = append(filteredIpPermissions, ipPermission)
 		}
 	}
@@ -42,6 +48,32 @@ func (a *Aws) filterIpPermissions(ipPermissions []*ec2.IpPermission) []*ec2.IpPe
 	return filteredIpPermissions
 }
 
+// filterReferences returns the ip permissions of a security group with only the security groups and prefix
+// lists that Whitelister may remove or that are whitelisted, so that the others are neither compared nor
+// removed
+func (a *Aws) filterReferences(ipPermissions []*ec2.IpPermission, managedPrefixLists map[string]*ec2.ManagedPrefixList,
+	wanted map[string]bool) []*ec2.IpPermission {
+
+	var filteredIpPermissions []*ec2.IpPermission
+	for _, ipPermission := range ipPermissions {
+		filteredIpPermission := *ipPermission
+		filteredIpPermission.UserIdGroupPairs = nil
+		filteredIpPermission.PrefixListIds = nil
+		for _, r := range getRules([]*ec2.IpPermission{ipPermission}, managedPrefixLists) {
+			if r.ipRange != nil || r.ipv6Range != nil || (!wanted[r.key()] && a.isKeptRule(r, managedPrefixLists)) {
+				continue
+			}
+			if r.userIdGroupPair != nil {
+				filteredIpPermission.UserIdGroupPairs = append(filteredIpPermission.UserIdGroupPairs, r.userIdGroupPair)
+			} else {
+				filteredIpPermission.PrefixListIds = append(filteredIpPermission.PrefixListIds, r.prefixListId)
+			}
+		}
+		filteredIpPermissions = append(filteredIpPermissions, &filteredIpPermission)
+	}
+	return filteredIpPermissions
+}
+
 func (a *Aws) filterIpRanges(ipRanges []*ec2.IpRange) []*ec2.IpRange {
 
 	reg, _ := regexp.Compile(a.KeepRuleDescriptionPrefix + ".*$")
@@ -78,6 +110,24 @@ func (a *Aws) filterIpv6Ranges(ipv6Ranges []*ec2.Ipv6Range) []*ec2.Ipv6Range {
 	return filteredIpv6Ranges
 }
 
+func (a *Aws) filterUserIdGroupPairs(userIdGroupPairs []*ec2.UserIdGroupPair) []*ec2.UserIdGroupPair {
+
+	reg, _ := regexp.Compile(a.KeepRuleDescriptionPrefix + ".*$")
+	var filteredUserIdGroupPairs []*ec2.UserIdGroupPair
+
+	for _, userIdGroupPair := range userIdGroupPairs {
+		if userIdGroupPair.Description == nil || !reg.MatchString(*userIdGroupPair.Description) {
+			filteredUserIdGroupPairs = append(filteredUserIdGroupPairs, userIdGroupPair)
+		}
+	}
+
+	if len(filteredUserIdGroupPairs) == 0 {
+		return nil
+	}
+
+	return filteredUserIdGroupPairs
+}
+
 func getEc2IpRanges(ipRanges []*utils.IpRange) []*ec2.IpRange {
 
 	if ipRanges == nil {
@@ -87,6 +137,9 @@ func getEc2IpRanges(ipRanges []*utils.IpRange) []*ec2.IpRange {
 	var ec2IpRanges []*ec2.IpRange
 
 	for _, ipRange := range ipRanges {
+		if isIpv6Cidr(ipRange.IpCidr) {
+			continue
+		}
 		ec2IpRanges = append(ec2IpRanges, &ec2.IpRange{
 			CidrIp:      ipRange.IpCidr,
 			Description: ipRange.Description,
@@ -94,3 +147,51 @@ func getEc2IpRanges(ipRanges []*utils.IpRange) []*ec2.IpRange {
 	}
 	return ec2IpRanges
 }
+
+func getEc2Ipv6Ranges(ipRanges []*utils.IpRange) []*ec2.Ipv6Range {
+
+	var ec2Ipv6Ranges []*ec2.Ipv6Range
+
+	for _, ipRange := range ipRanges {
+		if !isIpv6Cidr(ipRange.IpCidr) {
+			continue
+		}
+		ec2Ipv6Ranges = append(ec2Ipv6Ranges, &ec2.Ipv6Range{
+			CidrIpv6:    ipRange.IpCidr,
+			Description: ipRange.Description,
+		})
+	}
+	return ec2Ipv6Ranges
+}
+
+func getEc2UserIdGroupPairs(userIdGroupPairs []*utils.UserIdGroupPair) []*ec2.UserIdGroupPair {
+
+	var ec2UserIdGroupPairs []*ec2.UserIdGroupPair
+
+	for _, userIdGroupPair := range userIdGroupPairs {
+		ec2UserIdGroupPairs = append(ec2UserIdGroupPairs, &ec2.UserIdGroupPair{
+			GroupId:     userIdGroupPair.GroupId,
+			UserId:      userIdGroupPair.UserId,
+			Description: userIdGroupPair.Description,
+		})
+	}
+	return ec2UserIdGroupPairs
+}
+
+func getEc2PrefixListIds(prefixListIds []*utils.PrefixListId) []*ec2.PrefixListId {
+
+	var ec2PrefixListIds []*ec2.PrefixListId
+
+	for _, prefixListId := range prefixListIds {
+		ec2PrefixListIds = append(ec2PrefixListIds, &ec2.PrefixListId{
+			PrefixListId: prefixListId.PrefixListId,
+			Description:  prefixListId.Description,
+		})
+	}
+	return ec2PrefixListIds
+}
+
+// isIpv6Cidr checks if a cidr is an ipv6 cidr, which ec2 expects in Ipv6Ranges instead of IpRanges
+func isIpv6Cidr(ipCidr *string) bool {
+	return ipCidr != nil && strings.Contains(*ipCidr, ":")
+}
@@ -0,0 +1,339 @@
+package aws
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/sirupsen/logrus"
+
+	"github.com/stakater/Whitelister/internal/pkg/config"
+)
+
+const (
+	// defaultNetworkAclRuleStart and defaultNetworkAclRuleEnd are the default rule numbers of the entries
+	// managed by Whitelister, before the rule 100 allowing all traffic of a default network acl
+	defaultNetworkAclRuleStart = 1
+	defaultNetworkAclRuleEnd   = 99
+	// maxNetworkAclRuleNumber is the highest rule number of a network acl entry
+	maxNetworkAclRuleNumber = 32766
+)
+
+// networkAclProtocols are the protocol numbers of the protocol names of ip permissions
+var networkAclProtocols = map[string]string{
+	"tcp":    "6",
+	"udp":    "17",
+	"icmp":   "1",
+	"icmpv6": "58",
+}
+
+// networkAclEntry is an allow or deny entry of a network acl for a protocol, port range and cidr. For
+// icmp the port range is the icmp type and code
+type networkAclEntry struct {
+	ruleAction string
+	protocol   string
+	fromPort   int64
+	toPort     int64
+	cidr       string
+	ipv6       bool
+}
+
+// key identifies the entry by action, protocol, port range and cidr
+func (e networkAclEntry) key() string {
+	return fmt.Sprintf("%s/%s/%d/%d/%s", e.ruleAction, e.protocol, e.fromPort, e.toPort, e.cidr)
+}
+
+// String returns the entry for logs e.g. "allow 6/443-443 10.0.0.1/32"
+func (e networkAclEntry) String() string {
+	return fmt.Sprintf("%s %s/%d-%d %s", e.ruleAction, e.protocol, e.fromPort, e.toPort, e.cidr)
+}
+
+// networkAclPlan is the entries to add to a network acl by rule number and the rule numbers of the entries
+// to remove, before and after adding the entries
+type networkAclPlan struct {
+	add          map[int64]networkAclEntry
+	removeBefore []int64
+	removeAfter  []int64
+}
+
+// getNetworkAclsByFilter returns the network acls matching the filter
+func (a *Aws) getNetworkAclsByFilter(t *target, filter config.Filter) ([]*ec2.NetworkAcl, error) {
+	filters, err := a.getNetworkAclFilters(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var networkAcls []*ec2.NetworkAcl
+	input := &ec2.DescribeNetworkAclsInput{Filters: filters}
+	err = t.ec2Client.DescribeNetworkAclsPages(input, func(output *ec2.DescribeNetworkAclsOutput, lastPage bool) bool {
+		networkAcls = append(networkAcls, output.NetworkAcls...)
+		return true
+	})
+	if err != nil {
+		logrus.Errorf("%v", err)
+		return nil, err
+	}
+	return networkAcls, nil
+}
+
+// whiteListNetworkAclIps updates the entries of a network acl in the rule numbers of Whitelister. Every
+// cidr gets an allow entry, followed by an entry denying the rest of the port range
+func (a *Aws) whiteListNetworkAclIps(t *target, networkAcl *ec2.NetworkAcl, ipPermissions []*ec2.IpPermission) error {
+	egress := t.Direction == Egress
+	allows, denies := getNetworkAclEntries(ipPermissions)
+	plan, err := a.planNetworkAcl(networkAcl, egress, allows, denies)
+	if err != nil {
+		return err
+	}
+
+	if len(plan.removeBefore) == 0 && len(plan.add) == 0 && len(plan.removeAfter) == 0 {
+		logrus.Infof("No %s network acl entries to change for network acl : %s", t.Direction, *networkAcl.NetworkAclId)
+		return nil
+	}
+
+	var failures []string
+	for _, ruleNumber := range plan.removeBefore {
+		if err := deleteNetworkAclEntry(t.ec2Client, networkAcl, egress, ruleNumber); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	// Allow entries are added before the deny entries, so that the whitelisted ips are not denied meanwhile
+	ruleNumbers := make([]int64, 0, len(plan.add))
+	for ruleNumber := range plan.add {
+		ruleNumbers = append(ruleNumbers, ruleNumber)
+	}
+	sort.Slice(ruleNumbers, func(i, j int) bool { return ruleNumbers[i] < ruleNumbers[j] })
+	for _, ruleNumber := range ruleNumbers {
+		if err := createNetworkAclEntry(t.ec2Client, networkAcl, egress, ruleNumber, plan.add[ruleNumber]); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	for _, ruleNumber := range plan.removeAfter {
+		if err := deleteNetworkAclEntry(t.ec2Client, networkAcl, egress, ruleNumber); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("Unable to update network acl %s : %s", *networkAcl.NetworkAclId, strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// planNetworkAcl compares the wanted entries with the entries of the network acl in the rule numbers of
+// Whitelister. Existing entries keep their rule numbers, new allow entries get the lowest free rule numbers
+// and new deny entries the highest, so that all allow entries come before the deny entries. A deny entry
+// below an allow entry is moved. Entries that are not wanted are removed if RemoveRule is set
+func (a *Aws) planNetworkAcl(networkAcl *ec2.NetworkAcl, egress bool, allows []networkAclEntry,
+	denies []networkAclEntry) (networkAclPlan, error) {
+
+	plan := networkAclPlan{add: map[int64]networkAclEntry{}}
+	wanted := map[string]bool{}
+	for _, entry := range append(append([]networkAclEntry{}, allows...), denies...) {
+		wanted[entry.key()] = true
+	}
+
+	used := map[int64]bool{}
+	kept := map[string]int64{}
+	for _, ec2Entry := range networkAcl.Entries {
+		ruleNumber := aws.Int64Value(ec2Entry.RuleNumber)
+		if aws.BoolValue(ec2Entry.Egress) != egress || ruleNumber < a.NetworkAclRuleStart || ruleNumber > a.NetworkAclRuleEnd {
+			continue
+		}
+		entry := getNetworkAclEntry(ec2Entry)
+		if _, exists := kept[entry.key()]; wanted[entry.key()] && !exists {
+			kept[entry.key()] = ruleNumber
+			used[ruleNumber] = true
+			continue
+		}
+		if !a.RemoveRule {
+			used[ruleNumber] = true
+			continue
+		}
+		// Entries allowing ips are removed first, entries denying them last
+		if entry.ruleAction == ec2.RuleActionAllow {
+			plan.removeBefore = append(plan.removeBefore, ruleNumber)
+		} else {
+			used[ruleNumber] = true
+			plan.removeAfter = append(plan.removeAfter, ruleNumber)
+		}
+	}
+
+	var lastAllow int64
+	var missing int
+	next := a.NetworkAclRuleStart
+	for _, entry := range allows {
+		ruleNumber, exists := kept[entry.key()]
+		if !exists {
+			for next <= a.NetworkAclRuleEnd && used[next] {
+				next++
+			}
+			if next > a.NetworkAclRuleEnd {
+				missing++
+				continue
+			}
+			ruleNumber = next
+			used[ruleNumber] = true
+			plan.add[ruleNumber] = entry
+		}
+		if ruleNumber > lastAllow {
+			lastAllow = ruleNumber
+		}
+	}
+
+	next = a.NetworkAclRuleEnd
+	for _, entry := range denies {
+		if ruleNumber, exists := kept[entry.key()]; exists {
+			if ruleNumber > lastAllow {
+				continue
+			}
+			plan.removeAfter = append(plan.removeAfter, ruleNumber)
+		}
+		for next > lastAllow && used[next] {
+			next--
+		}
+		if next <= lastAllow {
+			missing++
+			continue
+		}
+		used[next] = true
+		plan.add[next] = entry
+	}
+
+	if missing > 0 {
+		return networkAclPlan{}, fmt.Errorf("No room for %d of %d entries in rule numbers %d to %d of network acl %s, "+
+			"raise NetworkAclRuleEnd or lower NetworkAclRuleStart", missing, len(allows)+len(denies),
+			a.NetworkAclRuleStart, a.NetworkAclRuleEnd, *networkAcl.NetworkAclId)
+	}
+	return plan, nil
+}
+
+// getNetworkAclEntries returns an allow entry for every cidr of the ip permissions and an entry denying all
+// other ipv4 or ipv6 cidrs for the port range of every ip permission. Security groups and prefix lists
+// cannot be whitelisted in network acls
+func getNetworkAclEntries(ipPermissions []*ec2.IpPermission) ([]networkAclEntry, []networkAclEntry) {
+	var allows, denies []networkAclEntry
+	seen := map[string]bool{}
+	add := func(entries []networkAclEntry, entry networkAclEntry) []networkAclEntry {
+		if seen[entry.key()] {
+			return entries
+		}
+		seen[entry.key()] = true
+		return append(entries, entry)
+	}
+
+	for _, ipPermission := range ipPermissions {
+		entry := networkAclEntry{ruleAction: ec2.RuleActionAllow, protocol: getNetworkAclProtocol(*ipPermission.IpProtocol)}
+		if entry.protocol != "-1" {
+			entry.fromPort = aws.Int64Value(ipPermission.FromPort)
+			entry.toPort = aws.Int64Value(ipPermission.ToPort)
+		}
+		if len(ipPermission.UserIdGroupPairs) > 0 || len(ipPermission.PrefixListIds) > 0 {
+			logrus.Warnf("Ignoring security groups and prefix lists of %s/%d-%d, network acls only allow cidrs",
+				entry.protocol, entry.fromPort, entry.toPort)
+		}
+
+		deny := entry
+		deny.ruleAction = ec2.RuleActionDeny
+		for _, ipRange := range ipPermission.IpRanges {
+			entry.cidr, entry.ipv6 = *ipRange.CidrIp, false
+			allows = add(allows, entry)
+		}
+		if len(ipPermission.IpRanges) > 0 {
+			deny.cidr, deny.ipv6 = "0.0.0.0/0", false
+			denies = add(denies, deny)
+		}
+		for _, ipv6Range := range ipPermission.Ipv6Ranges {
+			entry.cidr, entry.ipv6 = *ipv6Range.CidrIpv6, true
+			allows = add(allows, entry)
+		}
+		if len(ipPermission.Ipv6Ranges) > 0 {
+			deny.cidr, deny.ipv6 = "::/0", true
+			denies = add(denies, deny)
+		}
+	}
+	return allows, denies
+}
+
+// getNetworkAclEntry returns the entry of an ec2 network acl entry
+func getNetworkAclEntry(ec2Entry *ec2.NetworkAclEntry) networkAclEntry {
+	entry := networkAclEntry{
+		ruleAction: aws.StringValue(ec2Entry.RuleAction),
+		protocol:   aws.StringValue(ec2Entry.Protocol),
+		cidr:       aws.StringValue(ec2Entry.CidrBlock),
+	}
+	if ec2Entry.Ipv6CidrBlock != nil {
+		entry.cidr, entry.ipv6 = *ec2Entry.Ipv6CidrBlock, true
+	}
+	switch {
+	case isIcmpProtocol(entry.protocol) && ec2Entry.IcmpTypeCode != nil:
+		entry.fromPort = aws.Int64Value(ec2Entry.IcmpTypeCode.Type)
+		entry.toPort = aws.Int64Value(ec2Entry.IcmpTypeCode.Code)
+	case entry.protocol != "-1" && ec2Entry.PortRange != nil:
+		entry.fromPort = aws.Int64Value(ec2Entry.PortRange.From)
+		entry.toPort = aws.Int64Value(ec2Entry.PortRange.To)
+	}
+	return entry
+}
+
+// getNetworkAclProtocol returns the protocol number of the protocol of an ip permission
+func getNetworkAclProtocol(ipProtocol string) string {
+	if protocol, ok := networkAclProtocols[strings.ToLower(ipProtocol)]; ok {
+		return protocol
+	}
+	return ipProtocol
+}
+
+// isIcmpProtocol checks if the protocol number is icmp or icmpv6, whose entries have an icmp type and code
+// instead of a port range
+func isIcmpProtocol(protocol string) bool {
+	return protocol == networkAclProtocols["icmp"] || protocol == networkAclProtocols["icmpv6"]
+}
+
+func createNetworkAclEntry(client ec2iface.EC2API, networkAcl *ec2.NetworkAcl, egress bool, ruleNumber int64,
+	entry networkAclEntry) error {
+
+	input := &ec2.CreateNetworkAclEntryInput{
+		NetworkAclId: networkAcl.NetworkAclId,
+		Egress:       aws.Bool(egress),
+		RuleNumber:   aws.Int64(ruleNumber),
+		RuleAction:   aws.String(entry.ruleAction),
+		Protocol:     aws.String(entry.protocol),
+	}
+	if entry.ipv6 {
+		input.Ipv6CidrBlock = aws.String(entry.cidr)
+	} else {
+		input.CidrBlock = aws.String(entry.cidr)
+	}
+	switch {
+	case isIcmpProtocol(entry.protocol):
+		input.IcmpTypeCode = &ec2.IcmpTypeCode{Type: aws.Int64(entry.fromPort), Code: aws.Int64(entry.toPort)}
+	case entry.protocol != "-1":
+		input.PortRange = &ec2.PortRange{From: aws.Int64(entry.fromPort), To: aws.Int64(entry.toPort)}
+	}
+
+	logrus.Infof("Adding network acl entry %d : %s for network acl :%s", ruleNumber, entry, *networkAcl.NetworkAclId)
+	_, err := client.CreateNetworkAclEntry(input)
+	if err != nil {
+		logrus.Errorf("Error adding network acl entry %d for network acl %s : %v", ruleNumber, *networkAcl.NetworkAclId, err)
+		return fmt.Errorf("Unable to add entry %d : %v", ruleNumber, err)
+	}
+	return nil
+}
+
+func deleteNetworkAclEntry(client ec2iface.EC2API, networkAcl *ec2.NetworkAcl, egress bool, ruleNumber int64) error {
+	logrus.Infof("Removing network acl entry %d for network acl :%s", ruleNumber, *networkAcl.NetworkAclId)
+	_, err := client.DeleteNetworkAclEntry(&ec2.DeleteNetworkAclEntryInput{
+		NetworkAclId: networkAcl.NetworkAclId,
+		Egress:       aws.Bool(egress),
+		RuleNumber:   aws.Int64(ruleNumber),
+	})
+	if err != nil {
+		logrus.Errorf("Error removing network acl entry %d for network acl %s : %v", ruleNumber, *networkAcl.NetworkAclId, err)
+		return fmt.Errorf("Unable to remove entry %d : %v", ruleNumber, err)
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package aws
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// maxPrefixListChanges is the number of entries that can be added or removed in a single call
+	maxPrefixListChanges = 100
+	// prefixListPollInterval and prefixListTimeout control waiting for a change of a prefix list to complete
+	prefixListPollInterval = 2 * time.Second
+	prefixListTimeout      = 2 * time.Minute
+)
+
+// prefixListDescription is the description of the security group rules referencing prefix lists
+const prefixListDescription = "whitelister"
+
+// prefixListEntries are the cidrs of a prefix list by cidr with their descriptions
+type prefixListEntries map[string]string
+
+// syncPrefixLists puts the cidrs of every ip permission into a managed prefix list of its port range, and
+// returns ip permissions referencing the prefix lists instead of the cidrs together with all prefix lists
+// managed by Whitelister by id
+func (a *Aws) syncPrefixLists(t *target, ipPermissions []*ec2.IpPermission) ([]*ec2.IpPermission,
+	map[string]*ec2.ManagedPrefixList, error) {
+
+	prefixLists, err := getPrefixLists(t.ec2Client, a.PrefixListName+"-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	managedPrefixLists := map[string]*ec2.ManagedPrefixList{}
+	for _, prefixList := range prefixLists {
+		managedPrefixLists[*prefixList.PrefixListId] = prefixList
+	}
+
+	var prefixListIpPermissions []*ec2.IpPermission
+	for _, ipPermission := range ipPermissions {
+		lists := []struct {
+			addressFamily string
+			entries       prefixListEntries
+		}{
+			{"IPv4", prefixListEntries{}},
+			{"IPv6", prefixListEntries{}},
+		}
+		for _, ipRange := range ipPermission.IpRanges {
+			lists[0].entries[*ipRange.CidrIp] = aws.StringValue(ipRange.Description)
+		}
+		for _, ipv6Range := range ipPermission.Ipv6Ranges {
+			lists[1].entries[*ipv6Range.CidrIpv6] = aws.StringValue(ipv6Range.Description)
+		}
+
+		// Security groups and prefix lists of the ip providers are referenced as they are
+		prefixListIpPermission := &ec2.IpPermission{
+			FromPort:         ipPermission.FromPort,
+			ToPort:           ipPermission.ToPort,
+			IpProtocol:       ipPermission.IpProtocol,
+			UserIdGroupPairs: ipPermission.UserIdGroupPairs,
+			PrefixListIds:    ipPermission.PrefixListIds,
+		}
+		for _, list := range lists {
+			if len(list.entries) == 0 {
+				continue
+			}
+			name := a.getPrefixListName(ipPermission, list.addressFamily)
+			prefixList, err := a.syncPrefixList(t.ec2Client, prefixLists[name], name, list.addressFamily, list.entries)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Unable to sync prefix list %s : %v", name, err)
+			}
+			managedPrefixLists[*prefixList.PrefixListId] = prefixList
+			prefixListIpPermission.PrefixListIds = append(prefixListIpPermission.PrefixListIds, &ec2.PrefixListId{
+				PrefixListId: prefixList.PrefixListId,
+				Description:  aws.String(prefixListDescription),
+			})
+		}
+		if len(prefixListIpPermission.PrefixListIds) > 0 || len(prefixListIpPermission.UserIdGroupPairs) > 0 {
+			prefixListIpPermissions = append(prefixListIpPermissions, prefixListIpPermission)
+		}
+	}
+	return prefixListIpPermissions, managedPrefixLists, nil
+}
+
+// getPrefixListName returns the name of the prefix list of the port range of an ip permission e.g.
+// "whitelister-tcp-443-443", or "whitelister-tcp-443-443-ipv6" for ipv6 cidrs
+func (a *Aws) getPrefixListName(ipPermission *ec2.IpPermission, addressFamily string) string {
+	name := a.PrefixListName + "-all"
+	if *ipPermission.IpProtocol != "-1" {
+		name = fmt.Sprintf("%s-%s-%d-%d", a.PrefixListName, *ipPermission.IpProtocol,
+			aws.Int64Value(ipPermission.FromPort), aws.Int64Value(ipPermission.ToPort))
+	}
+	if addressFamily == "IPv6" {
+		name += "-ipv6"
+	}
+	return name
+}
+
+// getPrefixLists returns the prefix lists whose names match the pattern by name
+func getPrefixLists(client ec2iface.EC2API, pattern string) (map[string]*ec2.ManagedPrefixList, error) {
+	prefixLists := map[string]*ec2.ManagedPrefixList{}
+	input := &ec2.DescribeManagedPrefixListsInput{
+		Filters: []*ec2.Filter{{Name: aws.String("prefix-list-name"), Values: aws.StringSlice([]string{pattern})}},
+	}
+	err := client.DescribeManagedPrefixListsPages(input, func(output *ec2.DescribeManagedPrefixListsOutput, lastPage bool) bool {
+		for _, prefixList := range output.PrefixLists {
+			prefixLists[*prefixList.PrefixListName] = prefixList
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to describe prefix lists : %v", err)
+	}
+	return prefixLists, nil
+}
+
+// syncPrefixList creates the prefix list if it does not exist and updates its entries, resizing it if
+// the entries do not fit. It returns the updated prefix list
+func (a *Aws) syncPrefixList(client ec2iface.EC2API, prefixList *ec2.ManagedPrefixList, name string,
+	addressFamily string, entries prefixListEntries) (*ec2.ManagedPrefixList, error) {
+
+	if prefixList == nil {
+		output, err := client.CreateManagedPrefixList(&ec2.CreateManagedPrefixListInput{
+			AddressFamily:  aws.String(addressFamily),
+			MaxEntries:     aws.Int64(a.getPrefixListMaxEntries(len(entries))),
+			PrefixListName: aws.String(name),
+			// Entries are added by modifying the prefix list, as only some of them can be added at once
+			TagSpecifications: []*ec2.TagSpecification{{
+				ResourceType: aws.String("prefix-list"),
+				Tags:         []*ec2.Tag{{Key: aws.String("ManagedBy"), Value: aws.String("whitelister")}},
+			}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		prefixList = output.PrefixList
+		logrus.Infof("Created prefix list %s : %s", name, *prefixList.PrefixListId)
+	}
+
+	prefixList, err := waitForPrefixList(client, *prefixList.PrefixListId)
+	if err != nil {
+		return nil, err
+	}
+	currentEntries, err := getPrefixListEntries(client, *prefixList.PrefixListId)
+	if err != nil {
+		return nil, err
+	}
+
+	// An entry whose description changed is removed and added again, e.g. when its owner changed
+	var entriesToRemove []*ec2.RemovePrefixListEntry
+	for _, cidr := range sortedCidrs(currentEntries) {
+		if description, ok := entries[cidr]; !ok || description != currentEntries[cidr] {
+			entriesToRemove = append(entriesToRemove, &ec2.RemovePrefixListEntry{Cidr: aws.String(cidr)})
+		}
+	}
+	var entriesToAdd []*ec2.AddPrefixListEntry
+	for _, cidr := range sortedCidrs(entries) {
+		if description, ok := currentEntries[cidr]; !ok || description != entries[cidr] {
+			entriesToAdd = append(entriesToAdd, &ec2.AddPrefixListEntry{Cidr: aws.String(cidr), Description: aws.String(entries[cidr])})
+		}
+	}
+
+	// Remove entries first to make room for the new ones
+	for start := 0; start < len(entriesToRemove); start += maxPrefixListChanges {
+		end := minInt(start+maxPrefixListChanges, len(entriesToRemove))
+		prefixList, err = modifyPrefixList(client, prefixList, &ec2.ModifyManagedPrefixListInput{RemoveEntries: entriesToRemove[start:end]})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if int64(len(entries)) > aws.Int64Value(prefixList.MaxEntries) {
+		maxEntries := a.getPrefixListMaxEntries(len(entries))
+		logrus.Infof("Resizing prefix list %s from %d to %d entries", name, *prefixList.MaxEntries, maxEntries)
+		prefixList, err = modifyPrefixList(client, prefixList, &ec2.ModifyManagedPrefixListInput{MaxEntries: aws.Int64(maxEntries)})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for start := 0; start < len(entriesToAdd); start += maxPrefixListChanges {
+		end := minInt(start+maxPrefixListChanges, len(entriesToAdd))
+		prefixList, err = modifyPrefixList(client, prefixList, &ec2.ModifyManagedPrefixListInput{AddEntries: entriesToAdd[start:end]})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(entriesToAdd) > 0 || len(entriesToRemove) > 0 {
+		logrus.Infof("Added %d and removed %d entries of prefix list %s", len(entriesToAdd), len(entriesToRemove), name)
+	}
+	return prefixList, nil
+}
+
+// getPrefixListMaxEntries returns the max entries of a prefix list holding the given number of entries. Every
+// rule referencing a prefix list counts as its max entries against the rules quota of a security group,
+// so it is the configured PrefixListMaxEntries or the number of entries rounded up to a multiple of 10
+func (a *Aws) getPrefixListMaxEntries(entries int) int64 {
+	maxEntries := (int64(entries) + 9) / 10 * 10
+	if maxEntries == 0 {
+		maxEntries = 10
+	}
+	if a.PrefixListMaxEntries > maxEntries {
+		maxEntries = a.PrefixListMaxEntries
+	}
+	return maxEntries
+}
+
+func getPrefixListEntries(client ec2iface.EC2API, prefixListId string) (prefixListEntries, error) {
+	entries := prefixListEntries{}
+	input := &ec2.GetManagedPrefixListEntriesInput{PrefixListId: aws.String(prefixListId)}
+	err := client.GetManagedPrefixListEntriesPages(input, func(output *ec2.GetManagedPrefixListEntriesOutput, lastPage bool) bool {
+		for _, entry := range output.Entries {
+			entries[*entry.Cidr] = aws.StringValue(entry.Description)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get entries of prefix list %s : %v", prefixListId, err)
+	}
+	return entries, nil
+}
+
+// modifyPrefixList modifies the current version of the prefix list and waits for the modification to
+// complete, it returns the modified prefix list
+func modifyPrefixList(client ec2iface.EC2API, prefixList *ec2.ManagedPrefixList,
+	input *ec2.ModifyManagedPrefixListInput) (*ec2.ManagedPrefixList, error) {
+
+	input.PrefixListId = prefixList.PrefixListId
+	input.CurrentVersion = prefixList.Version
+	_, err := client.ModifyManagedPrefixList(input)
+	if err != nil {
+		return nil, err
+	}
+	return waitForPrefixList(client, *prefixList.PrefixListId)
+}
+
+// waitForPrefixList waits until a change of the prefix list is no longer in progress, it fails if the
+// change failed
+func waitForPrefixList(client ec2iface.EC2API, prefixListId string) (*ec2.ManagedPrefixList, error) {
+	deadline := time.Now().Add(prefixListTimeout)
+	for {
+		output, err := client.DescribeManagedPrefixLists(&ec2.DescribeManagedPrefixListsInput{
+			PrefixListIds: aws.StringSlice([]string{prefixListId}),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to describe prefix list %s : %v", prefixListId, err)
+		}
+		if len(output.PrefixLists) != 1 {
+			return nil, fmt.Errorf("Prefix list %s not found", prefixListId)
+		}
+
+		prefixList := output.PrefixLists[0]
+		state := aws.StringValue(prefixList.State)
+		if strings.HasSuffix(state, "-failed") {
+			return nil, fmt.Errorf("Prefix list %s is in state %s : %s", prefixListId, state, aws.StringValue(prefixList.StateMessage))
+		}
+		if !strings.HasSuffix(state, "-in-progress") {
+			return prefixList, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("Prefix list %s still in state %s after %s", prefixListId, state, prefixListTimeout)
+		}
+		time.Sleep(prefixListPollInterval)
+	}
+}
+
+func sortedCidrs(entries prefixListEntries) []string {
+	cidrs := make([]string, 0, len(entries))
+	for cidr := range entries {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+	return cidrs
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
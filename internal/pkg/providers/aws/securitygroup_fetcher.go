@@ -4,41 +4,34 @@ import (
 	"errors"
 	"github.com/stakater/Whitelister/internal/pkg/config"
 	"github.com/stakater/Whitelister/internal/pkg/utils"
+	"sort"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/elb"
 	"github.com/sirupsen/logrus"
 )
 
-func (a *Aws) fetchSecurityGroup(session *session.Session, credentials *credentials.Credentials, filter config.Filter) ([]*ec2.SecurityGroup, error) {
+func (a *Aws) fetchSecurityGroup(t *target, filter config.Filter) ([]*ec2.SecurityGroup, error) {
 	if filter.FilterType == config.LoadBalancer {
 		loadBalancerNames := utils.GetLoadBalancerNames(filter, a.ClientSet)
-		logrus.Info("load balancer names: ", loadBalancerNames[0])
 
 		if len(loadBalancerNames) > 0 {
-			return a.getSecurityGroupsByLoadBalancer(session, credentials, loadBalancerNames)
+			logrus.Info("load balancer names: ", loadBalancerNames[0])
+			return a.getSecurityGroupsByLoadBalancer(t, loadBalancerNames)
 		} else {
 			return nil, errors.New("Cannot find any services with label name: " + filter.LabelName + " , label value: " + filter.LabelValue)
 		}
 	} else if filter.FilterType == config.SecurityGroup {
-		return a.getSecurityGroupsByTagFilter(session, credentials, filter.LabelName, filter.LabelValue)
+		return a.getSecurityGroupsByFilter(t, filter)
 	} else {
 		return nil, errors.New("unrecognized filter type " + filter.FilterType.String())
 	}
 }
 
-func (a *Aws) getSecurityGroupsByLoadBalancer(session *session.Session, credentials *credentials.Credentials, resourceIds []string) ([]*ec2.SecurityGroup, error) {
+func (a *Aws) getSecurityGroupsByLoadBalancer(t *target, resourceIds []string) ([]*ec2.SecurityGroup, error) {
 
-	// Create an ELB service client.
-	elbClient := elb.New(session, &aws.Config{
-		Credentials: credentials,
-		Region:      aws.String(a.Region),
-	})
-
-	result, err := elbClient.DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{
+	result, err := t.elbClient.DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{
 		LoadBalancerNames: aws.StringSlice(resourceIds),
 	})
 	if err != nil {
@@ -55,12 +48,10 @@ func (a *Aws) getSecurityGroupsByLoadBalancer(session *session.Session, credenti
 		securityGroupNames = append(securityGroupNames, loadBalancerDescription.SourceSecurityGroup.GroupName)
 	}
 
-	ec2Client := getEc2Client(session, credentials, a)
-
 	var vpcFilter = "vpc-id"
 	var groupFilter = "group-name"
 
-	securityGroupResult, err := ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+	securityGroupResult, err := t.ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
 		Filters: []*ec2.Filter{
 			{
 				Name:   &vpcFilter,
@@ -81,26 +72,91 @@ func (a *Aws) getSecurityGroupsByLoadBalancer(session *session.Session, credenti
 	return securityGroupResult.SecurityGroups, nil
 }
 
-func (a *Aws) getSecurityGroupsByTagFilter(session *session.Session, credentials *credentials.Credentials, labelName string, labelValue string) ([]*ec2.SecurityGroup, error) {
+func (a *Aws) getSecurityGroupsByFilter(t *target, filter config.Filter) ([]*ec2.SecurityGroup, error) {
 
-	ec2Client := getEc2Client(session, credentials, a)
-	filters := a.getSearchFilterWithTag(labelName, labelValue)
+	filters, err := a.getSecurityGroupFilters(filter)
+	if err != nil {
+		return nil, err
+	}
 
-	securityGroupResult, err := ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{Filters: filters})
+	// Filters on the vpc or tag keys can match many security groups, so every page is read
+	var securityGroups []*ec2.SecurityGroup
+	err = t.ec2Client.DescribeSecurityGroupsPages(&ec2.DescribeSecurityGroupsInput{Filters: filters},
+		func(output *ec2.DescribeSecurityGroupsOutput, lastPage bool) bool {
+			// Overflow groups are in the vpc and tagged like the groups they belong to, but are filled by those
+			for _, securityGroup := range output.SecurityGroups {
+				if !isOverflowGroup(securityGroup) {
+					securityGroups = append(securityGroups, securityGroup)
+				}
+			}
+			return true
+		})
 
 	if err != nil {
 		logrus.Errorf("%v", err)
 		return nil, err
 	}
 
-	return securityGroupResult.SecurityGroups, nil
+	return securityGroups, nil
 }
 
-func getEc2Client(session *session.Session, credentials *credentials.Credentials, a *Aws) *ec2.EC2 {
-	return ec2.New(session, &aws.Config{
-		Credentials: credentials,
-		Region:      aws.String(a.Region),
-	})
+// getSecurityGroupFilters returns the ec2 filters matching the security groups with any of the ids and any
+// of the names, every tag, every tag key and the vpc of the filter. The label name and value are a tag too
+func (a *Aws) getSecurityGroupFilters(filter config.Filter) ([]*ec2.Filter, error) {
+	filters := a.getResourceFilters(filter, "group-id", "group-name")
+
+	// Without filters all security groups of the region would be whitelisted
+	if len(filters) == 0 {
+		return nil, errors.New("missing labelName, groupIds, groupNames, tags, tagKeys or vpcId to filter security groups")
+	}
+	return filters, nil
+}
+
+// getNetworkAclFilters returns the ec2 filters matching the network acls with any of the ids, every tag,
+// every tag key and the vpc of the filter. The group ids of the filter are network acl ids, and network
+// acls have no names to filter by
+func (a *Aws) getNetworkAclFilters(filter config.Filter) ([]*ec2.Filter, error) {
+	if len(filter.GroupNames) > 0 {
+		return nil, errors.New("groupNames cannot filter network acls, filter them by groupIds instead")
+	}
+	filters := a.getResourceFilters(filter, "network-acl-id", "")
+
+	// Without filters all network acls of the region would be whitelisted
+	if len(filters) == 0 {
+		return nil, errors.New("missing labelName, groupIds, tags, tagKeys or vpcId to filter network acls")
+	}
+	return filters, nil
+}
+
+// getResourceFilters returns the ec2 filters of the label, ids, names, tags, tag keys and vpc of the filter,
+// using the names of the id and name filters of the resource
+func (a *Aws) getResourceFilters(filter config.Filter, idFilterName string, nameFilterName string) []*ec2.Filter {
+	filters := make([]*ec2.Filter, 0)
+	if filter.LabelName != "" {
+		filters = append(filters, a.getSearchFilterWithTag(filter.LabelName, filter.LabelValue)...)
+	}
+	if len(filter.GroupIds) > 0 {
+		filters = append(filters, &ec2.Filter{Name: aws.String(idFilterName), Values: aws.StringSlice(filter.GroupIds)})
+	}
+	if len(filter.GroupNames) > 0 && nameFilterName != "" {
+		filters = append(filters, &ec2.Filter{Name: aws.String(nameFilterName), Values: aws.StringSlice(filter.GroupNames)})
+	}
+	tagNames := make([]string, 0, len(filter.Tags))
+	for tagName := range filter.Tags {
+		tagNames = append(tagNames, tagName)
+	}
+	sort.Strings(tagNames)
+	for _, tagName := range tagNames {
+		filters = append(filters, a.getSearchFilterWithTag(tagName, filter.Tags[tagName])...)
+	}
+	// Every tag key is a filter of its own, as the values of a filter match any of them
+	for _, tagKey := range filter.TagKeys {
+		filters = append(filters, &ec2.Filter{Name: aws.String("tag-key"), Values: aws.StringSlice([]string{tagKey})})
+	}
+	if filter.VpcId != "" {
+		filters = append(filters, &ec2.Filter{Name: aws.String("vpc-id"), Values: aws.StringSlice([]string{filter.VpcId})})
+	}
+	return filters
 }
 
 func (a *Aws) getSearchFilterWithTag(labelName string, labelValue string) []*ec2.Filter {
@@ -0,0 +1,365 @@
+package aws
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/servicequotas"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultRulesPerGroup is the default quota of inbound or outbound rules per security group, used when
+	// the quota cannot be read from Service Quotas
+	defaultRulesPerGroup = 60
+	// rulesPerGroupQuotaCode is the Service Quotas code of "Inbound or outbound rules per security group"
+	rulesPerGroupQuotaCode = "L-0EA8095F"
+	// overflowGroupTag is the tag of overflow security groups, its value is the id of the security group
+	// whose rules they hold
+	overflowGroupTag = "whitelister:overflow-of"
+)
+
+// rule is a cidr, security group or prefix list allowed on the port range of an ip permission, the unit
+// counted against the rules quota of a security group. The quota applies to ipv4 and ipv6 rules
+// separately, and a rule referencing a prefix list counts as the max entries of the prefix list
+type rule struct {
+	ipPermission    *ec2.IpPermission
+	ipRange         *ec2.IpRange
+	ipv6Range       *ec2.Ipv6Range
+	userIdGroupPair *ec2.UserIdGroupPair
+	prefixListId    *ec2.PrefixListId
+	ipv6            bool
+	size            int
+}
+
+// key identifies the rule by protocol, port range and cidr, security group or prefix list
+func (r rule) key() string {
+	var id string
+	switch {
+	case r.ipRange != nil:
+		id = aws.StringValue(r.ipRange.CidrIp)
+	case r.ipv6Range != nil:
+		id = aws.StringValue(r.ipv6Range.CidrIpv6)
+	case r.userIdGroupPair != nil:
+		id = aws.StringValue(r.userIdGroupPair.GroupId)
+	default:
+		id = aws.StringValue(r.prefixListId.PrefixListId)
+	}
+	return fmt.Sprintf("%s/%d/%d/%s", aws.StringValue(r.ipPermission.IpProtocol),
+		aws.Int64Value(r.ipPermission.FromPort), aws.Int64Value(r.ipPermission.ToPort), id)
+}
+
+// family returns 0 for ipv4 and 1 for ipv6 rules
+func (r rule) family() int {
+	if r.ipv6 {
+		return 1
+	}
+	return 0
+}
+
+// getRules splits ip permissions into rules. Security groups count as ipv4 rules, and prefix lists that
+// are not managed by Whitelister count as a single ipv4 rule, as their size is not known
+func getRules(ipPermissions []*ec2.IpPermission, managedPrefixLists map[string]*ec2.ManagedPrefixList) []rule {
+	var rules []rule
+	for _, ipPermission := range ipPermissions {
+		for _, ipRange := range ipPermission.IpRanges {
+			rules = append(rules, rule{ipPermission: ipPermission, ipRange: ipRange, size: 1})
+		}
+		for _, ipv6Range := range ipPermission.Ipv6Ranges {
+			rules = append(rules, rule{ipPermission: ipPermission, ipv6Range: ipv6Range, ipv6: true, size: 1})
+		}
+		for _, userIdGroupPair := range ipPermission.UserIdGroupPairs {
+			rules = append(rules, rule{ipPermission: ipPermission, userIdGroupPair: userIdGroupPair, size: 1})
+		}
+		for _, prefixListId := range ipPermission.PrefixListIds {
+			r := rule{ipPermission: ipPermission, prefixListId: prefixListId, size: 1}
+			if prefixList := managedPrefixLists[aws.StringValue(prefixListId.PrefixListId)]; prefixList != nil {
+				r.ipv6 = aws.StringValue(prefixList.AddressFamily) == "IPv6"
+				r.size = int(aws.Int64Value(prefixList.MaxEntries))
+			}
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// getIpPermissions groups rules back into ip permissions by the ip permission they were split from
+func getIpPermissions(rules []rule) []*ec2.IpPermission {
+	var ipPermissions []*ec2.IpPermission
+	grouped := map[*ec2.IpPermission]*ec2.IpPermission{}
+	for _, r := range rules {
+		ipPermission := grouped[r.ipPermission]
+		if ipPermission == nil {
+			ipPermission = &ec2.IpPermission{
+				FromPort:   r.ipPermission.FromPort,
+				ToPort:     r.ipPermission.ToPort,
+				IpProtocol: r.ipPermission.IpProtocol,
+			}
+			grouped[r.ipPermission] = ipPermission
+			ipPermissions = append(ipPermissions, ipPermission)
+		}
+		if r.ipRange != nil {
+			ipPermission.IpRanges = append(ipPermission.IpRanges, r.ipRange)
+		} else if r.ipv6Range != nil {
+			ipPermission.Ipv6Ranges = append(ipPermission.Ipv6Ranges, r.ipv6Range)
+		} else if r.userIdGroupPair != nil {
+			ipPermission.UserIdGroupPairs = append(ipPermission.UserIdGroupPairs, r.userIdGroupPair)
+		} else {
+			ipPermission.PrefixListIds = append(ipPermission.PrefixListIds, r.prefixListId)
+		}
+	}
+	return ipPermissions
+}
+
+// shardRules assigns the ingress or egress rules to the security groups, a security group followed by its
+// overflow groups. A rule stays in the group that already has it while it fits, so that a change of the
+// ips moves as few rules as possible, new rules go into the first group with room. Rules that are kept in
+// a group use up its room. It returns the rules of every group and the rules that fit in none of them
+func (a *Aws) shardRules(securityGroups []*ec2.SecurityGroup, direction string, rules []rule,
+	managedPrefixLists map[string]*ec2.ManagedPrefixList, rulesPerGroup int) ([][]rule, []rule) {
+
+	wanted := map[string]bool{}
+	for _, r := range rules {
+		wanted[r.key()] = true
+	}
+	current := map[string]int{}
+	used := make([][2]int, len(securityGroups))
+	for i, securityGroup := range securityGroups {
+		for _, ipPermission := range getSecurityGroupIpPermissions(securityGroup, direction) {
+			for _, r := range getRules([]*ec2.IpPermission{ipPermission}, managedPrefixLists) {
+				if wanted[r.key()] {
+					if _, ok := current[r.key()]; !ok {
+						current[r.key()] = i
+					}
+				} else if a.isKeptRule(r, managedPrefixLists) {
+					used[i][r.family()] += r.size
+				}
+			}
+		}
+	}
+
+	groupOfRule := make([]int, len(rules))
+	fits := func(i int, r rule) bool {
+		return used[i][r.family()]+r.size <= rulesPerGroup
+	}
+	var pending []int
+	for index, r := range rules {
+		if i, ok := current[r.key()]; ok && fits(i, r) {
+			used[i][r.family()] += r.size
+			groupOfRule[index] = i
+			continue
+		}
+		pending = append(pending, index)
+	}
+	var unassigned []rule
+	for _, index := range pending {
+		r := rules[index]
+		groupOfRule[index] = -1
+		for i := range securityGroups {
+			if fits(i, r) {
+				used[i][r.family()] += r.size
+				groupOfRule[index] = i
+				break
+			}
+		}
+		if groupOfRule[index] == -1 {
+			unassigned = append(unassigned, r)
+		}
+	}
+
+	assigned := make([][]rule, len(securityGroups))
+	for index, r := range rules {
+		if i := groupOfRule[index]; i != -1 {
+			assigned[i] = append(assigned[i], r)
+		}
+	}
+	return assigned, unassigned
+}
+
+// isKeptRule returns true if Whitelister does not remove the rule of a security group. Security groups
+// and prefix lists that Whitelister does not manage are only removed with RemoveReferences
+func (a *Aws) isKeptRule(r rule, managedPrefixLists map[string]*ec2.ManagedPrefixList) bool {
+	if !a.RemoveRule {
+		return true
+	}
+	var description *string
+	switch {
+	case r.ipRange != nil:
+		description = r.ipRange.Description
+	case r.ipv6Range != nil:
+		description = r.ipv6Range.Description
+	case r.userIdGroupPair != nil:
+		if !a.RemoveReferences {
+			return true
+		}
+		description = r.userIdGroupPair.Description
+	default:
+		if managedPrefixLists[aws.StringValue(r.prefixListId.PrefixListId)] != nil {
+			return false
+		}
+		if !a.RemoveReferences {
+			return true
+		}
+		description = r.prefixListId.Description
+	}
+	reg, _ := regexp.Compile(a.KeepRuleDescriptionPrefix + ".*$")
+	return description != nil && reg.MatchString(*description)
+}
+
+// getRulesPerGroup returns the configured RulesPerGroup, or reads the quota of rules per security group in
+// the target from Service Quotas on the first sync. The default quota is used if it cannot be read, e.g.
+// when the role may not call Service Quotas
+func (a *Aws) getRulesPerGroup(t *target) int {
+	if a.RulesPerGroup > 0 {
+		return a.RulesPerGroup
+	}
+	if t.rulesPerGroup > 0 {
+		return t.rulesPerGroup
+	}
+	output, err := t.quotasClient.GetServiceQuota(&servicequotas.GetServiceQuotaInput{
+		ServiceCode: aws.String("vpc"),
+		QuotaCode:   aws.String(rulesPerGroupQuotaCode),
+	})
+	if err != nil || output.Quota == nil || output.Quota.Value == nil {
+		logrus.Warnf("Unable to read the quota of rules per security group in %s, using the default of %d : %v",
+			t, defaultRulesPerGroup, err)
+		t.rulesPerGroup = defaultRulesPerGroup
+		return t.rulesPerGroup
+	}
+	t.rulesPerGroup = int(*output.Quota.Value)
+	logrus.Infof("Quota of rules per security group in %s is %d", t, t.rulesPerGroup)
+	return t.rulesPerGroup
+}
+
+// getOverflowGroups returns up to OverflowGroups overflow groups of a security group ordered by name
+func (a *Aws) getOverflowGroups(client ec2iface.EC2API, securityGroup *ec2.SecurityGroup) ([]*ec2.SecurityGroup, error) {
+	if a.OverflowGroups == 0 {
+		return nil, nil
+	}
+	output, err := client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("tag:" + overflowGroupTag),
+			Values: []*string{securityGroup.GroupId},
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to describe overflow groups of %s : %v", *securityGroup.GroupId, err)
+	}
+
+	overflowGroups := output.SecurityGroups
+	sort.Slice(overflowGroups, func(i, j int) bool {
+		return aws.StringValue(overflowGroups[i].GroupName) < aws.StringValue(overflowGroups[j].GroupName)
+	})
+	if len(overflowGroups) > a.OverflowGroups {
+		logrus.Warnf("Ignoring %d overflow groups of %s beyond OverflowGroups", len(overflowGroups)-a.OverflowGroups,
+			*securityGroup.GroupId)
+		overflowGroups = overflowGroups[:a.OverflowGroups]
+	}
+	return overflowGroups, nil
+}
+
+// isOverflowGroup returns true if the security group is an overflow group of another security group
+func isOverflowGroup(securityGroup *ec2.SecurityGroup) bool {
+	for _, tag := range securityGroup.Tags {
+		if aws.StringValue(tag.Key) == overflowGroupTag {
+			return true
+		}
+	}
+	return false
+}
+
+// createOverflowGroup creates the overflow group with the given number of a security group in its vpc. The
+// rule allowing all outbound traffic that a new security group has is revoked, so that attaching the
+// overflow group does not open the outbound traffic of the network interfaces
+func createOverflowGroup(client ec2iface.EC2API, securityGroup *ec2.SecurityGroup, number int) (*ec2.SecurityGroup, error) {
+	name := fmt.Sprintf("%s-overflow-%d", aws.StringValue(securityGroup.GroupName), number)
+	output, err := client.CreateSecurityGroup(&ec2.CreateSecurityGroupInput{
+		GroupName:   aws.String(name),
+		Description: aws.String("Whitelisted ips that do not fit in " + *securityGroup.GroupId),
+		VpcId:       securityGroup.VpcId,
+		TagSpecifications: []*ec2.TagSpecification{{
+			ResourceType: aws.String("security-group"),
+			Tags: []*ec2.Tag{
+				{Key: aws.String(overflowGroupTag), Value: securityGroup.GroupId},
+				{Key: aws.String("ManagedBy"), Value: aws.String("whitelister")},
+			},
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create overflow group %s : %v", name, err)
+	}
+	logrus.Infof("Created overflow group %s of %s : %s", name, *securityGroup.GroupId, *output.GroupId)
+
+	_, err = client.RevokeSecurityGroupEgress(&ec2.RevokeSecurityGroupEgressInput{
+		GroupId: output.GroupId,
+		IpPermissions: []*ec2.IpPermission{{
+			IpProtocol: aws.String("-1"),
+			IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to revoke the outbound rule of overflow group %s : %v", name, err)
+	}
+	return &ec2.SecurityGroup{GroupId: output.GroupId, GroupName: aws.String(name), VpcId: securityGroup.VpcId}, nil
+}
+
+// attachOverflowGroups adds the overflow groups to the network interfaces that the security group is
+// attached to. Network interfaces managed by AWS services, e.g. of load balancers, cannot be changed
+func attachOverflowGroups(client ec2iface.EC2API, securityGroup *ec2.SecurityGroup, overflowGroups []*ec2.SecurityGroup) error {
+	var networkInterfaces []*ec2.NetworkInterface
+	input := &ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("group-id"), Values: []*string{securityGroup.GroupId}}},
+	}
+	err := client.DescribeNetworkInterfacesPages(input, func(output *ec2.DescribeNetworkInterfacesOutput, lastPage bool) bool {
+		networkInterfaces = append(networkInterfaces, output.NetworkInterfaces...)
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to describe network interfaces of %s : %v", *securityGroup.GroupId, err)
+	}
+
+	var failures []string
+	for _, networkInterface := range networkInterfaces {
+		if aws.BoolValue(networkInterface.RequesterManaged) {
+			logrus.Warnf("Unable to attach overflow groups of %s to network interface %s managed by %s",
+				*securityGroup.GroupId, *networkInterface.NetworkInterfaceId, aws.StringValue(networkInterface.RequesterId))
+			continue
+		}
+		var groupIds []*string
+		attached := map[string]bool{}
+		for _, group := range networkInterface.Groups {
+			groupIds = append(groupIds, group.GroupId)
+			attached[aws.StringValue(group.GroupId)] = true
+		}
+		missing := 0
+		for _, overflowGroup := range overflowGroups {
+			if !attached[*overflowGroup.GroupId] {
+				groupIds = append(groupIds, overflowGroup.GroupId)
+				missing++
+			}
+		}
+		if missing == 0 {
+			continue
+		}
+		_, err := client.ModifyNetworkInterfaceAttribute(&ec2.ModifyNetworkInterfaceAttributeInput{
+			NetworkInterfaceId: networkInterface.NetworkInterfaceId,
+			Groups:             groupIds,
+		})
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s : %v", *networkInterface.NetworkInterfaceId, err))
+			continue
+		}
+		logrus.Infof("Attached %d overflow groups of %s to network interface %s", missing, *securityGroup.GroupId,
+			*networkInterface.NetworkInterfaceId)
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("Unable to attach overflow groups of %s to %d network interfaces : %s",
+			*securityGroup.GroupId, len(failures), strings.Join(failures, ", "))
+	}
+	return nil
+}
@@ -1,29 +1,55 @@
 package aws
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/sirupsen/logrus"
 	"github.com/stakater/Whitelister/internal/pkg/utils"
 )
 
-func (a *Aws) updateSecurityGroup(client *ec2.EC2, securityGroup *ec2.SecurityGroup,
+// rulesLimitExceededCode is the error code of adding more rules to a security group than its quota allows
+const rulesLimitExceededCode = "RulesPerSecurityGroupLimitExceeded"
+
+const (
+	// Ingress rules allow inbound traffic from the whitelisted ips
+	Ingress = "Ingress"
+	// Egress rules allow outbound traffic to the whitelisted ips
+	Egress = "Egress"
+)
+
+// updateSecurityGroup removes the rules that are not whitelisted if RemoveRule is set and adds the missing
+// rules. The rules are added even if removing failed, the errors of both are returned
+func (a *Aws) updateSecurityGroup(client ec2iface.EC2API, securityGroup *ec2.SecurityGroup, direction string,
 	ipPermissions []*ec2.IpPermission) error {
 
+	var failures []string
 	if a.RemoveRule {
-		a.removeSecurityRules(client, securityGroup, ipPermissions)
+		if err := a.removeSecurityRules(client, securityGroup, direction, ipPermissions); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if err := addSecurityRules(client, securityGroup, direction, ipPermissions); err != nil {
+		failures = append(failures, err.Error())
 	}
-	addSecurityRules(client, securityGroup, ipPermissions)
 
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, ", "))
+	}
 	return nil
 }
 
-func addSecurityRules(client *ec2.EC2, securityGroup *ec2.SecurityGroup, ipPermissions []*ec2.IpPermission) {
+func addSecurityRules(client ec2iface.EC2API, securityGroup *ec2.SecurityGroup, direction string, ipPermissions []*ec2.IpPermission) error {
 	var ipPermissionExists bool
 	var ipPermissionsToAdd []*ec2.IpPermission
 
 	for _, ipPermission := range ipPermissions {
 		ipPermissionExists = false
-		for _, securityGroupIpPermission := range securityGroup.IpPermissions {
+		for _, securityGroupIpPermission := range getSecurityGroupIpPermissions(securityGroup, direction) {
 			if utils.IsEc2IpPermissionEqual(ipPermission, securityGroupIpPermission) {
 				ipPermissionExists = true
 				break
@@ -34,21 +60,29 @@ func addSecurityRules(client *ec2.EC2, securityGroup *ec2.SecurityGroup, ipPermi
 		}
 	}
 	if len(ipPermissionsToAdd) > 0 {
-		logrus.Infof("Adding security rules : %v for security group :%s", ipPermissionsToAdd, *securityGroup.GroupName)
-		err := addSecurityGroupIngresses(client, securityGroup, ipPermissionsToAdd)
+		logrus.Infof("Adding %s security rules : %v for security group :%s", direction, ipPermissionsToAdd, *securityGroup.GroupName)
+		err := addSecurityGroupRules(client, securityGroup, direction, ipPermissionsToAdd)
 		if err != nil {
-			logrus.Errorf("Error adding security rules for security group %s : %v", *securityGroup.GroupName, err)
+			logrus.Errorf("Error adding %s security rules for security group %s : %v", direction, *securityGroup.GroupName, err)
+			if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == rulesLimitExceededCode {
+				return fmt.Errorf("No room for %s security rules in security group %s : %v, raise the quota of rules per "+
+					"security group or lower RulesPerGroup", direction, *securityGroup.GroupId, err)
+			}
+			return fmt.Errorf("Unable to add %s security rules to security group %s : %v", direction, *securityGroup.GroupId, err)
 		}
 	} else {
-		logrus.Infof("No security rules to add for security group : %s", *securityGroup.GroupName)
+		logrus.Infof("No %s security rules to add for security group : %s", direction, *securityGroup.GroupName)
 	}
+	return nil
 }
 
-func (a *Aws) removeSecurityRules(client *ec2.EC2, securityGroup *ec2.SecurityGroup, ipPermissions []*ec2.IpPermission) {
+func (a *Aws) removeSecurityRules(client ec2iface.EC2API, securityGroup *ec2.SecurityGroup, direction string,
+	ipPermissions []*ec2.IpPermission) error {
+
 	var removeIpPermission bool
 	var ipPermissionsToRemove []*ec2.IpPermission
 
-	securityGroupFilteredIpPermissions := a.filterIpPermissions(securityGroup.IpPermissions)
+	securityGroupFilteredIpPermissions := a.filterIpPermissions(getSecurityGroupIpPermissions(securityGroup, direction))
 
 	for _, securityGroupIpPermission := range securityGroupFilteredIpPermissions {
 		removeIpPermission = true
@@ -64,19 +98,46 @@ func (a *Aws) removeSecurityRules(client *ec2.EC2, securityGroup *ec2.SecurityGr
 	}
 
 	if len(ipPermissionsToRemove) > 0 {
-		logrus.Infof("Removing security rules : %v for security group :%s", ipPermissionsToRemove, *securityGroup.GroupName)
-		err := removeSecurityGroupIngresses(client, securityGroup, ipPermissionsToRemove)
+		logrus.Infof("Removing %s security rules : %v for security group :%s", direction, ipPermissionsToRemove, *securityGroup.GroupName)
+		err := removeSecurityGroupRules(client, securityGroup, direction, ipPermissionsToRemove)
 		if err != nil {
-			logrus.Errorf("Error removing security rules for security group %s : %v", *securityGroup.GroupName, err)
+			logrus.Errorf("Error removing %s security rules for security group %s : %v", direction, *securityGroup.GroupName, err)
+			return fmt.Errorf("Unable to remove %s security rules from security group %s : %v", direction, *securityGroup.GroupId, err)
 		}
 	} else {
-		logrus.Infof("No security rules to remove for security group : %s", *securityGroup.GroupName)
+		logrus.Infof("No %s security rules to remove for security group : %s", direction, *securityGroup.GroupName)
 	}
+	return nil
+}
+
+// getSecurityGroupIpPermissions returns the ingress or egress rules of the security group
+func getSecurityGroupIpPermissions(securityGroup *ec2.SecurityGroup, direction string) []*ec2.IpPermission {
+	if direction == Egress {
+		return securityGroup.IpPermissionsEgress
+	}
+	return securityGroup.IpPermissions
 }
 
-func addSecurityGroupIngresses(client *ec2.EC2, securityGroup *ec2.SecurityGroup,
+// setSecurityGroupIpPermissions replaces the ingress or egress rules of the security group
+func setSecurityGroupIpPermissions(securityGroup *ec2.SecurityGroup, direction string, ipPermissions []*ec2.IpPermission) {
+	if direction == Egress {
+		securityGroup.IpPermissionsEgress = ipPermissions
+		return
+	}
+	securityGroup.IpPermissions = ipPermissions
+}
+
+func addSecurityGroupRules(client ec2iface.EC2API, securityGroup *ec2.SecurityGroup, direction string,
 	ipPermissions []*ec2.IpPermission) error {
 
+	if direction == Egress {
+		_, err := client.AuthorizeSecurityGroupEgress(&ec2.AuthorizeSecurityGroupEgressInput{
+			GroupId:       securityGroup.GroupId,
+			IpPermissions: ipPermissions,
+		})
+		return err
+	}
+
 	_, err := client.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
 		GroupId:       securityGroup.GroupId,
 		IpPermissions: ipPermissions,
@@ -85,9 +146,17 @@ func addSecurityGroupIngresses(client *ec2.EC2, securityGroup *ec2.SecurityGroup
 	return err
 }
 
-func removeSecurityGroupIngresses(client *ec2.EC2, securityGroup *ec2.SecurityGroup,
+func removeSecurityGroupRules(client ec2iface.EC2API, securityGroup *ec2.SecurityGroup, direction string,
 	ipPermissions []*ec2.IpPermission) error {
 
+	if direction == Egress {
+		_, err := client.RevokeSecurityGroupEgress(&ec2.RevokeSecurityGroupEgressInput{
+			GroupId:       securityGroup.GroupId,
+			IpPermissions: ipPermissions,
+		})
+		return err
+	}
+
 	_, err := client.RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
 		GroupId:       securityGroup.GroupId,
 		IpPermissions: ipPermissions,
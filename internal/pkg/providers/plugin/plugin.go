@@ -0,0 +1,97 @@
+package plugin
+
+import (
+	"fmt"
+
+	clientset "k8s.io/client-go/kubernetes"
+
+	"github.com/stakater/Whitelister/internal/pkg/config"
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+	pluginClient "github.com/stakater/Whitelister/pkg/plugin"
+)
+
+// Plugin provider class implementing the Provider interface, it calls a provider plugin running out of process
+type Plugin struct {
+	Name         string
+	Path         string
+	client       *pluginClient.Client
+	targetGroups []string
+}
+
+// Init starts the plugin and passes the params to it
+func (p *Plugin) Init(params map[interface{}]interface{}, clientSet clientset.Interface) error {
+	p.client = pluginClient.NewClient(p.Path)
+	handshake, err := p.client.Handshake()
+	if err != nil {
+		return err
+	}
+	if !handshake.Provider {
+		p.client.Close()
+		return fmt.Errorf("Plugin %s is not a provider", p.Name)
+	}
+	return p.client.Init(pluginClient.MethodProviderInit, pluginClient.InitParams{Params: pluginClient.ConvertParams(params)})
+}
+
+// GetTargetGroups returns the ids of the resources updated by the last WhiteListIps call
+func (p *Plugin) GetTargetGroups() []string {
+	return p.targetGroups
+}
+
+// WhiteListIps passes the ip permissions to whitelist to the plugin
+func (p *Plugin) WhiteListIps(filter config.Filter, ipPermissions []utils.IpPermission) error {
+	p.targetGroups = nil
+
+	params := pluginClient.WhiteListIpsParams{
+		Filter: pluginClient.Filter{
+			FilterType: filter.FilterType.String(),
+			LabelName:  filter.LabelName,
+			LabelValue: filter.LabelValue,
+			GroupIds:   filter.GroupIds,
+			GroupNames: filter.GroupNames,
+			Tags:       filter.Tags,
+			TagKeys:    filter.TagKeys,
+			VpcId:      filter.VpcId,
+		},
+		IpPermissions: make([]pluginClient.IpPermission, 0, len(ipPermissions)),
+	}
+	for _, ipPermission := range ipPermissions {
+		pluginIpPermission := pluginClient.IpPermission{
+			FromPort:   *ipPermission.FromPort,
+			ToPort:     *ipPermission.ToPort,
+			IpProtocol: *ipPermission.IpProtocol,
+		}
+		for _, ipRange := range ipPermission.IpRanges {
+			pluginIpRange := pluginClient.IpRange{IpCidr: *ipRange.IpCidr}
+			if ipRange.Description != nil {
+				pluginIpRange.Description = *ipRange.Description
+			}
+			pluginIpPermission.IpRanges = append(pluginIpPermission.IpRanges, pluginIpRange)
+		}
+		for _, userIdGroupPair := range ipPermission.UserIdGroupPairs {
+			pluginUserIdGroupPair := pluginClient.UserIdGroupPair{GroupId: *userIdGroupPair.GroupId}
+			if userIdGroupPair.UserId != nil {
+				pluginUserIdGroupPair.UserId = *userIdGroupPair.UserId
+			}
+			if userIdGroupPair.Description != nil {
+				pluginUserIdGroupPair.Description = *userIdGroupPair.Description
+			}
+			pluginIpPermission.UserIdGroupPairs = append(pluginIpPermission.UserIdGroupPairs, pluginUserIdGroupPair)
+		}
+		for _, prefixListId := range ipPermission.PrefixListIds {
+			pluginPrefixListId := pluginClient.PrefixListId{PrefixListId: *prefixListId.PrefixListId}
+			if prefixListId.Description != nil {
+				pluginPrefixListId.Description = *prefixListId.Description
+			}
+			pluginIpPermission.PrefixListIds = append(pluginIpPermission.PrefixListIds, pluginPrefixListId)
+		}
+		params.IpPermissions = append(params.IpPermissions, pluginIpPermission)
+	}
+
+	var result pluginClient.WhiteListIpsResult
+	err := p.client.Call(pluginClient.MethodWhiteListIps, params, &result)
+	if err != nil {
+		return err
+	}
+	p.targetGroups = result.TargetGroups
+	return nil
+}
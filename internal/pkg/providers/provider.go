@@ -6,7 +6,10 @@ import (
 
 	"github.com/stakater/Whitelister/internal/pkg/config"
 	"github.com/stakater/Whitelister/internal/pkg/providers/aws"
+	"github.com/stakater/Whitelister/internal/pkg/providers/plugin"
+	"github.com/stakater/Whitelister/internal/pkg/providers/waf"
 	"github.com/stakater/Whitelister/internal/pkg/utils"
+	pluginClient "github.com/stakater/Whitelister/pkg/plugin"
 )
 
 // Provider interface so that providers like aws, google cloud can implement this
@@ -15,6 +18,11 @@ type Provider interface {
 	WhiteListIps(filter config.Filter, ipPermissions []utils.IpPermission) error
 }
 
+// TargetReporter is implemented by providers that can report the resources updated by the last WhiteListIps call
+type TargetReporter interface {
+	GetTargetGroups() []string
+}
+
 // PopulateFromConfig populates the IpProvider from config
 func PopulateFromConfig(configProvider config.Provider, clientset clientset.Interface) Provider {
 	providerToAdd := MapToProvider(configProvider.Name)
@@ -32,6 +40,10 @@ func PopulateFromConfig(configProvider config.Provider, clientset clientset.Inte
 func MapToProvider(providerName string) Provider {
 	ipProvider, ok := providerMap[providerName]
 	if !ok {
+		// Providers that are not built in can be plugins in the plugin directory
+		if path, ok := pluginClient.Find(providerName); ok {
+			return &plugin.Plugin{Name: providerName, Path: path}
+		}
 		logrus.Errorf("Cannot find an provider for : %s", providerName)
 		return nil
 	}
@@ -39,5 +51,6 @@ func MapToProvider(providerName string) Provider {
 }
 
 var providerMap = map[string]Provider{
-	"aws": &aws.Aws{},
+	"aws":     &aws.Aws{},
+	"aws-waf": &waf.Waf{},
 }
@@ -0,0 +1,130 @@
+package waf
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/wafv2"
+	"github.com/aws/aws-sdk-go/service/wafv2/wafv2iface"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// maxLockRetries is how many times an ip set is read and updated again when another client changed it
+	// between reading and updating it
+	maxLockRetries = 3
+	// ipSetDescription is the description of the ip sets created by Whitelister
+	ipSetDescription = "Whitelisted ips managed by whitelister"
+)
+
+// getIPSets returns the ip sets of the scope by name
+func getIPSets(client wafv2iface.WAFV2API, scope string) (map[string]*wafv2.IPSetSummary, error) {
+	ipSets := map[string]*wafv2.IPSetSummary{}
+	input := &wafv2.ListIPSetsInput{Scope: aws.String(scope)}
+	for {
+		output, err := client.ListIPSets(input)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to list ip sets in scope %s : %v", scope, err)
+		}
+		for _, ipSet := range output.IPSets {
+			ipSets[*ipSet.Name] = ipSet
+		}
+		if aws.StringValue(output.NextMarker) == "" || len(output.IPSets) == 0 {
+			return ipSets, nil
+		}
+		input.NextMarker = output.NextMarker
+	}
+}
+
+// syncIPSet replaces the addresses of the ip set, keeping the addresses that are not whitelisted unless
+// RemoveRule is set. WAF rejects an update with the lock token of an older version of the ip set, the ip
+// set is then read and updated again
+func (w *Waf) syncIPSet(ipSet *wafv2.IPSetSummary, addresses []string) error {
+	for attempt := 1; ; attempt++ {
+		output, err := w.client.GetIPSet(&wafv2.GetIPSetInput{Id: ipSet.Id, Name: ipSet.Name, Scope: aws.String(w.Scope)})
+		if err != nil {
+			return fmt.Errorf("Unable to get ip set %s : %v", *ipSet.Name, err)
+		}
+
+		existing := aws.StringValueSlice(output.IPSet.Addresses)
+		wanted := addresses
+		if !w.RemoveRule {
+			wanted = union(existing, addresses)
+		}
+		if isEqual(existing, wanted) {
+			logrus.Infof("No addresses to change for ip set : %s", *ipSet.Name)
+			return nil
+		}
+
+		logrus.Infof("Updating ip set %s from %d to %d addresses", *ipSet.Name, len(existing), len(wanted))
+		_, err = w.client.UpdateIPSet(&wafv2.UpdateIPSetInput{
+			Id:          ipSet.Id,
+			Name:        ipSet.Name,
+			Scope:       aws.String(w.Scope),
+			Description: output.IPSet.Description,
+			Addresses:   aws.StringSlice(wanted),
+			LockToken:   output.LockToken,
+		})
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == wafv2.ErrCodeWAFOptimisticLockException && attempt <= maxLockRetries {
+			logrus.Warnf("Ip set %s changed while updating it, retrying", *ipSet.Name)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to update ip set %s : %v", *ipSet.Name, err)
+		}
+		return nil
+	}
+}
+
+// createIPSet creates an ip set of the ip version with the addresses
+func createIPSet(client wafv2iface.WAFV2API, name string, scope string, ipAddressVersion string,
+	addresses []string) (*wafv2.IPSetSummary, error) {
+
+	output, err := client.CreateIPSet(&wafv2.CreateIPSetInput{
+		Name:             aws.String(name),
+		Scope:            aws.String(scope),
+		IPAddressVersion: aws.String(ipAddressVersion),
+		Addresses:        aws.StringSlice(addresses),
+		Description:      aws.String(ipSetDescription),
+		Tags:             []*wafv2.Tag{{Key: aws.String("ManagedBy"), Value: aws.String("whitelister")}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create ip set %s : %v", name, err)
+	}
+	logrus.Infof("Created ip set %s with %d addresses : %s", name, len(addresses), aws.StringValue(output.Summary.Id))
+	return output.Summary, nil
+}
+
+// union returns the sorted addresses of both lists without duplicates
+func union(addresses []string, otherAddresses []string) []string {
+	seen := map[string]bool{}
+	var merged []string
+	for _, address := range append(append([]string{}, addresses...), otherAddresses...) {
+		if !seen[address] {
+			seen[address] = true
+			merged = append(merged, address)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// isEqual checks if both lists have the same addresses in any order
+func isEqual(addresses []string, otherAddresses []string) bool {
+	if len(addresses) != len(otherAddresses) {
+		return false
+	}
+	counts := map[string]int{}
+	for _, address := range addresses {
+		counts[address]++
+	}
+	for _, address := range otherAddresses {
+		if counts[address] == 0 {
+			return false
+		}
+		counts[address]--
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package waf
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/wafv2"
+	"github.com/aws/aws-sdk-go/service/wafv2/wafv2iface"
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"github.com/stakater/Whitelister/internal/pkg/config"
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+	awsClient "github.com/stakater/Whitelister/pkg/aws"
+)
+
+// cloudFrontRegion is the region of the ip sets of the CLOUDFRONT scope
+const cloudFrontRegion = "us-east-1"
+
+// Waf provider class implementing the Provider interface, it whitelists the ips in WAFv2 ip sets that
+// web acls of load balancers, API gateways or CloudFront distributions allow. The ipv4 and ipv6 cidrs go
+// into separate ip sets, as an ip set holds a single ip version
+type Waf struct {
+	awsClient.Options `mapstructure:",squash"`
+	Region            string
+	Scope             string
+	IPSetName         string
+	IPv6IPSetName     string
+	CreateIPSets      bool
+	RemoveRule        bool
+	client            wafv2iface.WAFV2API
+	targetGroups      []string
+}
+
+// GetName Returns name of provider
+func (w *Waf) GetName() string {
+	return "Amazon Web Services WAF"
+}
+
+// Init initializes the Waf Provider Configuration like the role to assume and the ip sets to update
+func (w *Waf) Init(params map[interface{}]interface{}, clientSet clientset.Interface) error {
+	err := mapstructure.Decode(params, w) //Converts the params to Waf struct fields
+	if err != nil {
+		return err
+	}
+
+	if w.Scope == "" {
+		w.Scope = wafv2.ScopeRegional
+	}
+	switch w.Scope {
+	case wafv2.ScopeRegional:
+		if w.Region == "" {
+			return errors.New("Missing Aws Waf Region")
+		}
+	case wafv2.ScopeCloudfront:
+		if w.Region == "" {
+			w.Region = cloudFrontRegion
+		}
+		if w.Region != cloudFrontRegion {
+			return fmt.Errorf("Invalid Aws Waf Region %s, ip sets of scope %s are in %s", w.Region, w.Scope, cloudFrontRegion)
+		}
+	default:
+		return fmt.Errorf("Invalid Aws Waf Scope %s", w.Scope)
+	}
+	if w.IPSetName == "" {
+		return errors.New("Missing Aws Waf IPSetName")
+	}
+	if w.IPv6IPSetName == "" {
+		w.IPv6IPSetName = w.IPSetName + "-ipv6"
+	}
+	if w.IPv6IPSetName == w.IPSetName {
+		return errors.New("Aws Waf IPv6IPSetName must differ from IPSetName")
+	}
+	return w.Options.Validate()
+}
+
+// GetTargetGroups returns the arns of the ip sets updated by the last WhiteListIps call
+func (w *Waf) GetTargetGroups() []string {
+	return w.targetGroups
+}
+
+// WhiteListIps - Get List of IP addresses to whitelist. Ip sets have no ports, so the cidrs of all ip
+// permissions are whitelisted, and the filter is not used as the ip sets are named
+func (w *Waf) WhiteListIps(filter config.Filter, ipPermissions []utils.IpPermission) error {
+	w.targetGroups = nil
+	err := w.connect()
+	if err != nil {
+		return err
+	}
+
+	ipSets, err := getIPSets(w.client, w.Scope)
+	if err != nil {
+		return err
+	}
+
+	ipv4Addresses, ipv6Addresses := getAddresses(ipPermissions)
+	lists := []struct {
+		name             string
+		ipAddressVersion string
+		addresses        []string
+	}{
+		{w.IPSetName, wafv2.IPAddressVersionIpv4, ipv4Addresses},
+		{w.IPv6IPSetName, wafv2.IPAddressVersionIpv6, ipv6Addresses},
+	}
+
+	var failures []string
+	for _, list := range lists {
+		ipSet := ipSets[list.name]
+		// The ipv6 ip set is optional until there are ipv6 cidrs to whitelist
+		if ipSet == nil && list.ipAddressVersion == wafv2.IPAddressVersionIpv6 && len(list.addresses) == 0 {
+			continue
+		}
+		if ipSet == nil && !w.CreateIPSets {
+			failures = append(failures, fmt.Sprintf("Unable to find ip set %s in scope %s", list.name, w.Scope))
+			continue
+		}
+
+		if ipSet == nil {
+			ipSet, err = createIPSet(w.client, list.name, w.Scope, list.ipAddressVersion, list.addresses)
+		} else {
+			err = w.syncIPSet(ipSet, list.addresses)
+		}
+		if err != nil {
+			logrus.Errorf("%v", err)
+			failures = append(failures, err.Error())
+			continue
+		}
+		w.targetGroups = append(w.targetGroups, *ipSet.ARN)
+	}
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// getAddresses returns the sorted ipv4 and ipv6 cidrs of the ip permissions without duplicates
+func getAddresses(ipPermissions []utils.IpPermission) ([]string, []string) {
+	var ipv4Addresses, ipv6Addresses []string
+	seen := map[string]bool{}
+	for _, ipPermission := range ipPermissions {
+		if len(ipPermission.UserIdGroupPairs) > 0 || len(ipPermission.PrefixListIds) > 0 {
+			logrus.Warnf("Ignoring security groups and prefix lists, ip sets only hold cidrs")
+		}
+		for _, ipRange := range ipPermission.IpRanges {
+			if ipRange.IpCidr == nil || seen[*ipRange.IpCidr] {
+				continue
+			}
+			seen[*ipRange.IpCidr] = true
+			if strings.Contains(*ipRange.IpCidr, ":") {
+				ipv6Addresses = append(ipv6Addresses, *ipRange.IpCidr)
+			} else {
+				ipv4Addresses = append(ipv4Addresses, *ipRange.IpCidr)
+			}
+		}
+	}
+	sort.Strings(ipv4Addresses)
+	sort.Strings(ipv6Addresses)
+	return ipv4Addresses, ipv6Addresses
+}
+
+// connect creates the client on the first sync, later syncs reuse it. The client refreshes the
+// credentials of the assumed role before they expire
+func (w *Waf) connect() error {
+	if w.client != nil {
+		return nil
+	}
+	awsSession, roleCredentials, err := w.Options.GetSession(w.Region)
+	if err != nil {
+		return err
+	}
+	w.client = wafv2.New(awsSession, w.Options.GetWafConfig(roleCredentials, w.Region))
+	return nil
+}
@@ -0,0 +1,287 @@
+package waf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/wafv2"
+	"github.com/aws/aws-sdk-go/service/wafv2/wafv2iface"
+
+	"github.com/stakater/Whitelister/internal/pkg/config"
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+)
+
+// fakeWafv2 keeps ip sets in memory and bumps their lock token on every update. It changes an ip set
+// behind the back of the caller conflicts times, as another client updating it would
+type fakeWafv2 struct {
+	wafv2iface.WAFV2API
+	ipSets    map[string]*wafv2.IPSet
+	versions  map[string]int
+	conflicts int
+	updates   int
+}
+
+func newFakeWafv2(ipSets ...*wafv2.IPSet) *fakeWafv2 {
+	f := &fakeWafv2{ipSets: map[string]*wafv2.IPSet{}, versions: map[string]int{}}
+	for _, ipSet := range ipSets {
+		f.ipSets[*ipSet.Name] = ipSet
+	}
+	return f
+}
+
+func (f *fakeWafv2) ListIPSets(input *wafv2.ListIPSetsInput) (*wafv2.ListIPSetsOutput, error) {
+	var names []string
+	for name := range f.ipSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// One ip set per page to go through the pages
+	start := 0
+	if input.NextMarker != nil {
+		fmt.Sscanf(*input.NextMarker, "%d", &start)
+	}
+	output := &wafv2.ListIPSetsOutput{}
+	if start < len(names) {
+		ipSet := f.ipSets[names[start]]
+		output.IPSets = []*wafv2.IPSetSummary{{Id: ipSet.Id, Name: ipSet.Name, ARN: ipSet.ARN}}
+		output.NextMarker = aws.String(fmt.Sprintf("%d", start+1))
+	}
+	return output, nil
+}
+
+func (f *fakeWafv2) GetIPSet(input *wafv2.GetIPSetInput) (*wafv2.GetIPSetOutput, error) {
+	ipSet, ok := f.ipSets[*input.Name]
+	if !ok {
+		return nil, awserr.New(wafv2.ErrCodeWAFNonexistentItemException, "not found", nil)
+	}
+	copied := *ipSet
+	return &wafv2.GetIPSetOutput{IPSet: &copied, LockToken: aws.String(fmt.Sprintf("%d", f.versions[*input.Name]))}, nil
+}
+
+func (f *fakeWafv2) UpdateIPSet(input *wafv2.UpdateIPSetInput) (*wafv2.UpdateIPSetOutput, error) {
+	if f.conflicts > 0 {
+		f.conflicts--
+		f.versions[*input.Name]++
+	}
+	if *input.LockToken != fmt.Sprintf("%d", f.versions[*input.Name]) {
+		return nil, awserr.New(wafv2.ErrCodeWAFOptimisticLockException, "stale lock token", nil)
+	}
+	f.updates++
+	f.versions[*input.Name]++
+	f.ipSets[*input.Name].Addresses = input.Addresses
+	f.ipSets[*input.Name].Description = input.Description
+	return &wafv2.UpdateIPSetOutput{}, nil
+}
+
+func (f *fakeWafv2) CreateIPSet(input *wafv2.CreateIPSetInput) (*wafv2.CreateIPSetOutput, error) {
+	ipSet := &wafv2.IPSet{
+		Id: aws.String("id-" + *input.Name), Name: input.Name, ARN: aws.String("arn:" + *input.Name),
+		IPAddressVersion: input.IPAddressVersion, Addresses: input.Addresses, Description: input.Description,
+	}
+	f.ipSets[*input.Name] = ipSet
+	return &wafv2.CreateIPSetOutput{Summary: &wafv2.IPSetSummary{Id: ipSet.Id, Name: ipSet.Name, ARN: ipSet.ARN}}, nil
+}
+
+func newIPSet(name string, addresses ...string) *wafv2.IPSet {
+	return &wafv2.IPSet{
+		Id: aws.String("id-" + name), Name: aws.String(name), ARN: aws.String("arn:" + name),
+		Addresses: aws.StringSlice(addresses), Description: aws.String("office"),
+	}
+}
+
+func TestWafInit(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     map[interface{}]interface{}
+		wantRegion string
+		wantScope  string
+		wantIPv6   string
+		wantErr    error
+	}{
+		{
+			name:       "Init with regional ip set",
+			params:     map[interface{}]interface{}{"Region": "us-west-2", "IPSetName": "whitelister"},
+			wantRegion: "us-west-2",
+			wantScope:  "REGIONAL",
+			wantIPv6:   "whitelister-ipv6",
+		},
+		{
+			name:       "Init with cloudfront ip sets",
+			params:     map[interface{}]interface{}{"Scope": "CLOUDFRONT", "IPSetName": "whitelister", "IPv6IPSetName": "whitelister-v6"},
+			wantRegion: "us-east-1",
+			wantScope:  "CLOUDFRONT",
+			wantIPv6:   "whitelister-v6",
+		},
+		{
+			name:    "Init with cloudfront ip sets in another region",
+			params:  map[interface{}]interface{}{"Scope": "CLOUDFRONT", "Region": "us-west-2", "IPSetName": "whitelister"},
+			wantErr: errors.New("Invalid Aws Waf Region us-west-2, ip sets of scope CLOUDFRONT are in us-east-1"),
+		},
+		{
+			name:    "Init with invalid scope",
+			params:  map[interface{}]interface{}{"Scope": "GLOBAL", "Region": "us-west-2", "IPSetName": "whitelister"},
+			wantErr: errors.New("Invalid Aws Waf Scope GLOBAL"),
+		},
+		{
+			name:    "Init without region",
+			params:  map[interface{}]interface{}{"IPSetName": "whitelister"},
+			wantErr: errors.New("Missing Aws Waf Region"),
+		},
+		{
+			name:    "Init without ip set name",
+			params:  map[interface{}]interface{}{"Region": "us-west-2"},
+			wantErr: errors.New("Missing Aws Waf IPSetName"),
+		},
+		{
+			name:    "Init with the same ip set for ipv6",
+			params:  map[interface{}]interface{}{"Region": "us-west-2", "IPSetName": "whitelister", "IPv6IPSetName": "whitelister"},
+			wantErr: errors.New("Aws Waf IPv6IPSetName must differ from IPSetName"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Waf{}
+			err := w.Init(tt.params, nil)
+			if tt.wantErr != nil {
+				if err == nil || err.Error() != tt.wantErr.Error() {
+					t.Errorf("Waf.Init() Got Err: %v, Wanted Err: %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Waf.Init() Got Err: %v", err)
+			}
+			if w.Region != tt.wantRegion || w.Scope != tt.wantScope || w.IPv6IPSetName != tt.wantIPv6 {
+				t.Errorf("Got region %s, scope %s and ipv6 ip set %s, wanted %s, %s and %s", w.Region, w.Scope,
+					w.IPv6IPSetName, tt.wantRegion, tt.wantScope, tt.wantIPv6)
+			}
+		})
+	}
+}
+
+func TestWhiteListIps(t *testing.T) {
+	port := int64(443)
+	ipPermissions := []utils.IpPermission{
+		{
+			FromPort: &port, ToPort: &port, IpProtocol: aws.String("tcp"),
+			IpRanges: []*utils.IpRange{
+				{IpCidr: aws.String("10.0.0.2/32"), Description: aws.String("vpn")},
+				{IpCidr: aws.String("2001:db8::/64"), Description: aws.String("office")},
+			},
+		},
+		{
+			FromPort: aws.Int64(80), ToPort: aws.Int64(80), IpProtocol: aws.String("tcp"),
+			IpRanges: []*utils.IpRange{
+				{IpCidr: aws.String("10.0.0.1/32"), Description: aws.String("office")},
+				{IpCidr: aws.String("10.0.0.2/32"), Description: aws.String("vpn")},
+			},
+		},
+	}
+
+	tests := []struct {
+		name             string
+		params           map[interface{}]interface{}
+		client           *fakeWafv2
+		wantAddresses    map[string][]string
+		wantTargetGroups []string
+		wantErr          string
+	}{
+		{
+			name:   "ip sets updated",
+			params: map[interface{}]interface{}{"RemoveRule": true},
+			client: newFakeWafv2(newIPSet("whitelister", "10.0.0.9/32"), newIPSet("whitelister-ipv6")),
+			wantAddresses: map[string][]string{
+				"whitelister": {"10.0.0.1/32", "10.0.0.2/32"}, "whitelister-ipv6": {"2001:db8::/64"},
+			},
+			wantTargetGroups: []string{"arn:whitelister", "arn:whitelister-ipv6"},
+		},
+		{
+			name:   "addresses kept without RemoveRule",
+			client: newFakeWafv2(newIPSet("whitelister", "10.0.0.9/32"), newIPSet("whitelister-ipv6")),
+			wantAddresses: map[string][]string{
+				"whitelister": {"10.0.0.1/32", "10.0.0.2/32", "10.0.0.9/32"}, "whitelister-ipv6": {"2001:db8::/64"},
+			},
+			wantTargetGroups: []string{"arn:whitelister", "arn:whitelister-ipv6"},
+		},
+		{
+			name:   "ip set changed by another client while updating it",
+			params: map[interface{}]interface{}{"RemoveRule": true},
+			client: &fakeWafv2{
+				ipSets:    map[string]*wafv2.IPSet{"whitelister": newIPSet("whitelister"), "whitelister-ipv6": newIPSet("whitelister-ipv6")},
+				versions:  map[string]int{},
+				conflicts: 2,
+			},
+			wantAddresses: map[string][]string{
+				"whitelister": {"10.0.0.1/32", "10.0.0.2/32"}, "whitelister-ipv6": {"2001:db8::/64"},
+			},
+			wantTargetGroups: []string{"arn:whitelister", "arn:whitelister-ipv6"},
+		},
+		{
+			name:   "missing ip sets created",
+			params: map[interface{}]interface{}{"RemoveRule": true, "CreateIPSets": true},
+			client: newFakeWafv2(),
+			wantAddresses: map[string][]string{
+				"whitelister": {"10.0.0.1/32", "10.0.0.2/32"}, "whitelister-ipv6": {"2001:db8::/64"},
+			},
+			wantTargetGroups: []string{"arn:whitelister", "arn:whitelister-ipv6"},
+		},
+		{
+			name:             "missing ip set",
+			params:           map[interface{}]interface{}{"RemoveRule": true},
+			client:           newFakeWafv2(newIPSet("whitelister")),
+			wantAddresses:    map[string][]string{"whitelister": {"10.0.0.1/32", "10.0.0.2/32"}},
+			wantTargetGroups: []string{"arn:whitelister"},
+			wantErr:          "Unable to find ip set whitelister-ipv6 in scope REGIONAL",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := map[interface{}]interface{}{"Region": "us-west-2", "IPSetName": "whitelister"}
+			for key, value := range tt.params {
+				params[key] = value
+			}
+			w := &Waf{}
+			if err := w.Init(params, nil); err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			w.client = tt.client
+
+			err := w.WhiteListIps(config.Filter{}, ipPermissions)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("Got Err: %v, Wanted Err: %s", err, tt.wantErr)
+			}
+
+			gotAddresses := map[string][]string{}
+			for name, ipSet := range tt.client.ipSets {
+				addresses := aws.StringValueSlice(ipSet.Addresses)
+				sort.Strings(addresses)
+				gotAddresses[name] = addresses
+			}
+			if !reflect.DeepEqual(gotAddresses, tt.wantAddresses) {
+				t.Errorf("Got addresses = %v, wanted %v", gotAddresses, tt.wantAddresses)
+			}
+			if !reflect.DeepEqual(w.GetTargetGroups(), tt.wantTargetGroups) {
+				t.Errorf("Got target groups = %v, wanted %v", w.GetTargetGroups(), tt.wantTargetGroups)
+			}
+		})
+	}
+}
+
+func TestSyncIPSetGivesUpOnConflicts(t *testing.T) {
+	client := newFakeWafv2(newIPSet("whitelister"))
+	client.conflicts = maxLockRetries + 1
+	w := &Waf{Scope: wafv2.ScopeRegional, RemoveRule: true, client: client}
+
+	err := w.syncIPSet(&wafv2.IPSetSummary{Id: aws.String("id-whitelister"), Name: aws.String("whitelister")}, []string{"10.0.0.1/32"})
+	if err == nil || client.updates != 0 {
+		t.Errorf("Got Err: %v and %d updates, wanted the lock error after %d retries", err, client.updates, maxLockRetries)
+	}
+}
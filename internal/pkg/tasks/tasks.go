@@ -1,6 +1,9 @@
 package tasks
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/sirupsen/logrus"
 	clientset "k8s.io/client-go/kubernetes"
 
@@ -29,16 +32,36 @@ func NewTask(clientSet clientset.Interface, ipProviders []ipProviders.IpProvider
 	}
 }
 
-// PerformTasks handles all tasks
+// PerformTasks handles all tasks. If an ip provider fails the provider is not called, as whitelisting
+// the ips of the other ip providers would remove the rules of the ips that could not be read
 func (t *Task) PerformTasks() {
 	combinedIPPermissions := []utils.IpPermission{}
+	var failures []string
 	for _, ipProvider := range t.ipProviders {
 		ipList, err := ipProvider.GetIPPermissions()
 		if err != nil {
 			logrus.Errorf("Error getting Ip list from provider: %s\n err: %v", ipProvider.GetName(), err)
+			failures = append(failures, fmt.Sprintf("%s : %v", ipProvider.GetName(), err))
+			continue
 		}
 		combinedIPPermissions = utils.CombineIpPermission(combinedIPPermissions, ipList)
 	}
 
-	_ = t.provider.WhiteListIps(t.config.Filter, combinedIPPermissions)
+	var err error
+	var targetGroups []string
+	if len(failures) > 0 {
+		err = fmt.Errorf("Unable to get ips from %d ip providers, skipping the sync : %s", len(failures),
+			strings.Join(failures, ", "))
+		logrus.Errorf("%v", err)
+	} else {
+		err = t.provider.WhiteListIps(t.config.Filter, combinedIPPermissions)
+		if targetReporter, ok := t.provider.(providers.TargetReporter); ok {
+			targetGroups = targetReporter.GetTargetGroups()
+		}
+	}
+	for _, ipProvider := range t.ipProviders {
+		if statusWriter, ok := ipProvider.(ipProviders.StatusWriter); ok {
+			statusWriter.WriteStatus(targetGroups, err)
+		}
+	}
 }
@@ -0,0 +1,105 @@
+package tasks
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	clientset "k8s.io/client-go/kubernetes"
+
+	"github.com/stakater/Whitelister/internal/pkg/config"
+	"github.com/stakater/Whitelister/internal/pkg/ipProviders"
+	"github.com/stakater/Whitelister/internal/pkg/utils"
+)
+
+// fakeIpProvider returns fixed ip permissions, or fails if err is set, and records the status it is given
+type fakeIpProvider struct {
+	ipPermissions []utils.IpPermission
+	err           error
+	targetGroups  []string
+	statusErr     error
+}
+
+func (f *fakeIpProvider) Init(params map[interface{}]interface{}) error { return nil }
+
+func (f *fakeIpProvider) GetIPPermissions() ([]utils.IpPermission, error) {
+	return f.ipPermissions, f.err
+}
+
+func (f *fakeIpProvider) GetName() string { return "fake" }
+
+func (f *fakeIpProvider) WriteStatus(targetGroups []string, err error) {
+	f.targetGroups, f.statusErr = targetGroups, err
+}
+
+// fakeProvider records the ip permissions it whitelists
+type fakeProvider struct {
+	calls         int
+	ipPermissions []utils.IpPermission
+}
+
+func (f *fakeProvider) Init(params map[interface{}]interface{}, clientSet clientset.Interface) error {
+	return nil
+}
+
+func (f *fakeProvider) WhiteListIps(filter config.Filter, ipPermissions []utils.IpPermission) error {
+	f.calls++
+	f.ipPermissions = ipPermissions
+	return nil
+}
+
+func (f *fakeProvider) GetTargetGroups() []string {
+	return []string{"sg-1"}
+}
+
+func TestPerformTasks(t *testing.T) {
+	port := int64(443)
+	ipProtocol := "tcp"
+	ipCidr := "10.0.0.1/32"
+	ipPermission := utils.IpPermission{
+		FromPort: &port, ToPort: &port, IpProtocol: &ipProtocol,
+		IpRanges: []*utils.IpRange{{IpCidr: &ipCidr}},
+	}
+
+	tests := []struct {
+		name             string
+		err              error
+		wantCalls        int
+		wantTargetGroups []string
+		wantStatusErr    bool
+	}{
+		{
+			name:             "ips whitelisted",
+			wantCalls:        1,
+			wantTargetGroups: []string{"sg-1"},
+		},
+		{
+			name:          "sync skipped when an ip provider fails",
+			err:           errors.New("exit status 1"),
+			wantStatusErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			working := &fakeIpProvider{ipPermissions: []utils.IpPermission{ipPermission}}
+			failing := &fakeIpProvider{err: tt.err}
+			provider := &fakeProvider{}
+			task := NewTask(nil, []ipProviders.IpProvider{working, failing}, provider, config.Config{})
+
+			task.PerformTasks()
+
+			if provider.calls != tt.wantCalls {
+				t.Errorf("Got %d calls of the provider, wanted %d", provider.calls, tt.wantCalls)
+			}
+			if tt.wantCalls > 0 && len(provider.ipPermissions) != 1 {
+				t.Errorf("Got ip permissions = %v, wanted those of the ip providers", provider.ipPermissions)
+			}
+			for _, ipProvider := range []*fakeIpProvider{working, failing} {
+				if !reflect.DeepEqual(ipProvider.targetGroups, tt.wantTargetGroups) || (ipProvider.statusErr != nil) != tt.wantStatusErr {
+					t.Errorf("Got status %v, %v, wanted target groups %v", ipProvider.targetGroups, ipProvider.statusErr,
+						tt.wantTargetGroups)
+				}
+			}
+		})
+	}
+}
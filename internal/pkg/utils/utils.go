@@ -7,17 +7,21 @@ import (
 )
 
 type IpPermission struct {
-	IpRanges   []*IpRange `yaml:"ipRanges"`
-	FromPort   *int64     `yaml:"fromPort"`
-	ToPort     *int64     `yaml:"toPort"`
-	IpProtocol *string    `yaml:"ipProtocol"`
+	IpRanges         []*IpRange         `yaml:"ipRanges" json:"ipRanges"`
+	UserIdGroupPairs []*UserIdGroupPair `yaml:"userIdGroupPairs" json:"userIdGroupPairs,omitempty"`
+	PrefixListIds    []*PrefixListId    `yaml:"prefixListIds" json:"prefixListIds,omitempty"`
+	FromPort         *int64             `yaml:"fromPort" json:"fromPort"`
+	ToPort           *int64             `yaml:"toPort" json:"toPort"`
+	IpProtocol       *string            `yaml:"ipProtocol" json:"ipProtocol"`
 }
 
 func (ipPermission1 *IpPermission) Equal(ipPermission2 *IpPermission) bool {
 	if *ipPermission1.FromPort != *ipPermission2.FromPort ||
 		*ipPermission1.ToPort != *ipPermission2.ToPort ||
 		*ipPermission1.IpProtocol != *ipPermission2.IpProtocol ||
-		len(ipPermission1.IpRanges) != len(ipPermission2.IpRanges) {
+		len(ipPermission1.IpRanges) != len(ipPermission2.IpRanges) ||
+		len(ipPermission1.UserIdGroupPairs) != len(ipPermission2.UserIdGroupPairs) ||
+		len(ipPermission1.PrefixListIds) != len(ipPermission2.PrefixListIds) {
 		return false
 	}
 
@@ -33,13 +37,39 @@ func (ipPermission1 *IpPermission) Equal(ipPermission2 *IpPermission) bool {
 			return false
 		}
 	}
+	for _, userIdGroupPair1 := range ipPermission1.UserIdGroupPairs {
+		contains := false
+		for _, userIdGroupPair2 := range ipPermission2.UserIdGroupPairs {
+			if userIdGroupPair1.Equal(userIdGroupPair2) {
+				contains = true
+				break
+			}
+		}
+		if !contains {
+			return false
+		}
+	}
+	for _, prefixListId1 := range ipPermission1.PrefixListIds {
+		contains := false
+		for _, prefixListId2 := range ipPermission2.PrefixListIds {
+			if prefixListId1.Equal(prefixListId2) {
+				contains = true
+				break
+			}
+		}
+		if !contains {
+			return false
+		}
+	}
 
 	return true
 }
 
 type IpRange struct {
-	IpCidr      *string `yaml:"ipCidr"`
-	Description *string `yaml:"description"`
+	IpCidr      *string `yaml:"ipCidr" json:"ipCidr"`
+	Description *string `yaml:"description" json:"description"`
+	// Origin records where the ip range was read from e.g. a file in a git repository, for auditing
+	Origin string `yaml:"-" json:"-"`
 }
 
 //Equal compares IPRanges
@@ -47,6 +77,37 @@ func (ipRange1 *IpRange) Equal(ipRange2 *IpRange) bool {
 	return *ipRange1.IpCidr == *ipRange2.IpCidr && *ipRange1.Description == *ipRange2.Description
 }
 
+// UserIdGroupPair is a security group whose members are allowed by an IpPermission, UserId is the
+// account of the security group if it belongs to another account
+type UserIdGroupPair struct {
+	GroupId     *string `yaml:"groupId" json:"groupId"`
+	UserId      *string `yaml:"userId" json:"userId,omitempty"`
+	Description *string `yaml:"description" json:"description"`
+	// Origin records where the security group was read from, for auditing
+	Origin string `yaml:"-" json:"-"`
+}
+
+//Equal compares UserIdGroupPairs
+func (userIdGroupPair1 *UserIdGroupPair) Equal(userIdGroupPair2 *UserIdGroupPair) bool {
+	return IsStringEqual(userIdGroupPair1.GroupId, userIdGroupPair2.GroupId) &&
+		IsStringEqual(userIdGroupPair1.UserId, userIdGroupPair2.UserId) &&
+		IsStringEqual(userIdGroupPair1.Description, userIdGroupPair2.Description)
+}
+
+// PrefixListId is a managed prefix list whose cidrs are allowed by an IpPermission
+type PrefixListId struct {
+	PrefixListId *string `yaml:"prefixListId" json:"prefixListId"`
+	Description  *string `yaml:"description" json:"description"`
+	// Origin records where the prefix list was read from, for auditing
+	Origin string `yaml:"-" json:"-"`
+}
+
+//Equal compares PrefixListIds
+func (prefixListId1 *PrefixListId) Equal(prefixListId2 *PrefixListId) bool {
+	return IsStringEqual(prefixListId1.PrefixListId, prefixListId2.PrefixListId) &&
+		IsStringEqual(prefixListId1.Description, prefixListId2.Description)
+}
+
 //GetLoadBalancerNameFromDNSName gets the name of load balancer from DNS name by splitting the dnsName on '-'
 func GetLoadBalancerNameFromDNSName(dnsName string) string {
 	return strings.Split(dnsName, "-")[0]
@@ -60,7 +121,9 @@ func IsEc2IpPermissionEqual(ipPermission1 *ec2.IpPermission, ipPermission2 *ec2.
 		IsInt64Equal(ipPermission1.ToPort, ipPermission2.ToPort) &&
 		IsStringEqual(ipPermission1.IpProtocol, ipPermission2.IpProtocol) &&
 		IsEc2IpRangeEqual(ipPermission1.IpRanges, ipPermission2.IpRanges) &&
-		IsEc2Ipv6RangeEqual(ipPermission1.Ipv6Ranges, ipPermission2.Ipv6Ranges) {
+		IsEc2Ipv6RangeEqual(ipPermission1.Ipv6Ranges, ipPermission2.Ipv6Ranges) &&
+		IsEc2PrefixListIdEqual(ipPermission1.PrefixListIds, ipPermission2.PrefixListIds) &&
+		IsEc2UserIdGroupPairEqual(ipPermission1.UserIdGroupPairs, ipPermission2.UserIdGroupPairs) {
 
 		return true
 	}
@@ -116,26 +179,67 @@ func IsEc2Ipv6RangeEqual(ipv6Ranges1 []*ec2.Ipv6Range, ipv6Ranges2 []*ec2.Ipv6Ra
 	return true
 }
 
-// IsStringEqual Compares two String pointers with checks for null pointers
-func IsStringEqual(val1 *string, val2 *string) bool {
-	if val1 == nil && val2 != nil {
+//IsEc2PrefixListIdEqual compares two ec2.PrefixListIds to check if they are equal
+func IsEc2PrefixListIdEqual(prefixListIds1 []*ec2.PrefixListId, prefixListIds2 []*ec2.PrefixListId) bool {
+	if len(prefixListIds1) != len(prefixListIds2) {
 		return false
-	} else if val1 != nil && val2 == nil {
+	}
+	var prefixListIdExists bool
+	for _, prefixListId1 := range prefixListIds1 {
+		prefixListIdExists = false
+		for _, prefixListId2 := range prefixListIds2 {
+			if IsStringEqual(prefixListId1.PrefixListId, prefixListId2.PrefixListId) &&
+				IsStringEqual(prefixListId1.Description, prefixListId2.Description) {
+				prefixListIdExists = true
+				break
+			}
+		}
+		if !prefixListIdExists {
+			return false
+		}
+	}
+	return true
+}
+
+//IsEc2UserIdGroupPairEqual compares two ec2.UserIdGroupPairs to check if they are equal. The accounts
+//are only compared if both are set, as ec2 returns the account of security groups that were added without it
+func IsEc2UserIdGroupPairEqual(userIdGroupPairs1 []*ec2.UserIdGroupPair, userIdGroupPairs2 []*ec2.UserIdGroupPair) bool {
+	if len(userIdGroupPairs1) != len(userIdGroupPairs2) {
 		return false
-	} else {
-		return *val1 == *val2
 	}
+	var userIdGroupPairExists bool
+	for _, userIdGroupPair1 := range userIdGroupPairs1 {
+		userIdGroupPairExists = false
+		for _, userIdGroupPair2 := range userIdGroupPairs2 {
+			if IsStringEqual(userIdGroupPair1.GroupId, userIdGroupPair2.GroupId) &&
+				IsStringEqual(userIdGroupPair1.Description, userIdGroupPair2.Description) &&
+				(userIdGroupPair1.UserId == nil || userIdGroupPair2.UserId == nil ||
+					*userIdGroupPair1.UserId == *userIdGroupPair2.UserId) {
+				userIdGroupPairExists = true
+				break
+			}
+		}
+		if !userIdGroupPairExists {
+			return false
+		}
+	}
+	return true
+}
+
+// IsStringEqual Compares two String pointers with checks for null pointers
+func IsStringEqual(val1 *string, val2 *string) bool {
+	if val1 == nil || val2 == nil {
+		return val1 == val2
+	}
+	return *val1 == *val2
 }
 
 // IsInt64Equal Compares two int64 pointers with checks for null pointers
 func IsInt64Equal(val1 *int64, val2 *int64) bool {
-	if val1 == nil && val2 != nil {
-		return false
-	} else if val1 != nil && val2 == nil {
-		return false
-	} else {
-		return *val1 == *val2
+	if val1 == nil || val2 == nil {
+		return val1 == val2
 	}
+	return *val1 == *val2
 }
 
 // CombineIpPermission merges permissions into existing permissions with same port and protocol
@@ -149,6 +253,8 @@ func CombineIpPermission(ipPermissions []IpPermission, permissionsToAdd []IpPerm
 
 				isMatchingPermission = true
 				ipPermissions[index].IpRanges = append(ipPermission.IpRanges, permissionToAdd.IpRanges...)
+				ipPermissions[index].UserIdGroupPairs = append(ipPermission.UserIdGroupPairs, permissionToAdd.UserIdGroupPairs...)
+				ipPermissions[index].PrefixListIds = append(ipPermission.PrefixListIds, permissionToAdd.PrefixListIds...)
 				break
 			}
 		}
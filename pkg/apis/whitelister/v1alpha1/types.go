@@ -0,0 +1,65 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// GroupName is the api group of Whitelister custom resources
+	GroupName = "whitelister.stakater.com"
+	// Version is the api version of Whitelister custom resources
+	Version = "v1alpha1"
+	// WhitelistEntryKind is the kind of the WhitelistEntry custom resource
+	WhitelistEntryKind = "WhitelistEntry"
+)
+
+// WhitelistEntryResource identifies WhitelistEntry resources for the dynamic client
+var WhitelistEntryResource = schema.GroupVersionResource{
+	Group:    GroupName,
+	Version:  Version,
+	Resource: "whitelistentries",
+}
+
+const (
+	// PhaseApplied is set when the entry was whitelisted on all target groups
+	PhaseApplied = "Applied"
+	// PhaseRejected is set when the entry is invalid or expired and was not whitelisted
+	PhaseRejected = "Rejected"
+	// PhaseFailed is set when the entry is valid but the provider failed to whitelist it
+	PhaseFailed = "Failed"
+)
+
+// WhitelistEntry allows access from a set of IP ranges on a port range
+type WhitelistEntry struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WhitelistEntrySpec   `json:"spec"`
+	Status WhitelistEntryStatus `json:"status,omitempty"`
+}
+
+// WhitelistEntrySpec mirrors utils.IpPermission along with ownership and expiry of the entry
+type WhitelistEntrySpec struct {
+	IpRanges   []IpRange    `json:"ipRanges"`
+	FromPort   *int64       `json:"fromPort"`
+	ToPort     *int64       `json:"toPort"`
+	IpProtocol *string      `json:"ipProtocol"`
+	Owner      string       `json:"owner,omitempty"`
+	Expiry     *metav1.Time `json:"expiry,omitempty"`
+}
+
+// IpRange mirrors utils.IpRange
+type IpRange struct {
+	IpCidr      *string `json:"ipCidr"`
+	Description *string `json:"description,omitempty"`
+}
+
+// WhitelistEntryStatus is written back by Whitelister after each reconcile
+type WhitelistEntryStatus struct {
+	Phase              string       `json:"phase,omitempty"`
+	Reason             string       `json:"reason,omitempty"`
+	TargetGroups       []string     `json:"targetGroups,omitempty"`
+	ObservedGeneration int64        `json:"observedGeneration,omitempty"`
+	LastReconcileTime  *metav1.Time `json:"lastReconcileTime,omitempty"`
+}
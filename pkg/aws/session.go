@@ -0,0 +1,173 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// defaultSessionName identifies the sessions of Whitelister in CloudTrail
+const defaultSessionName = "whitelister"
+
+// expiryWindow is how long before they expire the credentials of an assumed role are refreshed, so
+// that they do not expire during a sync
+var expiryWindow = time.Minute
+
+// Options configure how Whitelister authenticates with AWS and which endpoints it calls, they are
+// all optional. Throttled and failed calls are retried MaxRetries times, waiting between
+// MinThrottleDelay and MaxThrottleDelay with exponential backoff when throttled.
+//
+// Without a RoleArn the credentials of the default chain are used as they are, e.g. the pod role
+// of EKS IAM roles for service accounts or the instance role
+type Options struct {
+	RoleArn              string
+	ExternalID           string
+	SessionName          string
+	SessionDuration      string
+	WebIdentityTokenFile string
+	StsEndpoint          string
+	Ec2Endpoint          string
+	ElbEndpoint          string
+	QuotasEndpoint       string
+	WafEndpoint          string
+	MaxRetries           *int
+	MinThrottleDelay     string
+	MaxThrottleDelay     string
+
+	sessionDuration  time.Duration
+	minThrottleDelay time.Duration
+	maxThrottleDelay time.Duration
+}
+
+// Validate checks that the options can be used together
+func (o *Options) Validate() error {
+	if o.RoleArn == "" && (o.ExternalID != "" || o.SessionName != "" || o.SessionDuration != "" || o.WebIdentityTokenFile != "") {
+		return errors.New("Missing Aws RoleArn to assume with ExternalID, SessionName, SessionDuration or WebIdentityTokenFile")
+	}
+	if o.WebIdentityTokenFile != "" && (o.ExternalID != "" || o.SessionDuration != "") {
+		return errors.New("Aws ExternalID and SessionDuration are not supported with WebIdentityTokenFile")
+	}
+	if o.MaxRetries != nil && *o.MaxRetries < 0 {
+		return fmt.Errorf("Invalid Aws MaxRetries %d", *o.MaxRetries)
+	}
+	if err := parseDuration("SessionDuration", o.SessionDuration, &o.sessionDuration); err != nil {
+		return err
+	}
+	if err := parseDuration("MinThrottleDelay", o.MinThrottleDelay, &o.minThrottleDelay); err != nil {
+		return err
+	}
+	if err := parseDuration("MaxThrottleDelay", o.MaxThrottleDelay, &o.maxThrottleDelay); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetSession creates a session and the credentials to use with it, assuming RoleArn if it is set
+func (o *Options) GetSession(region string) (*session.Session, *credentials.Credentials, error) {
+	// Initial credentials loaded from SDK's default credential chain. Such as
+	// the environment, shared credentials (~/.aws/credentials), EC2 Instance
+	// Role or the web identity token file of IAM roles for service accounts.
+	awsSession, err := session.NewSession()
+	if err != nil {
+		return nil, nil, err
+	}
+	if o.RoleArn == "" {
+		return awsSession, awsSession.Config.Credentials, nil
+	}
+
+	stsConfig := o.withRetryer(&aws.Config{Region: aws.String(region)})
+	stsClient := sts.New(awsSession, withEndpoint(stsConfig, o.StsEndpoint))
+	sessionName := o.SessionName
+	if sessionName == "" {
+		sessionName = defaultSessionName
+	}
+
+	if o.WebIdentityTokenFile != "" {
+		// Exchange the token for the credentials of the role instead of using the default chain
+		provider := stscreds.NewWebIdentityRoleProvider(stsClient, o.RoleArn, sessionName, o.WebIdentityTokenFile)
+		provider.ExpiryWindow = expiryWindow
+		return awsSession, credentials.NewCredentials(provider), nil
+	}
+
+	// Create the credentials from AssumeRoleProvider to assume the role
+	// referenced by the ARN.
+	roleCredentials := stscreds.NewCredentialsWithClient(stsClient, o.RoleArn, func(provider *stscreds.AssumeRoleProvider) {
+		provider.RoleSessionName = sessionName
+		provider.ExpiryWindow = expiryWindow
+		if o.ExternalID != "" {
+			provider.ExternalID = aws.String(o.ExternalID)
+		}
+		if o.sessionDuration != 0 {
+			provider.Duration = o.sessionDuration
+		}
+	})
+	return awsSession, roleCredentials, nil
+}
+
+// GetEc2Config returns the config for ec2 clients of the given region
+func (o *Options) GetEc2Config(roleCredentials *credentials.Credentials, region string) *aws.Config {
+	return withEndpoint(o.withRetryer(GetConfig(roleCredentials, region)), o.Ec2Endpoint)
+}
+
+// GetElbConfig returns the config for elb clients of the given region
+func (o *Options) GetElbConfig(roleCredentials *credentials.Credentials, region string) *aws.Config {
+	return withEndpoint(o.withRetryer(GetConfig(roleCredentials, region)), o.ElbEndpoint)
+}
+
+// GetQuotasConfig returns the config for service quotas clients of the given region
+func (o *Options) GetQuotasConfig(roleCredentials *credentials.Credentials, region string) *aws.Config {
+	return withEndpoint(o.withRetryer(GetConfig(roleCredentials, region)), o.QuotasEndpoint)
+}
+
+// GetWafConfig returns the config for wafv2 clients of the given region
+func (o *Options) GetWafConfig(roleCredentials *credentials.Credentials, region string) *aws.Config {
+	return withEndpoint(o.withRetryer(GetConfig(roleCredentials, region)), o.WafEndpoint)
+}
+
+// GetConfig returns the config for clients of the given region using the credentials
+func GetConfig(roleCredentials *credentials.Credentials, region string) *aws.Config {
+	return &aws.Config{
+		Credentials: roleCredentials,
+		Region:      aws.String(region),
+	}
+}
+
+func (o *Options) withRetryer(config *aws.Config) *aws.Config {
+	maxRetries := client.DefaultRetryerMaxNumRetries
+	if o.MaxRetries != nil {
+		maxRetries = *o.MaxRetries
+	}
+	// Zero delays are replaced by the defaults of the SDK
+	return request.WithRetryer(config, client.DefaultRetryer{
+		NumMaxRetries:    maxRetries,
+		MinThrottleDelay: o.minThrottleDelay,
+		MaxThrottleDelay: o.maxThrottleDelay,
+	})
+}
+
+func parseDuration(name string, value string, duration *time.Duration) error {
+	if value == "" {
+		return nil
+	}
+	var err error
+	*duration, err = time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("Invalid Aws %s %s : %v", name, value, err)
+	}
+	return nil
+}
+
+func withEndpoint(config *aws.Config, endpoint string) *aws.Config {
+	if endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+	}
+	return config
+}
@@ -0,0 +1,253 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	testUtils "github.com/stakater/Whitelister/internal/pkg/test/utils"
+)
+
+var (
+	roleArn         = "arn:aws:iam::111111111111:role/whitelister"
+	negativeRetries = -1
+)
+
+// setCredentials sets the credentials of the default chain for the test
+func setCredentials(t *testing.T) {
+	for name, value := range map[string]string{"AWS_ACCESS_KEY_ID": "DEFAULT", "AWS_SECRET_ACCESS_KEY": "secret"} {
+		name := name
+		defaultValue, ok := os.LookupEnv(name)
+		os.Setenv(name, value)
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(name, defaultValue)
+			} else {
+				os.Unsetenv(name)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  Options
+		wantErr  bool
+		errValue error
+	}{
+		{
+			name:    "Validate without role",
+			options: Options{Ec2Endpoint: "http://localhost:4566"},
+		},
+		{
+			name:    "Validate with role options",
+			options: Options{RoleArn: roleArn, ExternalID: "whitelister", SessionName: "sync", SessionDuration: "1h"},
+		},
+		{
+			name:     "Validate with external id without role",
+			options:  Options{ExternalID: "whitelister"},
+			wantErr:  true,
+			errValue: errors.New("Missing Aws RoleArn to assume with ExternalID, SessionName, SessionDuration or WebIdentityTokenFile"),
+		},
+		{
+			name:     "Validate with web identity and session duration",
+			options:  Options{RoleArn: roleArn, WebIdentityTokenFile: "/var/run/secrets/token", SessionDuration: "1h"},
+			wantErr:  true,
+			errValue: errors.New("Aws ExternalID and SessionDuration are not supported with WebIdentityTokenFile"),
+		},
+		{
+			name:     "Validate with negative max retries",
+			options:  Options{MaxRetries: &negativeRetries},
+			wantErr:  true,
+			errValue: errors.New("Invalid Aws MaxRetries -1"),
+		},
+		{
+			name:     "Validate with invalid session duration",
+			options:  Options{RoleArn: roleArn, SessionDuration: "hour"},
+			wantErr:  true,
+			errValue: errors.New(`Invalid Aws SessionDuration hour : time: invalid duration "hour"`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.wantErr {
+				if err == nil || err.Error() != tt.errValue.Error() {
+					t.Errorf("Options.Validate() Got Err: %v, Wanted Err: %v", err, tt.errValue)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Options.Validate() Got Err: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetSession(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "whitelister-aws-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testUtils.DeleteDir(tmpDir)
+	tokenFile := filepath.Join(tmpDir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("web-identity-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	setCredentials(t)
+
+	// sts is a local stand-in of the sts api that records the params of the last request
+	var params url.Values
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		params = r.PostForm
+		action := params.Get("Action")
+		fmt.Fprintf(w, `<%[1]sResponse><%[1]sResult><Credentials><AccessKeyId>ASSUMED</AccessKeyId>`+
+			`<SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>`+
+			`<Expiration>2100-01-01T00:00:00Z</Expiration></Credentials></%[1]sResult></%[1]sResponse>`, action)
+	}))
+	defer sts.Close()
+
+	tests := []struct {
+		name          string
+		options       Options
+		wantAccessKey string
+		wantParams    map[string]string
+	}{
+		{
+			name:          "default chain",
+			options:       Options{StsEndpoint: sts.URL},
+			wantAccessKey: "DEFAULT",
+		},
+		{
+			name:          "assume role",
+			options:       Options{RoleArn: roleArn, StsEndpoint: sts.URL},
+			wantAccessKey: "ASSUMED",
+			wantParams: map[string]string{"Action": "AssumeRole", "RoleArn": roleArn, "RoleSessionName": "whitelister",
+				"DurationSeconds": "900"},
+		},
+		{
+			name: "assume role with external id",
+			options: Options{RoleArn: roleArn, ExternalID: "partner", SessionName: "sync", SessionDuration: "1h",
+				StsEndpoint: sts.URL},
+			wantAccessKey: "ASSUMED",
+			wantParams: map[string]string{"Action": "AssumeRole", "RoleArn": roleArn, "RoleSessionName": "sync",
+				"ExternalId": "partner", "DurationSeconds": "3600"},
+		},
+		{
+			name:          "web identity",
+			options:       Options{RoleArn: roleArn, WebIdentityTokenFile: tokenFile, StsEndpoint: sts.URL},
+			wantAccessKey: "ASSUMED",
+			wantParams: map[string]string{"Action": "AssumeRoleWithWebIdentity", "RoleArn": roleArn,
+				"RoleSessionName": "whitelister", "WebIdentityToken": "web-identity-token"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params = nil
+			if err := tt.options.Validate(); err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			_, roleCredentials, err := tt.options.GetSession("us-west-2")
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			value, err := roleCredentials.Get()
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			if value.AccessKeyID != tt.wantAccessKey {
+				t.Errorf("Got access key = %s, wanted %s", value.AccessKeyID, tt.wantAccessKey)
+			}
+
+			gotParams := map[string]string{}
+			for key := range params {
+				if key != "Version" {
+					gotParams[key] = params.Get(key)
+				}
+			}
+			if tt.wantParams == nil {
+				tt.wantParams = map[string]string{}
+			}
+			if !reflect.DeepEqual(gotParams, tt.wantParams) {
+				t.Errorf("Got sts params = %v, wanted %v", gotParams, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	setCredentials(t)
+
+	// ec2 is a local stand-in of the ec2 api that throttles the first calls
+	var calls int
+	ec2Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `<Response><Errors><Error><Code>RequestLimitExceeded</Code>`+
+				`<Message>Request limit exceeded.</Message></Error></Errors></Response>`)
+			return
+		}
+		fmt.Fprint(w, `<DescribeSecurityGroupsResponse><securityGroupInfo/></DescribeSecurityGroupsResponse>`)
+	}))
+	defer ec2Server.Close()
+
+	noRetries := 0
+	tests := []struct {
+		name      string
+		options   Options
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "default retries",
+			options:   Options{MinThrottleDelay: "1ms", MaxThrottleDelay: "5ms"},
+			wantCalls: 3,
+		},
+		{
+			name:      "no retries",
+			options:   Options{MaxRetries: &noRetries},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+			tt.options.Ec2Endpoint = ec2Server.URL
+			if err := tt.options.Validate(); err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			awsSession, roleCredentials, err := tt.options.GetSession("us-west-2")
+			if err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			client := ec2.New(awsSession, tt.options.GetEc2Config(roleCredentials, "us-west-2"))
+
+			start := time.Now()
+			_, err = client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Got Err: %v, wanted error %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("Got %d calls, wanted %d", calls, tt.wantCalls)
+			}
+			if time.Since(start) > 5*time.Second {
+				t.Errorf("Retries took %s, wanted the configured throttle delays", time.Since(start))
+			}
+		})
+	}
+}
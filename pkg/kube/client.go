@@ -3,6 +3,7 @@ package kube
 import (
 	"os"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -10,6 +11,23 @@ import (
 
 // GetClient gets the client for k8s, if ~/.kube/config exists so get that config else incluster config
 func GetClient() (*kubernetes.Clientset, error) {
+	config, err := getConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// GetDynamicClient gets the dynamic client for k8s which is used to access custom resources
+func GetDynamicClient() (dynamic.Interface, error) {
+	config, err := getConfig()
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(config)
+}
+
+func getConfig() (*rest.Config, error) {
 	var config *rest.Config
 	var err error
 	kubeconfigPath := os.Getenv("KUBECONFIG")
@@ -25,5 +43,5 @@ func GetClient() (*kubernetes.Clientset, error) {
 	if err != nil {
 		return nil, err
 	}
-	return kubernetes.NewForConfig(config)
+	return config, nil
 }
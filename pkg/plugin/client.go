@@ -0,0 +1,223 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// DefaultTimeout is how long a plugin has to answer a request before it is restarted
+	DefaultTimeout = 5 * time.Minute
+	// closeTimeout is how long a plugin has to exit after its stdin is closed before it is killed
+	closeTimeout = 5 * time.Second
+)
+
+// Client runs the executable of a plugin and calls its methods. A plugin that exits or does not
+// answer in time is stopped, and started again with the last Init call on the next call
+type Client struct {
+	Path    string
+	Args    []string
+	Timeout time.Duration
+
+	mutex      sync.Mutex
+	command    *exec.Cmd
+	stdin      io.WriteCloser
+	decoder    *json.Decoder
+	nextID     uint64
+	handshake  HandshakeResult
+	initMethod string
+	initParams interface{}
+}
+
+// NewClient returns a client of the plugin executable at path, the plugin is started on the first call
+func NewClient(path string, args ...string) *Client {
+	return &Client{Path: path, Args: args, Timeout: DefaultTimeout}
+}
+
+// Handshake starts the plugin if it is not running and returns its description
+func (c *Client) Handshake() (HandshakeResult, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.start(); err != nil {
+		return HandshakeResult{}, err
+	}
+	return c.handshake, nil
+}
+
+// Init calls the init method of the plugin, it is called again whenever the plugin is restarted. A plugin
+// that fails to initialize is stopped, so that the next call starts and initializes it again
+func (c *Client) Init(method string, params interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.initMethod = method
+	c.initParams = params
+	if c.command == nil {
+		return c.start()
+	}
+	if err := c.call(method, params, nil); err != nil {
+		c.kill()
+		return err
+	}
+	return nil
+}
+
+// Call calls a method of the plugin and decodes its result into result, unless it is nil
+func (c *Client) Call(method string, params interface{}, result interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.start(); err != nil {
+		return err
+	}
+	return c.call(method, params, result)
+}
+
+// Close closes the stdin of the plugin so that it exits, and kills it if it does not
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.command == nil {
+		return nil
+	}
+
+	command := c.command
+	c.command = nil
+	c.stdin.Close()
+	exited := make(chan error, 1)
+	go func() { exited <- command.Wait() }()
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(closeTimeout):
+		command.Process.Kill()
+		return <-exited
+	}
+}
+
+func (c *Client) name() string {
+	return filepath.Base(c.Path)
+}
+
+// start starts the plugin if it is not running, checks its protocol version and initializes it
+func (c *Client) start() error {
+	if c.command != nil {
+		return nil
+	}
+
+	command := exec.Command(c.Path, c.Args...)
+	stdin, err := command.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := command.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := command.Start(); err != nil {
+		return fmt.Errorf("Unable to start plugin %s : %v", c.name(), err)
+	}
+	go logStderr(c.name(), stderr)
+	c.command = command
+	c.stdin = stdin
+	c.decoder = json.NewDecoder(stdout)
+
+	var handshake HandshakeResult
+	if err := c.call(MethodHandshake, nil, &handshake); err != nil {
+		c.kill()
+		return err
+	}
+	if handshake.ProtocolVersion != ProtocolVersion {
+		c.kill()
+		return fmt.Errorf("Plugin %s uses protocol version %d, Whitelister uses %d",
+			c.name(), handshake.ProtocolVersion, ProtocolVersion)
+	}
+	c.handshake = handshake
+	logrus.Infof("Started plugin %s", c.name())
+
+	if c.initMethod == "" {
+		return nil
+	}
+	// An uninitialized plugin must not be called, it is started again on the next call
+	if err := c.call(c.initMethod, c.initParams, nil); err != nil {
+		c.kill()
+		return err
+	}
+	return nil
+}
+
+// call sends a request to the running plugin and waits for its response, the plugin is killed if
+// it exits or does not answer in time
+func (c *Client) call(method string, params interface{}, result interface{}) error {
+	c.nextID++
+	request := Request{ID: c.nextID, Method: method}
+	if params != nil {
+		var err error
+		request.Params, err = json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("Unable to encode params of %s : %v", method, err)
+		}
+	}
+
+	var response Response
+	stdin, decoder := c.stdin, c.decoder
+	answered := make(chan error, 1)
+	go func() {
+		if err := json.NewEncoder(stdin).Encode(request); err != nil {
+			answered <- err
+			return
+		}
+		answered <- decoder.Decode(&response)
+	}()
+	select {
+	case err := <-answered:
+		if err != nil {
+			c.kill()
+			return fmt.Errorf("Plugin %s exited : %v", c.name(), err)
+		}
+	case <-time.After(c.Timeout):
+		c.kill()
+		<-answered
+		return fmt.Errorf("Plugin %s did not answer %s within %s", c.name(), method, c.Timeout)
+	}
+
+	if response.ID != request.ID {
+		c.kill()
+		return fmt.Errorf("Plugin %s answered request %d instead of %d", c.name(), response.ID, request.ID)
+	}
+	if response.Error != "" {
+		return fmt.Errorf("Plugin %s : %s", c.name(), response.Error)
+	}
+	if result != nil && len(response.Result) > 0 {
+		if err := json.Unmarshal(response.Result, result); err != nil {
+			return fmt.Errorf("Invalid result of %s from plugin %s : %v", method, c.name(), err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) kill() {
+	if c.command == nil {
+		return
+	}
+	c.command.Process.Kill()
+	c.command.Wait()
+	c.command = nil
+}
+
+func logStderr(name string, stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		logrus.Infof("Plugin %s : %s", name, scanner.Text())
+	}
+}
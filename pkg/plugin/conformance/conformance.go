@@ -0,0 +1,157 @@
+// Package conformance tests that a plugin implements the Whitelister plugin protocol, plugin authors
+// run it from a test of their plugin
+package conformance
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stakater/Whitelister/pkg/plugin"
+)
+
+// Config of the plugin under test
+type Config struct {
+	// Path and Args of the plugin executable
+	Path string
+	Args []string
+	// IpProviderParams are the params that the ip provider of the plugin is initialized with
+	IpProviderParams map[string]interface{}
+	// ProviderParams are the params that the provider of the plugin is initialized with
+	ProviderParams map[string]interface{}
+	// Filter is passed to the provider of the plugin
+	Filter plugin.Filter
+	// Timeout of every call, by default 30 seconds
+	Timeout time.Duration
+}
+
+var samplePort int64 = 443
+
+// sampleIpPermissions are whitelisted by providers of plugins that are not ip providers
+var sampleIpPermissions = []plugin.IpPermission{
+	{
+		FromPort:   samplePort,
+		ToPort:     samplePort,
+		IpProtocol: "tcp",
+		IpRanges:   []plugin.IpRange{{IpCidr: "192.0.2.0/24", Description: "whitelister conformance"}},
+	},
+}
+
+// Run runs the conformance tests against the plugin
+func Run(t *testing.T, config Config) {
+	newClient := func(t *testing.T) *plugin.Client {
+		client := plugin.NewClient(config.Path, config.Args...)
+		client.Timeout = 30 * time.Second
+		if config.Timeout != 0 {
+			client.Timeout = config.Timeout
+		}
+		t.Cleanup(func() { client.Close() })
+		return client
+	}
+
+	client := newClient(t)
+	handshake, err := client.Handshake()
+	if err != nil {
+		t.Fatalf("Handshake failed : %v", err)
+	}
+
+	t.Run("Handshake", func(t *testing.T) {
+		if handshake.Name == "" {
+			t.Errorf("Handshake has no name")
+		}
+		if !handshake.IpProvider && !handshake.Provider {
+			t.Errorf("Handshake is neither an ip provider nor a provider")
+		}
+	})
+
+	t.Run("UnknownMethod", func(t *testing.T) {
+		client := newClient(t)
+		err := client.Call("Whitelister.Unknown", nil, nil)
+		if err == nil || !strings.Contains(err.Error(), "Unknown method") {
+			t.Errorf("Got Err: %v, wanted an unknown method error", err)
+		}
+		// The plugin keeps answering after an error
+		if _, err := client.Handshake(); err != nil {
+			t.Errorf("Handshake after error failed : %v", err)
+		}
+	})
+
+	ipPermissions := sampleIpPermissions
+	if handshake.IpProvider {
+		t.Run("IpProvider", func(t *testing.T) {
+			client := newClient(t)
+			err := client.Init(plugin.MethodIpProviderInit, plugin.InitParams{Params: config.IpProviderParams})
+			if err != nil {
+				t.Fatalf("IpProvider.Init failed : %v", err)
+			}
+			var got []plugin.IpPermission
+			if err := client.Call(plugin.MethodGetIPPermissions, nil, &got); err != nil {
+				t.Fatalf("IpProvider.GetIPPermissions failed : %v", err)
+			}
+			for _, ipPermission := range got {
+				checkIpPermission(t, ipPermission)
+			}
+			if len(got) > 0 {
+				ipPermissions = got
+			}
+		})
+	} else {
+		t.Run("NotIpProvider", func(t *testing.T) {
+			if err := newClient(t).Call(plugin.MethodGetIPPermissions, nil, nil); err == nil {
+				t.Errorf("IpProvider.GetIPPermissions of a plugin that is not an ip provider succeeded")
+			}
+		})
+	}
+
+	if handshake.Provider {
+		t.Run("Provider", func(t *testing.T) {
+			client := newClient(t)
+			err := client.Init(plugin.MethodProviderInit, plugin.InitParams{Params: config.ProviderParams})
+			if err != nil {
+				t.Fatalf("Provider.Init failed : %v", err)
+			}
+			for _, ipPermissions := range [][]plugin.IpPermission{ipPermissions, {}} {
+				params := plugin.WhiteListIpsParams{Filter: config.Filter, IpPermissions: ipPermissions}
+				var result plugin.WhiteListIpsResult
+				if err := client.Call(plugin.MethodWhiteListIps, params, &result); err != nil {
+					t.Errorf("Provider.WhiteListIps of %d ip permissions failed : %v", len(ipPermissions), err)
+				}
+			}
+		})
+	} else {
+		t.Run("NotProvider", func(t *testing.T) {
+			if err := newClient(t).Call(plugin.MethodWhiteListIps, plugin.WhiteListIpsParams{}, nil); err == nil {
+				t.Errorf("Provider.WhiteListIps of a plugin that is not a provider succeeded")
+			}
+		})
+	}
+
+	t.Run("Close", func(t *testing.T) {
+		client := newClient(t)
+		if _, err := client.Handshake(); err != nil {
+			t.Fatalf("Handshake failed : %v", err)
+		}
+		start := time.Now()
+		if err := client.Close(); err != nil {
+			t.Errorf("Plugin did not exit cleanly when stdin was closed : %v", err)
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("Plugin was killed as it did not exit when stdin was closed")
+		}
+	})
+}
+
+func checkIpPermission(t *testing.T, ipPermission plugin.IpPermission) {
+	if ipPermission.IpProtocol == "" {
+		t.Errorf("Ip permission %v has no ip protocol", ipPermission)
+	}
+	if ipPermission.FromPort > ipPermission.ToPort {
+		t.Errorf("Ip permission %v has a from port after its to port", ipPermission)
+	}
+	for _, ipRange := range ipPermission.IpRanges {
+		if _, _, err := net.ParseCIDR(ipRange.IpCidr); err != nil {
+			t.Errorf("Ip permission %v has an invalid cidr : %v", ipPermission, err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Dir returns the directory that plugins are discovered in, set by the PLUGIN_DIR environment variable
+func Dir() string {
+	dir := os.Getenv("PLUGIN_DIR")
+	if len(dir) == 0 {
+		//Default plugin directory is plugins/ next to configs/
+		dir = "plugins"
+	}
+	return dir
+}
+
+// Find returns the path of the executable of the named plugin in the plugin directory
+func Find(name string) (string, bool) {
+	plugins, err := Discover(Dir())
+	if err != nil {
+		logrus.Errorf("Unable to discover plugins : %v", err)
+		return "", false
+	}
+	path, ok := plugins[name]
+	return path, ok
+}
+
+// Discover returns the paths of the executables in dir by plugin name, which is the name of the
+// executable without extension. A missing directory has no plugins
+func Discover(dir string) (map[string]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plugins := map[string]string{}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		// Stat follows the symlinks of mounted config maps and secrets
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || info.Mode()&0111 == 0 {
+			continue
+		}
+		plugins[strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))] = path
+	}
+	return plugins, nil
+}
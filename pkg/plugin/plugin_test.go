@@ -0,0 +1,195 @@
+package plugin
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	testUtils "github.com/stakater/Whitelister/internal/pkg/test/utils"
+)
+
+// TestMain runs the test binary as a plugin when it is started by a client
+func TestMain(m *testing.M) {
+	if os.Getenv("WHITELISTER_TEST_PLUGIN") == "1" {
+		if err := Serve("Test", &testIpProvider{}, nil); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Setenv("WHITELISTER_TEST_PLUGIN", "1")
+	os.Exit(m.Run())
+}
+
+// testIpProvider returns an ip permission of IpCidr, it exits when ExitMarker does not exist yet
+// and never answers if Hang is set
+type testIpProvider struct {
+	IpCidr     string
+	ExitMarker string
+	Hang       bool
+}
+
+func (i *testIpProvider) Init(params map[string]interface{}) error {
+	if err := mapstructure.Decode(params, i); err != nil {
+		return err
+	}
+	if i.IpCidr == "" {
+		return errors.New("Missing Test IpCidr")
+	}
+	return nil
+}
+
+func (i *testIpProvider) GetIPPermissions() ([]IpPermission, error) {
+	if i.Hang {
+		time.Sleep(time.Hour)
+	}
+	if i.ExitMarker != "" {
+		if _, err := os.Stat(i.ExitMarker); os.IsNotExist(err) {
+			ioutil.WriteFile(i.ExitMarker, nil, 0644)
+			os.Exit(1)
+		}
+	}
+	return []IpPermission{{FromPort: 22, ToPort: 22, IpProtocol: "tcp", IpRanges: []IpRange{{IpCidr: i.IpCidr}}}}, nil
+}
+
+func TestClient(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "whitelister-plugin-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testUtils.DeleteDir(tmpDir)
+
+	tests := []struct {
+		name     string
+		params   map[string]interface{}
+		wantErrs []string
+	}{
+		{
+			name:     "ip permissions",
+			params:   map[string]interface{}{"IpCidr": "10.0.0.1/32"},
+			wantErrs: []string{""},
+		},
+		{
+			name:     "restart after exit",
+			params:   map[string]interface{}{"IpCidr": "10.0.0.1/32", "ExitMarker": filepath.Join(tmpDir, "exited")},
+			wantErrs: []string{"Plugin plugin.test exited : EOF", ""},
+		},
+		{
+			name:     "timeout",
+			params:   map[string]interface{}{"IpCidr": "10.0.0.1/32", "Hang": true},
+			wantErrs: []string{"Plugin plugin.test did not answer IpProvider.GetIPPermissions within 200ms"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(os.Args[0])
+			client.Timeout = 200 * time.Millisecond
+			defer client.Close()
+
+			if err := client.Init(MethodIpProviderInit, InitParams{Params: tt.params}); err != nil {
+				t.Fatalf("Got Err: %v", err)
+			}
+			for _, wantErr := range tt.wantErrs {
+				var got []IpPermission
+				err := client.Call(MethodGetIPPermissions, nil, &got)
+				if wantErr != "" {
+					if err == nil || err.Error() != wantErr {
+						t.Errorf("Got Err: %v, Wanted Err: %s", err, wantErr)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("Got Err: %v", err)
+				}
+				if len(got) != 1 || got[0].IpRanges[0].IpCidr != "10.0.0.1/32" {
+					t.Errorf("Got = %v, wanted the ip permission of 10.0.0.1/32", got)
+				}
+			}
+		})
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	client := NewClient(os.Args[0])
+	defer client.Close()
+
+	handshake, err := client.Handshake()
+	if err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+	want := HandshakeResult{ProtocolVersion: ProtocolVersion, Name: "Test", IpProvider: true}
+	if !reflect.DeepEqual(handshake, want) {
+		t.Errorf("Got handshake = %v, wanted %v", handshake, want)
+	}
+
+	err = client.Call(MethodWhiteListIps, WhiteListIpsParams{}, nil)
+	if err == nil || err.Error() != "Plugin plugin.test : Plugin is not a provider" {
+		t.Errorf("Got Err: %v, wanted the plugin not to be a provider", err)
+	}
+
+	err = client.Init(MethodIpProviderInit, InitParams{})
+	if err == nil || err.Error() != "Plugin plugin.test : Missing Test IpCidr" {
+		t.Errorf("Got Err: %v, wanted the error of the plugin", err)
+	}
+	// The uninitialized plugin is not called, it is started and initialized again
+	err = client.Call(MethodGetIPPermissions, nil, &[]IpPermission{})
+	if err == nil || err.Error() != "Plugin plugin.test : Missing Test IpCidr" {
+		t.Errorf("Got Err: %v, wanted the error of initializing the plugin again", err)
+	}
+
+	missing := NewClient(filepath.Join(os.TempDir(), "whitelister-missing-plugin"))
+	if _, err := missing.Handshake(); err == nil || !strings.HasPrefix(err.Error(), "Unable to start plugin") {
+		t.Errorf("Got Err: %v, wanted the plugin not to start", err)
+	}
+}
+
+func TestConvertParams(t *testing.T) {
+	params := map[interface{}]interface{}{
+		"IpCidrs": []interface{}{"10.0.0.0/16"},
+		"Tags":    map[interface{}]interface{}{"team": "platform", 1: []interface{}{map[interface{}]interface{}{"a": "b"}}},
+	}
+	want := map[string]interface{}{
+		"IpCidrs": []interface{}{"10.0.0.0/16"},
+		"Tags":    map[string]interface{}{"team": "platform", "1": []interface{}{map[string]interface{}{"a": "b"}}},
+	}
+	if got := ConvertParams(params); !reflect.DeepEqual(got, want) {
+		t.Errorf("ConvertParams() = %v, wanted %v", got, want)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "whitelister-plugin-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testUtils.DeleteDir(tmpDir)
+
+	files := map[string]os.FileMode{"example": 0755, "other.sh": 0755, "README.md": 0644, ".hidden": 0755}
+	for file, mode := range files {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, file), nil, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(tmpDir, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Discover(tmpDir)
+	if err != nil {
+		t.Fatalf("Got Err: %v", err)
+	}
+	want := map[string]string{"example": filepath.Join(tmpDir, "example"), "other": filepath.Join(tmpDir, "other.sh")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Discover() = %v, wanted %v", got, want)
+	}
+
+	if got, err := Discover(filepath.Join(tmpDir, "missing")); err != nil || len(got) != 0 {
+		t.Errorf("Discover() of missing dir = %v, Err: %v, wanted no plugins", got, err)
+	}
+}
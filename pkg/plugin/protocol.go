@@ -0,0 +1,129 @@
+// Package plugin implements the protocol between Whitelister and ip providers and providers running
+// out of process. Whitelister starts the executable of a plugin and sends it one json request per line
+// on stdin, the plugin answers every request with one json response per line on stdout. Plugins log
+// to stderr, which Whitelister includes in its log.
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ProtocolVersion is the version of the protocol, it is increased on incompatible changes
+const ProtocolVersion = 1
+
+// Methods that a plugin answers
+const (
+	MethodHandshake        = "Handshake"
+	MethodIpProviderInit   = "IpProvider.Init"
+	MethodGetIPPermissions = "IpProvider.GetIPPermissions"
+	MethodProviderInit     = "Provider.Init"
+	MethodWhiteListIps     = "Provider.WhiteListIps"
+)
+
+// Request is a call of a method of the plugin
+type Request struct {
+	ID     uint64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is the answer of the plugin to the request with the same ID, Error is set if the call failed
+type Response struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// HandshakeResult describes the plugin, it is the result of the Handshake method
+type HandshakeResult struct {
+	ProtocolVersion int    `json:"protocolVersion"`
+	Name            string `json:"name"`
+	IpProvider      bool   `json:"ipProvider"`
+	Provider        bool   `json:"provider"`
+}
+
+// InitParams are the params of the IpProvider.Init and Provider.Init methods, they hold the params of
+// the ip provider or provider in the Whitelister config
+type InitParams struct {
+	Params map[string]interface{} `json:"params"`
+}
+
+// WhiteListIpsParams are the params of the Provider.WhiteListIps method
+type WhiteListIpsParams struct {
+	Filter        Filter         `json:"filter"`
+	IpPermissions []IpPermission `json:"ipPermissions"`
+}
+
+// WhiteListIpsResult is the result of the Provider.WhiteListIps method
+type WhiteListIpsResult struct {
+	// TargetGroups are the ids of the resources that were updated
+	TargetGroups []string `json:"targetGroups"`
+}
+
+// Filter selects the resources to update, FilterType is "LoadBalancer", "SecurityGroup" or "NetworkAcl"
+type Filter struct {
+	FilterType string            `json:"filterType"`
+	LabelName  string            `json:"labelName"`
+	LabelValue string            `json:"labelValue"`
+	GroupIds   []string          `json:"groupIds,omitempty"`
+	GroupNames []string          `json:"groupNames,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	TagKeys    []string          `json:"tagKeys,omitempty"`
+	VpcId      string            `json:"vpcId,omitempty"`
+}
+
+// IpPermission is a list of ip ranges, security groups and prefix lists allowed on a port range, the
+// result of the IpProvider.GetIPPermissions method is a list of them
+type IpPermission struct {
+	FromPort         int64             `json:"fromPort"`
+	ToPort           int64             `json:"toPort"`
+	IpProtocol       string            `json:"ipProtocol"`
+	IpRanges         []IpRange         `json:"ipRanges"`
+	UserIdGroupPairs []UserIdGroupPair `json:"userIdGroupPairs,omitempty"`
+	PrefixListIds    []PrefixListId    `json:"prefixListIds,omitempty"`
+}
+
+// IpRange is a cidr allowed by an IpPermission
+type IpRange struct {
+	IpCidr      string `json:"ipCidr"`
+	Description string `json:"description"`
+}
+
+// UserIdGroupPair is a security group allowed by an IpPermission, UserId is the account of the security
+// group if it belongs to another account
+type UserIdGroupPair struct {
+	GroupId     string `json:"groupId"`
+	UserId      string `json:"userId,omitempty"`
+	Description string `json:"description"`
+}
+
+// PrefixListId is a managed prefix list allowed by an IpPermission
+type PrefixListId struct {
+	PrefixListId string `json:"prefixListId"`
+	Description  string `json:"description"`
+}
+
+// ConvertParams converts params read from yaml, whose maps have interface{} keys, to params that can
+// be encoded as json
+func ConvertParams(params map[interface{}]interface{}) map[string]interface{} {
+	converted := map[string]interface{}{}
+	for key, value := range params {
+		converted[fmt.Sprint(key)] = convertValue(value)
+	}
+	return converted
+}
+
+func convertValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		return ConvertParams(value)
+	case []interface{}:
+		converted := make([]interface{}, len(value))
+		for i, item := range value {
+			converted[i] = convertValue(item)
+		}
+		return converted
+	}
+	return value
+}
@@ -0,0 +1,112 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// IpProvider is implemented by plugins that provide ip permissions to whitelist
+type IpProvider interface {
+	Init(params map[string]interface{}) error
+	GetIPPermissions() ([]IpPermission, error)
+}
+
+// Provider is implemented by plugins that whitelist ip permissions on resources
+type Provider interface {
+	Init(params map[string]interface{}) error
+	WhiteListIps(filter Filter, ipPermissions []IpPermission) (targetGroups []string, err error)
+}
+
+// Serve answers the requests of Whitelister on stdin and stdout until stdin is closed. Either
+// ipProvider or provider can be nil if the plugin does not implement it
+func Serve(name string, ipProvider IpProvider, provider Provider) error {
+	return serve(os.Stdin, os.Stdout, &server{name: name, ipProvider: ipProvider, provider: provider})
+}
+
+type server struct {
+	name       string
+	ipProvider IpProvider
+	provider   Provider
+}
+
+func serve(reader io.Reader, writer io.Writer, s *server) error {
+	decoder := json.NewDecoder(reader)
+	encoder := json.NewEncoder(writer)
+	for {
+		var request Request
+		err := decoder.Decode(&request)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		response := Response{ID: request.ID}
+		result, err := s.handle(request)
+		if err == nil {
+			response.Result, err = json.Marshal(result)
+		}
+		if err != nil {
+			response.Error = err.Error()
+		}
+		if err := encoder.Encode(response); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) handle(request Request) (interface{}, error) {
+	switch request.Method {
+	case MethodHandshake:
+		return HandshakeResult{
+			ProtocolVersion: ProtocolVersion,
+			Name:            s.name,
+			IpProvider:      s.ipProvider != nil,
+			Provider:        s.provider != nil,
+		}, nil
+	case MethodIpProviderInit, MethodGetIPPermissions:
+		if s.ipProvider == nil {
+			return nil, errors.New("Plugin is not an ip provider")
+		}
+		if request.Method == MethodGetIPPermissions {
+			return s.ipProvider.GetIPPermissions()
+		}
+		var params InitParams
+		if err := decodeParams(request, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.ipProvider.Init(params.Params)
+	case MethodProviderInit, MethodWhiteListIps:
+		if s.provider == nil {
+			return nil, errors.New("Plugin is not a provider")
+		}
+		if request.Method == MethodProviderInit {
+			var params InitParams
+			if err := decodeParams(request, &params); err != nil {
+				return nil, err
+			}
+			return nil, s.provider.Init(params.Params)
+		}
+		var params WhiteListIpsParams
+		if err := decodeParams(request, &params); err != nil {
+			return nil, err
+		}
+		targetGroups, err := s.provider.WhiteListIps(params.Filter, params.IpPermissions)
+		return WhiteListIpsResult{TargetGroups: targetGroups}, err
+	}
+	return nil, fmt.Errorf("Unknown method %s", request.Method)
+}
+
+func decodeParams(request Request, params interface{}) error {
+	if len(request.Params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(request.Params, params); err != nil {
+		return fmt.Errorf("Invalid params of %s : %v", request.Method, err)
+	}
+	return nil
+}